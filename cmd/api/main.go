@@ -1,22 +1,173 @@
 package main
 
 import (
-	"log"
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
 
 	"github.com/donnaloia/sendpulse/internal/api"
+	"github.com/donnaloia/sendpulse/internal/config"
 	"github.com/donnaloia/sendpulse/internal/database"
+	"github.com/donnaloia/sendpulse/internal/events"
+	"github.com/donnaloia/sendpulse/internal/health"
+	"github.com/donnaloia/sendpulse/internal/lifecycle"
+	"github.com/donnaloia/sendpulse/internal/logging"
+	"github.com/donnaloia/sendpulse/internal/metrics"
+	"github.com/donnaloia/sendpulse/internal/migrate"
+	"github.com/donnaloia/sendpulse/internal/services"
+	"github.com/donnaloia/sendpulse/internal/tracing"
+	"github.com/donnaloia/sendpulse/migrations"
 )
 
 func main() {
-	dbConfig := database.NewDefaultConfig()
-	db, err := database.Connect(dbConfig.ConnectionString())
+	configPath := flag.String("config", "", "YAML config file (default $"+config.FileEnv+")")
+	printConfig := flag.Bool("print-config", false, "print the configuration, with secrets redacted, and exit")
+	flag.Parse()
+
+	// Logged as configured once the configuration is known to be valid
+	defaultLog := logging.DefaultConfig()
+	logging.Setup(&defaultLog, os.Stderr)
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fatal(err)
+	}
+	if *printConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	if err := cfg.Validate(); err != nil {
+		fatal(err)
+	}
+	logging.Setup(&cfg.Log, os.Stderr)
+
+	if err := run(cfg); err != nil {
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	slog.Error(err.Error())
+	os.Exit(1)
+}
+
+// run starts the server and blocks until it has shut down. Components are
+// stopped in the reverse of the order they're added in.
+func run(cfg *config.Config) error {
+	app := lifecycle.New(cfg.HTTP.ShutdownTimeout)
+	readiness := health.NewChecker(cfg.HTTP.ReadinessTimeout, cfg.HTTP.ReadinessCacheTTL)
+	readiness.SetShuttingDown(app.ShuttingDown)
+
+	// Stopped last, so the spans of everything else's shutdown are flushed
+	flushTraces, err := tracing.Setup(context.Background(), &cfg.Tracing)
 	if err != nil {
-		log.Fatalf("failed to connect to the database: %v", err)
+		return err
 	}
-	defer db.Close()
+	app.Add(lifecycle.Component{Name: "tracing", Stop: flushTraces})
 
-	server := api.NewServer(db)
-	if err := server.Start(":8080"); err != nil {
-		log.Fatal(err)
+	db, err := database.Connect(&cfg.Database)
+	if err != nil {
+		return err
+	}
+	app.Add(lifecycle.Component{
+		Name: "database",
+		Stop: func(ctx context.Context) error { return db.Close() },
+	})
+	if err := metrics.RegisterDB(db, cfg.Database.DBName); err != nil {
+		db.Close()
+		return err
+	}
+
+	readiness.Add("database", db.PingContext)
+
+	migrator, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		db.Close()
+		return err
+	}
+	if cfg.Database.AutoMigrate {
+		if err := migrateUp(migrator); err != nil {
+			db.Close()
+			return err
+		}
+	}
+	// Without auto-migration the server starts on an old schema, and stays
+	// out of rotation until cmd/migrate has brought it up to date
+	readiness.Add("migrations", func(ctx context.Context) error {
+		unapplied, err := migrator.Unapplied(ctx)
+		if err != nil {
+			return err
+		}
+		if len(unapplied) > 0 {
+			return fmt.Errorf("%d pending, from %d (%s)", len(unapplied), unapplied[0].Version, unapplied[0].Name)
+		}
+		return nil
+	})
+
+	var relay *services.OutboxRelay
+	if cfg.Kafka.Enabled() {
+		p, err := events.NewEventPublisher(&cfg.Kafka)
+		if err != nil {
+			db.Close()
+			return err
+		}
+		// Closing the producer waits for messages still in flight
+		app.Add(lifecycle.Component{
+			Name: "event publisher",
+			Stop: func(ctx context.Context) error { return p.Close() },
+		})
+		readiness.Add("kafka", p.Ping)
+
+		// Publishes launches from the outbox; stopped before the producer,
+		// so its last pass is flushed
+		store := services.NewPostgresStore(db)
+		store.SetSlowQueryThreshold(cfg.Database.SlowQueryThreshold)
+		relay = services.NewOutboxRelay(store, p)
+		// A pass that can't publish stops at the first failed event, so it
+		// takes at most about one publish timeout
+		heartbeat := health.NewHeartbeat(3*cfg.Kafka.OutboxInterval + cfg.Kafka.Timeout)
+		app.Add(lifecycle.Component{
+			Name: "outbox relay",
+			Run: func(ctx context.Context) error {
+				return relay.Run(ctx, cfg.Kafka.OutboxInterval, heartbeat.Beat)
+			},
+		})
+		readiness.Add("outbox relay", heartbeat.Check)
+	}
+
+	// Background workers go here, between what they use and the server,
+	// each reporting to readiness through a health.Heartbeat
+
+	server := api.NewServer(db, cfg, relay, readiness)
+	app.Add(lifecycle.Component{
+		Name: "http server",
+		Run:  func(ctx context.Context) error { return server.Start(cfg.HTTP.Addr) },
+		Stop: func(ctx context.Context) error {
+			// /readyz is failing from here on; keep serving while load
+			// balancers notice
+			select {
+			case <-time.After(cfg.HTTP.ShutdownDelay):
+			case <-ctx.Done():
+			}
+			return server.Shutdown(ctx)
+		},
+	})
+
+	return app.Run(context.Background())
+}
+
+func migrateUp(migrator *migrate.Migrator) error {
+	applied, err := migrator.Up(context.Background())
+	if err != nil {
+		return err
+	}
+	for _, m := range applied {
+		slog.Info("applied migration", "version", m.Version, "name", m.Name)
 	}
+	return nil
 }
@@ -0,0 +1,152 @@
+// Command migrate manages the database schema:
+//
+//	migrate [-database DSN] up          apply every pending migration
+//	migrate [-database DSN] down [N]    roll back the last N migrations (default 1)
+//	migrate [-database DSN] goto V      migrate up or down to version V (0 for none)
+//	migrate [-database DSN] status      list migrations and whether they're applied
+//
+// The database is configured like the server's, by -config or the DB_*
+// variables, unless -database is given.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/donnaloia/sendpulse/internal/config"
+	"github.com/donnaloia/sendpulse/internal/database"
+	"github.com/donnaloia/sendpulse/internal/migrate"
+	"github.com/donnaloia/sendpulse/migrations"
+)
+
+func main() {
+	log.SetFlags(0)
+	configPath := flag.String("config", "", "YAML config file (default $"+config.FileEnv+")")
+	dsn := flag.String("database", "", "database connection string, overriding the configured database")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-database DSN] up | down [N] | goto VERSION | status\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *dsn != "" {
+		cfg.Database.URL = *dsn
+	}
+	if err := cfg.Database.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	db, err := database.Connect(&cfg.Database)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	migrator, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := run(ctx, migrator, flag.Arg(0), flag.Args()[1:]); err != nil {
+		db.Close()
+		log.Fatal(err)
+	}
+}
+
+func run(ctx context.Context, migrator *migrate.Migrator, command string, args []string) error {
+	switch command {
+	case "up":
+		if len(args) != 0 {
+			return fmt.Errorf("up takes no arguments")
+		}
+		ran, err := migrator.Up(ctx)
+		report("applied", ran)
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			return fmt.Errorf("down takes at most one argument")
+		}
+		if len(args) == 1 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of migrations %q", args[0])
+			}
+			steps = n
+		}
+		ran, err := migrator.Down(ctx, steps)
+		report("rolled back", ran)
+		return err
+	case "goto":
+		if len(args) != 1 {
+			return fmt.Errorf("goto takes a version")
+		}
+		version, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil || version < 0 {
+			return fmt.Errorf("invalid version %q", args[0])
+		}
+		ran, err := migrator.Goto(ctx, version)
+		report("ran", ran)
+		return err
+	case "status":
+		if len(args) != 0 {
+			return fmt.Errorf("status takes no arguments")
+		}
+		return status(ctx, migrator)
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+func report(verb string, ran []migrate.Migration) {
+	if len(ran) == 0 {
+		fmt.Println("nothing to do")
+		return
+	}
+	for _, m := range ran {
+		fmt.Printf("%s %d_%s\n", verb, m.Version, m.Name)
+	}
+}
+
+func status(ctx context.Context, migrator *migrate.Migrator) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED\tNOTE")
+	for _, s := range statuses {
+		applied := "pending"
+		if s.AppliedAt != nil {
+			applied = s.AppliedAt.Local().Format(time.RFC3339)
+		}
+		note := ""
+		switch {
+		case s.Missing:
+			note = "not in this build"
+		case s.Modified:
+			note = "edited since applied"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", s.Version, s.Name, applied, note)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,89 @@
+// Command seed loads fixtures into a migrated database:
+//
+//	seed [-database DSN] [options] FIXTURE...
+//	seed -list
+//
+// e.g. the sample data for local development, or a large generated
+// organization for load testing:
+//
+//	seed sample
+//	seed -addresses 1000000 -groups 50 load
+//
+// The database is configured like the server's, by -config or the DB_*
+// variables, unless -database is given.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/donnaloia/sendpulse/internal/config"
+	"github.com/donnaloia/sendpulse/internal/database"
+	"github.com/donnaloia/sendpulse/internal/seed"
+)
+
+func main() {
+	log.SetFlags(0)
+	opts := seed.DefaultOptions()
+	configPath := flag.String("config", "", "YAML config file (default $"+config.FileEnv+")")
+	dsn := flag.String("database", "", "database connection string, overriding the configured database")
+	list := flag.Bool("list", false, "list the fixtures")
+	flag.StringVar(&opts.Organization, "organization", "", "name of the generated organization (default \"Load test <time>\")")
+	flag.IntVar(&opts.Addresses, "addresses", opts.Addresses, "email addresses to generate")
+	flag.IntVar(&opts.Groups, "groups", opts.Groups, "email groups to generate")
+	flag.IntVar(&opts.Campaigns, "campaigns", opts.Campaigns, "campaigns to generate")
+	flag.IntVar(&opts.Templates, "templates", opts.Templates, "templates to generate")
+	flag.Float64Var(&opts.Overlap, "overlap", opts.Overlap, "share of addresses in a second group")
+	flag.Int64Var(&opts.Seed, "seed", opts.Seed, "random seed for the shapes and names of the generated data; IDs are always fresh")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-database DSN] [options] FIXTURE...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *list {
+		for _, f := range seed.Fixtures() {
+			fmt.Printf("%-10s %s\n", f.Name, f.Description)
+		}
+		return
+	}
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *dsn != "" {
+		cfg.Database.URL = *dsn
+	}
+	if err := cfg.Database.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	db, err := database.Connect(&cfg.Database)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	opts.Logf = log.Printf
+	for _, name := range flag.Args() {
+		start := time.Now()
+		if err := seed.Run(ctx, db, name, opts); err != nil {
+			db.Close()
+			log.Fatal(err)
+		}
+		log.Printf("seeded %s in %s", name, time.Since(start).Round(time.Millisecond))
+	}
+}
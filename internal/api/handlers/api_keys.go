@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/donnaloia/sendpulse/internal/auth"
+	"github.com/donnaloia/sendpulse/internal/idempotency"
+	"github.com/donnaloia/sendpulse/internal/models"
+	"github.com/donnaloia/sendpulse/internal/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+// APIKeys handler group - capitalized to make it public
+var APIKeys *APIKeyHandler
+
+// Initialize the api keys handler
+func InitAPIKeys(store services.Store) {
+	APIKeys = &APIKeyHandler{
+		apiKeyService: services.NewAPIKeyService(store),
+	}
+}
+
+type APIKeyHandler struct {
+	apiKeyService *services.APIKeyService
+}
+
+// Get handles GET requests to retrieve a single api key
+func (h *APIKeyHandler) Get(c echo.Context) error {
+	// Get the organization ID from the URL
+	organizationID := c.Param("organization_id")
+	if organizationID == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Missing organization ID")
+	}
+
+	// Get the api key ID from the URL
+	id := c.Param("id")
+	if id == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Missing ID")
+	}
+
+	// Get the resource
+	key, err := h.apiKeyService.GetByID(c.Request().Context(), organizationID, id)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, key)
+}
+
+// List handles GET requests to retrieve api keys
+func (h *APIKeyHandler) List(c echo.Context) error {
+	// Get the organization ID from the URL
+	organizationID := c.Param("organization_id")
+	if organizationID == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Missing organization ID")
+	}
+
+	// Parse pagination parameters from query string
+	params := parsePagination(c)
+
+	// Pass the params to GetAll
+	result, err := h.apiKeyService.GetAll(c.Request().Context(), organizationID, params)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
+// Create handles POST requests to create new api keys. The response is the
+// only time the plaintext key is returned.
+func (h *APIKeyHandler) Create(c echo.Context) error {
+	// Get the organization ID from the URL
+	organizationID := c.Param("organization_id")
+	if organizationID == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Missing organization ID")
+	}
+
+	// Bind the request body to the CreateAPIKey struct
+	var req models.CreateAPIKey
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	// Validate the request body
+	if err := c.Validate(&req); err != nil {
+		return err
+	}
+
+	// Callers can't mint a key more powerful than themselves
+	if principal, ok := auth.FromEcho(c); ok && !auth.IsSubset(req.Permissions, principal.Permissions) {
+		return echo.NewHTTPError(http.StatusForbidden, "api key permissions exceed your own")
+	}
+
+	// Create the resource
+	key, err := h.apiKeyService.Create(c.Request().Context(), actorFromContext(c), organizationID, &req)
+	if err != nil {
+		return err
+	}
+
+	// The plaintext key mustn't be kept for replaying
+	idempotency.MarkSecret(c)
+	return c.JSON(http.StatusCreated, key)
+}
+
+// Revoke handles DELETE requests to revoke an api key
+func (h *APIKeyHandler) Revoke(c echo.Context) error {
+	// Get the organization ID from the URL
+	organizationID := c.Param("organization_id")
+	if organizationID == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Missing organization ID")
+	}
+
+	// Get the api key ID from the URL
+	id := c.Param("id")
+	if id == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Missing ID")
+	}
+
+	if err := h.apiKeyService.Revoke(c.Request().Context(), actorFromContext(c), organizationID, id); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/donnaloia/sendpulse/internal/auth"
+	"github.com/donnaloia/sendpulse/internal/models"
+	"github.com/donnaloia/sendpulse/internal/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+// AuditLog handler group - capitalized to make it public
+var AuditLog *AuditLogHandler
+
+// Initialize the audit log handler
+func InitAuditLog(store services.Store) {
+	AuditLog = &AuditLogHandler{
+		auditService: services.NewAuditService(store),
+	}
+}
+
+type AuditLogHandler struct {
+	auditService *services.AuditService
+}
+
+// List handles GET requests to retrieve audit log entries
+func (h *AuditLogHandler) List(c echo.Context) error {
+	// Get the organization ID from the URL
+	organizationID := c.Param("organization_id")
+	if organizationID == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Missing organization ID")
+	}
+
+	// Parse pagination parameters from query string
+	params := parsePagination(c)
+
+	filter := models.AuditFilter{
+		ActorID:      c.QueryParam("actor_id"),
+		Action:       c.QueryParam("action"),
+		ResourceType: c.QueryParam("resource_type"),
+		ResourceID:   c.QueryParam("resource_id"),
+	}
+	if v := c.QueryParam("created_after"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "created_after must be an RFC 3339 timestamp")
+		}
+		filter.CreatedAfter = &t
+	}
+	if v := c.QueryParam("created_before"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "created_before must be an RFC 3339 timestamp")
+		}
+		filter.CreatedBefore = &t
+	}
+
+	result, err := h.auditService.GetAll(c.Request().Context(), organizationID, filter, params)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
+// actorFromContext identifies the caller of a mutating request for the audit
+// log. Requests without a principal (auth disabled) are recorded as anonymous.
+func actorFromContext(c echo.Context) models.Actor {
+	actor := models.Actor{
+		ID:        "anonymous",
+		Type:      "anonymous",
+		RequestID: c.Response().Header().Get(echo.HeaderXRequestID),
+		IP:        c.RealIP(),
+	}
+	if principal, ok := auth.FromEcho(c); ok {
+		actor.ID = principal.Subject
+		actor.Type = principal.Type
+	}
+	return actor
+}
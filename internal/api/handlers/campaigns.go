@@ -1,11 +1,10 @@
 package handlers
 
 import (
-	"database/sql"
 	"net/http"
-	"strconv"
 
 	"github.com/donnaloia/sendpulse/internal/models"
+	"github.com/donnaloia/sendpulse/internal/sending"
 	"github.com/donnaloia/sendpulse/internal/services"
 
 	"github.com/labstack/echo/v4"
@@ -14,10 +13,16 @@ import (
 // Campaigns handler group - capitalized to make it public
 var Campaigns *CampaignHandler
 
-// Initialize the campaigns handler
-func InitCampaigns(db *sql.DB) {
+// Initialize the campaigns handler. relay may be nil, in which case
+// launches aren't announced. Launches are checked against limits.
+func InitCampaigns(store services.Store, relay *services.OutboxRelay, limits *sending.Config) {
+	campaignService := services.NewCampaignService(store)
+	campaignService.SetLimits(limits)
+	if relay != nil {
+		campaignService.SetRelay(relay)
+	}
 	Campaigns = &CampaignHandler{
-		campaignService: services.NewCampaignService(db),
+		campaignService: campaignService,
 	}
 }
 
@@ -40,11 +45,14 @@ func (h *CampaignHandler) Get(c echo.Context) error {
 	}
 
 	// Get the resource
-	campaign, err := h.campaignService.GetByID(organizationID, id)
+	campaign, err := h.campaignService.GetByID(c.Request().Context(), organizationID, id)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		return err
 	}
 
+	if notModified(c, campaign.Version) {
+		return c.NoContent(http.StatusNotModified)
+	}
 	return c.JSON(http.StatusOK, campaign)
 }
 
@@ -57,19 +65,18 @@ func (h *CampaignHandler) List(c echo.Context) error {
 	}
 
 	// Parse pagination parameters from query string
-	page, _ := strconv.Atoi(c.QueryParam("page"))
-	pageSize, _ := strconv.Atoi(c.QueryParam("page_size"))
+	params := parsePagination(c)
 
-	// Create pagination params with defaults
-	params := models.PaginationParams{
-		Page:     page,
-		PageSize: pageSize,
+	// Parse sorting, filtering and search parameters
+	query, err := parseListQuery(c)
+	if err != nil {
+		return err
 	}
 
 	// Pass the params to GetAll
-	result, err := h.campaignService.GetAll(organizationID, params)
+	result, err := h.campaignService.GetAll(c.Request().Context(), organizationID, query, params)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return err
 	}
 
 	return c.JSON(http.StatusOK, result)
@@ -89,13 +96,18 @@ func (h *CampaignHandler) Create(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
+	// Validate the request body
+	if err := c.Validate(&req); err != nil {
+		return err
+	}
+
 	// Add organizationID to the request
 	req.OrganizationID = organizationID
 
 	// Create the resource
-	campaign, err := h.campaignService.Create(organizationID, &req)
+	campaign, err := h.campaignService.Create(c.Request().Context(), actorFromContext(c), organizationID, &req)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return err
 	}
 
 	return c.JSON(http.StatusCreated, campaign)
@@ -122,11 +134,23 @@ func (h *CampaignHandler) Update(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
+	// Validate the request body
+	if err := c.Validate(&req); err != nil {
+		return err
+	}
+
+	// Only update the version the client last saw, if it says which
+	version, err := ifMatchVersion(c, config.RequireIfMatch)
+	if err != nil {
+		return err
+	}
+
 	// Update the resource
-	campaign, err := h.campaignService.Update(organizationID, id, &req)
+	campaign, err := h.campaignService.Update(c.Request().Context(), actorFromContext(c), organizationID, id, &req, version)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return err
 	}
 
+	c.Response().Header().Set("ETag", etag(campaign.Version))
 	return c.JSON(http.StatusOK, campaign)
 }
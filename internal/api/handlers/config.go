@@ -0,0 +1,15 @@
+package handlers
+
+// Config holds the handler options that change API behaviour
+type Config struct {
+	// RequireIfMatch rejects PATCHes to versioned resources that don't send
+	// If-Match with 428, instead of applying them unconditionally
+	RequireIfMatch bool
+}
+
+var config = &Config{}
+
+// Configure sets the options used by every handler
+func Configure(cfg *Config) {
+	config = cfg
+}
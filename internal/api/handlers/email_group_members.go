@@ -1,9 +1,7 @@
 package handlers
 
 import (
-	"database/sql"
 	"net/http"
-	"strconv"
 
 	"github.com/donnaloia/sendpulse/internal/models"
 	"github.com/donnaloia/sendpulse/internal/services"
@@ -15,9 +13,9 @@ import (
 var EmailGroupMembers *EmailGroupMemberHandler
 
 // Initialize the email group members handler
-func InitEmailGroupMembers(db *sql.DB) {
+func InitEmailGroupMembers(store services.Store) {
 	EmailGroupMembers = &EmailGroupMemberHandler{
-		service: services.NewEmailGroupMemberService(db),
+		service: services.NewEmailGroupMemberService(store),
 	}
 }
 
@@ -32,9 +30,9 @@ func (h *EmailGroupMemberHandler) Get(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Missing ID")
 	}
 
-	member, err := h.service.GetByID(id)
+	member, err := h.service.GetByID(c.Request().Context(), c.Param("organization_id"), id)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		return err
 	}
 
 	return c.JSON(http.StatusOK, member)
@@ -43,17 +41,11 @@ func (h *EmailGroupMemberHandler) Get(c echo.Context) error {
 // ListMembers handles GET requests to retrieve email group members
 func (h *EmailGroupMemberHandler) List(c echo.Context) error {
 	// Parse pagination parameters from query string
-	page, _ := strconv.Atoi(c.QueryParam("page"))
-	pageSize, _ := strconv.Atoi(c.QueryParam("page_size"))
+	params := parsePagination(c)
 
-	params := models.PaginationParams{
-		Page:     page,
-		PageSize: pageSize,
-	}
-
-	result, err := h.service.GetAll(params)
+	result, err := h.service.GetAll(c.Request().Context(), c.Param("organization_id"), params)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return err
 	}
 
 	return c.JSON(http.StatusOK, result)
@@ -61,36 +53,34 @@ func (h *EmailGroupMemberHandler) List(c echo.Context) error {
 
 // AddMember handles POST requests to add an email to a group
 func (h *EmailGroupMemberHandler) Create(c echo.Context) error {
-	groupID := c.Param("group_id")
-	if groupID == "" {
-		return echo.NewHTTPError(http.StatusBadRequest, "Missing group ID")
-	}
-
 	var req models.CreateEmailGroupMember
 	if err := c.Bind(&req); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
-	req.EmailGroupID = groupID
 
-	member, err := h.service.Create(&req)
+	// Validate the request body
+	if err := c.Validate(&req); err != nil {
+		return err
+	}
+
+	member, err := h.service.Create(c.Request().Context(), actorFromContext(c), c.Param("organization_id"), &req)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return err
 	}
 
 	return c.JSON(http.StatusCreated, member)
 }
 
 // RemoveMember handles DELETE requests to remove an email from a group
-func (h *EmailGroupMemberHandler) RemoveMember(c echo.Context) error {
-	groupID := c.Param("group_id")
-	memberID := c.Param("member_id")
-	if groupID == "" || memberID == "" {
-		return echo.NewHTTPError(http.StatusBadRequest, "Missing group ID or member ID")
+func (h *EmailGroupMemberHandler) Delete(c echo.Context) error {
+	id := c.Param("id")
+	if id == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Missing ID")
 	}
 
-	err := h.service.Delete(groupID, memberID)
+	err := h.service.Delete(c.Request().Context(), actorFromContext(c), c.Param("organization_id"), id)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return err
 	}
 
 	return c.NoContent(http.StatusNoContent)
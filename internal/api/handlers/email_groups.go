@@ -1,10 +1,7 @@
 package handlers
 
 import (
-	"database/sql"
-	"fmt"
 	"net/http"
-	"strconv"
 
 	"github.com/donnaloia/sendpulse/internal/models"
 	"github.com/donnaloia/sendpulse/internal/services"
@@ -16,9 +13,9 @@ import (
 var EmailGroups *EmailGroupHandler
 
 // Initialize the email groups handler
-func InitEmailGroups(db *sql.DB) {
+func InitEmailGroups(store services.Store) {
 	EmailGroups = &EmailGroupHandler{
-		emailGroupService: services.NewEmailGroupService(db),
+		emailGroupService: services.NewEmailGroupService(store),
 	}
 }
 
@@ -41,9 +38,9 @@ func (h *EmailGroupHandler) Get(c echo.Context) error {
 	}
 
 	// Get the resource
-	emailGroup, err := h.emailGroupService.GetByID(organizationID, id)
+	emailGroup, err := h.emailGroupService.GetByID(c.Request().Context(), organizationID, id)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		return err
 	}
 
 	return c.JSON(http.StatusOK, emailGroup)
@@ -63,19 +60,18 @@ func (h *EmailGroupHandler) List(c echo.Context) error {
 	}
 
 	// Parse pagination parameters from query string
-	page, _ := strconv.Atoi(c.QueryParam("page"))
-	pageSize, _ := strconv.Atoi(c.QueryParam("page_size"))
+	params := parsePagination(c)
 
-	// Create pagination params with defaults
-	params := models.PaginationParams{
-		Page:     page,
-		PageSize: pageSize,
+	// Parse sorting, filtering and search parameters
+	query, err := parseListQuery(c)
+	if err != nil {
+		return err
 	}
 
 	// Get paginated email groups from service
-	result, err := h.emailGroupService.GetAll(organizationID, params)
+	result, err := h.emailGroupService.GetAll(c.Request().Context(), organizationID, query, params)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("error fetching email groups: %v", err))
+		return err
 	}
 
 	return c.JSON(http.StatusOK, result)
@@ -95,10 +91,15 @@ func (h *EmailGroupHandler) Create(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
+	// Validate the request body
+	if err := c.Validate(&req); err != nil {
+		return err
+	}
+
 	// Create the resource
-	emailGroup, err := h.emailGroupService.Create(organizationID, &req)
+	emailGroup, err := h.emailGroupService.Create(c.Request().Context(), actorFromContext(c), organizationID, &req)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return err
 	}
 
 	return c.JSON(http.StatusCreated, emailGroup)
@@ -1,9 +1,7 @@
 package handlers
 
 import (
-	"database/sql"
 	"net/http"
-	"strconv"
 
 	"github.com/donnaloia/sendpulse/internal/models"
 	"github.com/donnaloia/sendpulse/internal/services"
@@ -15,9 +13,9 @@ import (
 var Emails *EmailHandler
 
 // Initialize the emails handler
-func InitEmails(db *sql.DB) {
+func InitEmails(store services.Store) {
 	Emails = &EmailHandler{
-		emailService: services.NewEmailService(db),
+		emailService: services.NewEmailService(store),
 	}
 }
 
@@ -40,9 +38,9 @@ func (h *EmailHandler) Get(c echo.Context) error {
 	}
 
 	// Get the resource
-	email, err := h.emailService.GetByID(id, organizationID)
+	email, err := h.emailService.GetByID(c.Request().Context(), organizationID, id)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		return err
 	}
 
 	return c.JSON(http.StatusOK, email)
@@ -51,13 +49,12 @@ func (h *EmailHandler) Get(c echo.Context) error {
 // ListEmails handles GET requests to retrieve email addresses
 func (h *EmailHandler) List(c echo.Context) error {
 	// Parse pagination parameters from query string
-	page, _ := strconv.Atoi(c.QueryParam("page"))
-	pageSize, _ := strconv.Atoi(c.QueryParam("page_size"))
+	params := parsePagination(c)
 
-	// Create pagination params with defaults
-	params := models.PaginationParams{
-		Page:     page,
-		PageSize: pageSize,
+	// Parse sorting, filtering and search parameters
+	query, err := parseListQuery(c)
+	if err != nil {
+		return err
 	}
 
 	// Get the organization ID from the URL
@@ -67,9 +64,9 @@ func (h *EmailHandler) List(c echo.Context) error {
 	}
 
 	// Get all the resources
-	result, err := h.emailService.GetAll(organizationID, params)
+	result, err := h.emailService.GetAll(c.Request().Context(), organizationID, query, params)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return err
 	}
 
 	return c.JSON(http.StatusOK, result)
@@ -89,10 +86,15 @@ func (h *EmailHandler) Create(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
+	// Validate the request body
+	if err := c.Validate(&req); err != nil {
+		return err
+	}
+
 	// Create the resource
-	email, err := h.emailService.Create(organizationID, &req)
+	email, err := h.emailService.Create(c.Request().Context(), actorFromContext(c), organizationID, &req)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return err
 	}
 
 	return c.JSON(http.StatusCreated, email)
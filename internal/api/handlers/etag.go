@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Versioned resources use their row version as a strong ETag, e.g. "7"
+
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// notModified sets the ETag header and reports whether the request's
+// If-None-Match already covers it, in which case the caller should answer
+// 304 instead of sending the body
+func notModified(c echo.Context, version int) bool {
+	tag := etag(version)
+	c.Response().Header().Set("ETag", tag)
+
+	header := c.Request().Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		// If-None-Match uses the weak comparison
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatchVersion returns the version a conditional write must match, or 0
+// when the request isn't conditional. Only a single strong ETag or "*" is
+// meaningful for a write. When required, a missing If-Match is rejected.
+func ifMatchVersion(c echo.Context, required bool) (int, error) {
+	header := strings.TrimSpace(c.Request().Header.Get("If-Match"))
+	if header == "" {
+		if required {
+			return 0, echo.NewHTTPError(http.StatusPreconditionRequired, "If-Match is required; send the ETag from a GET")
+		}
+		return 0, nil
+	}
+	if header == "*" {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(strings.Trim(header, `"`))
+	if err != nil || version < 1 || !strings.HasPrefix(header, `"`) {
+		return 0, echo.NewHTTPError(http.StatusPreconditionFailed, "If-Match must be an ETag from a GET")
+	}
+	return version, nil
+}
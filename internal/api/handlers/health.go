@@ -3,11 +3,20 @@ package handlers
 import (
 	"net/http"
 
+	"github.com/donnaloia/sendpulse/internal/health"
 	"github.com/donnaloia/sendpulse/pkg/response"
 
 	"github.com/labstack/echo/v4"
 )
 
+// readiness runs the checks behind /readyz; nil means there's nothing to
+// check
+var readiness *health.Checker
+
+func InitHealth(checker *health.Checker) {
+	readiness = checker
+}
+
 func HealthCheck(c echo.Context) error {
 	return c.JSON(http.StatusOK, response.New(
 		"success",
@@ -15,3 +24,25 @@ func HealthCheck(c echo.Context) error {
 		nil,
 	))
 }
+
+// Livez answers as long as the process is serving requests. It checks
+// nothing else, so a dependency being down never gets the service
+// restarted.
+func Livez(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Readyz reports whether the service should be sent traffic, with the state
+// of each dependency. It's 503 when any check fails and while shutting
+// down.
+func Readyz(c echo.Context) error {
+	report := &health.Report{Status: health.StatusReady, Components: map[string]health.Component{}}
+	if readiness != nil {
+		report = readiness.Check(c.Request().Context())
+	}
+	status := http.StatusOK
+	if !report.Ready() {
+		status = http.StatusServiceUnavailable
+	}
+	return c.JSON(status, report)
+}
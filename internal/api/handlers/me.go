@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/donnaloia/sendpulse/internal/auth"
+
+	"github.com/labstack/echo/v4"
+)
+
+type myPermissionsResponse struct {
+	Subject        string   `json:"subject"`
+	OrganizationID string   `json:"organization_id"`
+	Granted        []string `json:"granted"`
+	Effective      []string `json:"effective"`
+}
+
+// MyPermissions handles GET requests for the caller's own permissions, with
+// roles and wildcards resolved to concrete permissions
+func MyPermissions(c echo.Context) error {
+	principal, ok := auth.FromEcho(c)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "not authenticated")
+	}
+
+	return c.JSON(http.StatusOK, myPermissionsResponse{
+		Subject:        principal.Subject,
+		OrganizationID: principal.OrganizationID,
+		Granted:        principal.Permissions,
+		Effective:      auth.EffectivePermissions(principal.Permissions),
+	})
+}
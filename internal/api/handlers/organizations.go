@@ -1,10 +1,9 @@
 package handlers
 
 import (
-	"database/sql"
 	"net/http"
-	"strconv"
 
+	"github.com/donnaloia/sendpulse/internal/auth"
 	"github.com/donnaloia/sendpulse/internal/models"
 	"github.com/donnaloia/sendpulse/internal/services"
 
@@ -15,9 +14,9 @@ import (
 var Organizations *OrganizationHandler
 
 // Initialize the organizations handler
-func InitOrganizations(db *sql.DB) {
+func InitOrganizations(store services.Store) {
 	Organizations = &OrganizationHandler{
-		service: services.NewOrganizationService(db),
+		service: services.NewOrganizationService(store),
 	}
 }
 
@@ -32,27 +31,30 @@ func (h *OrganizationHandler) Get(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Missing ID")
 	}
 
-	org, err := h.service.GetByID(id)
+	org, err := h.service.GetByID(c.Request().Context(), id)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		return err
 	}
 
 	return c.JSON(http.StatusOK, org)
 }
 
-// List handles GET requests to retrieve organizations
+// List handles GET requests to retrieve organizations. Callers only see
+// their own unless they may read every organization.
 func (h *OrganizationHandler) List(c echo.Context) error {
-	page, _ := strconv.Atoi(c.QueryParam("page"))
-	pageSize, _ := strconv.Atoi(c.QueryParam("page_size"))
-
-	params := models.PaginationParams{
-		Page:     page,
-		PageSize: pageSize,
+	if principal, ok := auth.FromEcho(c); ok && !principal.CrossOrganization() {
+		result, err := h.service.GetOwn(c.Request().Context(), principal.OrganizationID)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, result)
 	}
 
-	result, err := h.service.GetAll(params)
+	params := parsePagination(c)
+
+	result, err := h.service.GetAll(c.Request().Context(), params)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return err
 	}
 
 	return c.JSON(http.StatusOK, result)
@@ -65,9 +67,14 @@ func (h *OrganizationHandler) Create(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	org, err := h.service.Create(&req)
+	// Validate the request body
+	if err := c.Validate(&req); err != nil {
+		return err
+	}
+
+	org, err := h.service.Create(c.Request().Context(), actorFromContext(c), &req)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return err
 	}
 
 	return c.JSON(http.StatusCreated, org)
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"strconv"
+
+	"github.com/donnaloia/sendpulse/internal/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// parsePagination reads page, page_size, cursor and include_total from the
+// query string. A cursor takes precedence over page.
+func parsePagination(c echo.Context) models.PaginationParams {
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	pageSize, _ := strconv.Atoi(c.QueryParam("page_size"))
+	includeTotal, _ := strconv.ParseBool(c.QueryParam("include_total"))
+
+	return models.PaginationParams{
+		Page:         page,
+		PageSize:     pageSize,
+		Cursor:       c.QueryParam("cursor"),
+		IncludeTotal: includeTotal,
+	}
+}
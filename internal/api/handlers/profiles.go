@@ -1,9 +1,7 @@
 package handlers
 
 import (
-	"database/sql"
 	"net/http"
-	"strconv"
 
 	"github.com/donnaloia/sendpulse/internal/models"
 	"github.com/donnaloia/sendpulse/internal/services"
@@ -15,9 +13,9 @@ import (
 var Profiles *ProfileHandler
 
 // Initialize the profiles handler
-func InitProfiles(db *sql.DB) {
+func InitProfiles(store services.Store) {
 	Profiles = &ProfileHandler{
-		profileService: services.NewProfileService(db),
+		profileService: services.NewProfileService(store),
 	}
 }
 
@@ -40,9 +38,9 @@ func (h *ProfileHandler) Get(c echo.Context) error {
 	}
 
 	// Get the resource
-	profile, err := h.profileService.GetByID(organizationID, id)
+	profile, err := h.profileService.GetByID(c.Request().Context(), organizationID, id)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		return err
 	}
 
 	return c.JSON(http.StatusOK, profile)
@@ -57,19 +55,12 @@ func (h *ProfileHandler) List(c echo.Context) error {
 	}
 
 	// Parse pagination parameters from query string
-	page, _ := strconv.Atoi(c.QueryParam("page"))
-	pageSize, _ := strconv.Atoi(c.QueryParam("page_size"))
-
-	// Create pagination params with defaults
-	params := models.PaginationParams{
-		Page:     page,
-		PageSize: pageSize,
-	}
+	params := parsePagination(c)
 
 	// Pass the params to GetAll
-	result, err := h.profileService.GetAll(organizationID, params)
+	result, err := h.profileService.GetAll(c.Request().Context(), organizationID, params)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return err
 	}
 
 	return c.JSON(http.StatusOK, result)
@@ -89,13 +80,18 @@ func (h *ProfileHandler) Create(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
+	// Validate the request body
+	if err := c.Validate(&req); err != nil {
+		return err
+	}
+
 	// Add organizationID to the request
 	req.OrganizationID = organizationID
 
 	// Create the resource
-	profile, err := h.profileService.Create(organizationID, &req)
+	profile, err := h.profileService.Create(c.Request().Context(), actorFromContext(c), organizationID, &req)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return err
 	}
 
 	return c.JSON(http.StatusCreated, profile)
@@ -121,10 +117,15 @@ func (h *ProfileHandler) Update(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
+	// Validate the request body
+	if err := c.Validate(&req); err != nil {
+		return err
+	}
+
 	// Update the resource
-	profile, err := h.profileService.Update(organizationID, id, &req)
+	profile, err := h.profileService.Update(c.Request().Context(), actorFromContext(c), organizationID, id, &req)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return err
 	}
 
 	return c.JSON(http.StatusOK, profile)
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/donnaloia/sendpulse/internal/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// listParams are the query parameters handled by parsePagination and
+// parseListQuery itself; every other parameter is taken as a field filter
+var listParams = map[string]bool{
+	"page":           true,
+	"page_size":      true,
+	"cursor":         true,
+	"include_total":  true,
+	"sort":           true,
+	"q":              true,
+	"created_after":  true,
+	"created_before": true,
+}
+
+// parseListQuery reads sort, q, created_after, created_before and field
+// filters from the query string:
+//
+//	?sort=name,-created_at&status=draft,scheduled&q=spring&created_after=2024-01-01T00:00:00Z
+//
+// Field names are only parsed here; the service rejects any its resource
+// doesn't whitelist.
+func parseListQuery(c echo.Context) (models.ListQuery, error) {
+	var query models.ListQuery
+
+	if v := c.QueryParam("sort"); v != "" {
+		for _, field := range strings.Split(v, ",") {
+			field = strings.TrimSpace(field)
+			desc := strings.HasPrefix(field, "-")
+			field = strings.TrimPrefix(field, "-")
+			if field == "" {
+				return query, echo.NewHTTPError(http.StatusBadRequest, "sort contains an empty field")
+			}
+			query.Sort = append(query.Sort, models.SortField{Field: field, Desc: desc})
+		}
+	}
+
+	query.Search = strings.TrimSpace(c.QueryParam("q"))
+
+	if v := c.QueryParam("created_after"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return query, echo.NewHTTPError(http.StatusBadRequest, "created_after must be an RFC 3339 timestamp")
+		}
+		query.CreatedAfter = &t
+	}
+	if v := c.QueryParam("created_before"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return query, echo.NewHTTPError(http.StatusBadRequest, "created_before must be an RFC 3339 timestamp")
+		}
+		query.CreatedBefore = &t
+	}
+
+	// A repeated parameter or a comma-separated value matches any of the values
+	for name, values := range c.QueryParams() {
+		if listParams[name] {
+			continue
+		}
+		var matches []string
+		for _, v := range values {
+			matches = append(matches, strings.Split(v, ",")...)
+		}
+		if query.Filters == nil {
+			query.Filters = map[string][]string{}
+		}
+		query.Filters[name] = matches
+	}
+
+	return query, nil
+}
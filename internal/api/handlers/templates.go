@@ -1,9 +1,7 @@
 package handlers
 
 import (
-	"database/sql"
 	"net/http"
-	"strconv"
 
 	"github.com/donnaloia/sendpulse/internal/models"
 	"github.com/donnaloia/sendpulse/internal/services"
@@ -15,9 +13,9 @@ import (
 var Templates *TemplateHandler
 
 // Initialize the templates handler
-func InitTemplates(db *sql.DB) {
+func InitTemplates(store services.Store) {
 	Templates = &TemplateHandler{
-		templateService: services.NewTemplateService(db),
+		templateService: services.NewTemplateService(store),
 	}
 }
 
@@ -40,11 +38,14 @@ func (h *TemplateHandler) Get(c echo.Context) error {
 	}
 
 	// Get the resource
-	template, err := h.templateService.GetByID(id, organizationID)
+	template, err := h.templateService.GetByID(c.Request().Context(), organizationID, id)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		return err
 	}
 
+	if notModified(c, template.Version) {
+		return c.NoContent(http.StatusNotModified)
+	}
 	return c.JSON(http.StatusOK, template)
 }
 
@@ -57,19 +58,18 @@ func (h *TemplateHandler) List(c echo.Context) error {
 	}
 
 	// Parse pagination parameters from query string
-	page, _ := strconv.Atoi(c.QueryParam("page"))
-	pageSize, _ := strconv.Atoi(c.QueryParam("page_size"))
+	params := parsePagination(c)
 
-	// Create pagination params with defaults
-	params := models.PaginationParams{
-		Page:     page,
-		PageSize: pageSize,
+	// Parse sorting, filtering and search parameters
+	query, err := parseListQuery(c)
+	if err != nil {
+		return err
 	}
 
 	// Pass the params to GetAll
-	result, err := h.templateService.GetAll(organizationID, params)
+	result, err := h.templateService.GetAll(c.Request().Context(), organizationID, query, params)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return err
 	}
 
 	return c.JSON(http.StatusOK, result)
@@ -89,14 +89,60 @@ func (h *TemplateHandler) Create(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
+	// Validate the request body
+	if err := c.Validate(&req); err != nil {
+		return err
+	}
+
 	// Add organizationID to the request
 	req.OrganizationID = organizationID
 
 	// Create the resource
-	template, err := h.templateService.Create(organizationID, &req)
+	template, err := h.templateService.Create(c.Request().Context(), actorFromContext(c), organizationID, &req)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return err
 	}
 
 	return c.JSON(http.StatusCreated, template)
 }
+
+// Update handles PATCH requests to update a template
+func (h *TemplateHandler) Update(c echo.Context) error {
+	// Get the organization ID from the URL
+	organizationID := c.Param("organization_id")
+	if organizationID == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Missing organization ID")
+	}
+
+	// Get the template ID from the URL
+	id := c.Param("id")
+	if id == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Missing ID")
+	}
+
+	// Bind the request body to the UpdateTemplate struct
+	var req models.UpdateTemplate
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	// Validate the request body
+	if err := c.Validate(&req); err != nil {
+		return err
+	}
+
+	// Only update the version the client last saw, if it says which
+	version, err := ifMatchVersion(c, config.RequireIfMatch)
+	if err != nil {
+		return err
+	}
+
+	// Update the resource
+	template, err := h.templateService.Update(c.Request().Context(), actorFromContext(c), organizationID, id, &req, version)
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("ETag", etag(template.Version))
+	return c.JSON(http.StatusOK, template)
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/donnaloia/sendpulse/internal/sending"
+	"github.com/donnaloia/sendpulse/internal/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Usage handler group - capitalized to make it public
+var Usage *UsageHandler
+
+// Initialize the sending usage handler
+func InitUsage(store services.Store, limits *sending.Config) {
+	Usage = &UsageHandler{
+		sendingService: services.NewSendingService(store, limits),
+	}
+}
+
+type UsageHandler struct {
+	sendingService *services.SendingService
+}
+
+// Get handles GET requests for an organization's sending usage and the
+// quota it has left
+func (h *UsageHandler) Get(c echo.Context) error {
+	// Get the organization ID from the URL
+	organizationID := c.Param("organization_id")
+	if organizationID == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Missing organization ID")
+	}
+
+	usage, err := h.sendingService.Usage(c.Request().Context(), organizationID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, usage)
+}
@@ -0,0 +1,252 @@
+//go:build integration
+
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/donnaloia/sendpulse/internal/config"
+	"github.com/donnaloia/sendpulse/internal/models"
+	"github.com/donnaloia/sendpulse/internal/testdb"
+
+	"github.com/labstack/echo/v4"
+)
+
+// With the integration tag the endpoint tests in server_test.go run against
+// Postgres through NewServer, each on a database of its own, alongside tests
+// of what only the schema enforces:
+//
+//	go test -tags integration ./internal/api
+func TestMain(m *testing.M) {
+	newTestApp = func(t *testing.T) *echo.Echo {
+		return NewServer(testdb.New(t), config.Default(), nil, nil).echo
+	}
+	testdb.Main(m)
+}
+
+func newIntegrationClient(t *testing.T) (*testClient, *sql.DB) {
+	t.Helper()
+	db := testdb.New(t)
+	return &testClient{t: t, e: NewServer(db, config.Default(), nil, nil).echo}, db
+}
+
+func count(t *testing.T, db *sql.DB, query string, args ...any) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestIntegrationCascades(t *testing.T) {
+	c, db := newIntegrationClient(t)
+	org := c.createOrganization("Acme")
+
+	var email models.EmailAddress
+	c.expect(http.StatusCreated, &email, http.MethodPost, orgPath(org, "/email-addresses"), models.CreateEmailAddressRequest{Address: "ada@example.com"})
+	var group models.EmailGroup
+	c.expect(http.StatusCreated, &group, http.MethodPost, orgPath(org, "/email-groups"), models.CreateEmailGroup{Name: "Customers"})
+	var member models.EmailGroupMember
+	c.expect(http.StatusCreated, &member, http.MethodPost, orgPath(org, "/email-group-members"), models.CreateEmailGroupMember{
+		EmailGroupID:   group.ID,
+		EmailAddressID: email.ID,
+	})
+	var template models.Template
+	c.expect(http.StatusCreated, &template, http.MethodPost, orgPath(org, "/templates"), models.CreateTemplate{Name: "Welcome", HTML: "<p>Hi</p>"})
+	var campaign models.Campaign
+	c.expect(http.StatusCreated, &campaign, http.MethodPost, orgPath(org, "/campaigns"), models.CreateCampaign{Name: "Spring"})
+	c.expect(http.StatusOK, nil, http.MethodPatch, orgPath(org, "/campaigns/"+campaign.ID), models.UpdateCampaign{
+		Templates:   []string{template.ID},
+		EmailGroups: []string{group.ID},
+	})
+
+	// Deleting an address drops its memberships
+	if _, err := db.Exec(`DELETE FROM email_addresses WHERE id = $1`, email.ID); err != nil {
+		t.Fatal(err)
+	}
+	c.expectError(http.StatusNotFound, "not_found", http.MethodGet, orgPath(org, "/email-group-members/"+member.ID), nil)
+
+	// Deleting a template unlinks it from campaigns
+	if _, err := db.Exec(`DELETE FROM templates WHERE id = $1`, template.ID); err != nil {
+		t.Fatal(err)
+	}
+	var got models.Campaign
+	c.expect(http.StatusOK, &got, http.MethodGet, orgPath(org, "/campaigns/"+campaign.ID), nil)
+	if len(got.Templates) != 0 || len(got.EmailGroups) != 1 {
+		t.Fatalf("campaign = %+v", got)
+	}
+
+	// Deleting the organization takes everything with it but the audit trail
+	if _, err := db.Exec(`DELETE FROM organizations WHERE id = $1`, org.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"campaigns", "email_groups", "templates"} {
+		if n := count(t, db, `SELECT COUNT(*) FROM `+table+` WHERE organization_id = $1`, org.ID); n != 0 {
+			t.Fatalf("%d %s left", n, table)
+		}
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM email_group_campaigns WHERE campaign_id = $1`, campaign.ID); n != 0 {
+		t.Fatalf("%d campaign links left", n)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM audit_log WHERE organization_id = $1`, org.ID); n == 0 {
+		t.Fatal("audit trail was deleted with the organization")
+	}
+}
+
+func TestIntegrationTenantScoping(t *testing.T) {
+	c, db := newIntegrationClient(t)
+	acme := c.createOrganization("Acme")
+	globex := c.createOrganization("Globex")
+
+	var campaign models.Campaign
+	c.expect(http.StatusCreated, &campaign, http.MethodPost, orgPath(acme, "/campaigns"), models.CreateCampaign{Name: "Spring"})
+	var theirTemplate models.Template
+	c.expect(http.StatusCreated, &theirTemplate, http.MethodPost, orgPath(globex, "/templates"), models.CreateTemplate{Name: "Theirs", HTML: "<p>Hi</p>"})
+	var theirGroup models.EmailGroup
+	c.expect(http.StatusCreated, &theirGroup, http.MethodPost, orgPath(globex, "/email-groups"), models.CreateEmailGroup{Name: "Theirs"})
+
+	c.expectError(http.StatusUnprocessableEntity, "validation_failed", http.MethodPatch, orgPath(acme, "/campaigns/"+campaign.ID), models.UpdateCampaign{
+		Name:        "Renamed",
+		Templates:   []string{theirTemplate.ID},
+		EmailGroups: []string{theirGroup.ID},
+	})
+	if n := count(t, db, `SELECT COUNT(*) FROM campaign_templates WHERE campaign_id = $1`, campaign.ID); n != 0 {
+		t.Fatalf("%d templates linked across organizations", n)
+	}
+
+	// The rejected update changed nothing
+	var got models.Campaign
+	c.expect(http.StatusOK, &got, http.MethodGet, orgPath(acme, "/campaigns/"+campaign.ID), nil)
+	if got.Name != "Spring" || got.Version != campaign.Version {
+		t.Fatalf("campaign = %+v", got)
+	}
+
+	c.expectError(http.StatusNotFound, "not_found", http.MethodGet, orgPath(globex, "/campaigns/"+campaign.ID), nil)
+	c.expectError(http.StatusNotFound, "not_found", http.MethodPatch, orgPath(globex, "/campaigns/"+campaign.ID), models.UpdateCampaign{Name: "Stolen"})
+	c.expectError(http.StatusNotFound, "not_found", http.MethodGet, orgPath(acme, "/templates/"+theirTemplate.ID), nil)
+	c.expectError(http.StatusNotFound, "not_found", http.MethodGet, orgPath(acme, "/email-groups/"+theirGroup.ID), nil)
+
+	var entries models.PaginatedResponse[models.AuditEntry]
+	c.expect(http.StatusOK, &entries, http.MethodGet, orgPath(globex, "/audit-log?resource_type=campaign"), nil)
+	if len(entries.Results) != 0 {
+		t.Fatalf("audit entries leaked across organizations: %+v", entries.Results)
+	}
+}
+
+func TestIntegrationConstraints(t *testing.T) {
+	c, _ := newIntegrationClient(t)
+	acme := c.createOrganization("Acme")
+	globex := c.createOrganization("Globex")
+
+	// Addresses are unique across all organizations, not per organization
+	c.expect(http.StatusCreated, nil, http.MethodPost, orgPath(acme, "/email-addresses"), models.CreateEmailAddressRequest{Address: "ada@example.com"})
+	errResp := c.expectError(http.StatusConflict, "conflict", http.MethodPost, orgPath(globex, "/email-addresses"), models.CreateEmailAddressRequest{Address: "ada@example.com"})
+	if len(errResp.Details) != 1 || errResp.Details[0].Field != "address" {
+		t.Fatalf("details = %+v", errResp.Details)
+	}
+
+	// A profile's id is its identity provider id, so it can't be reused
+	profile := models.CreateProfile{ID: "6f1c2a4e-9b7d-4c1a-8e2f-3a5b7c9d1e2f", Username: "ada", Email: "ada@example.com"}
+	c.expect(http.StatusCreated, nil, http.MethodPost, orgPath(acme, "/profiles"), profile)
+	c.expectError(http.StatusConflict, "conflict", http.MethodPost, orgPath(globex, "/profiles"), profile)
+
+	// Empty strings are rejected by the checks, not only by validation
+	c.expectError(http.StatusUnprocessableEntity, "validation_failed", http.MethodPatch, orgPath(acme, "/profiles/"+profile.ID), models.UpdateProfile{Username: "ada"})
+}
+
+// TestIntegrationConcurrentUpdates checks the row locks: of several updates
+// sent against the same version, exactly one wins
+func TestIntegrationConcurrentUpdates(t *testing.T) {
+	c, _ := newIntegrationClient(t)
+	org := c.createOrganization("Acme")
+
+	var template models.Template
+	c.expect(http.StatusCreated, &template, http.MethodPost, orgPath(org, "/templates"), models.CreateTemplate{Name: "Welcome", HTML: "<p>Hi</p>"})
+
+	const writers = 8
+	codes := make(chan int, writers)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := c.do(http.MethodPatch, orgPath(org, "/templates/"+template.ID), models.UpdateTemplate{Name: "Renamed"}, "If-Match", `"1"`)
+			codes <- rec.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	counts := map[int]int{}
+	for code := range codes {
+		counts[code]++
+	}
+	if counts[http.StatusOK] != 1 || counts[http.StatusPreconditionFailed] != writers-1 {
+		t.Fatalf("status counts = %v", counts)
+	}
+
+	var got models.Template
+	c.expect(http.StatusOK, &got, http.MethodGet, orgPath(org, "/templates/"+template.ID), nil)
+	if got.Version != 2 {
+		t.Fatalf("version = %d", got.Version)
+	}
+}
+
+// TestIntegrationConcurrentLaunchesShareQuota checks that launches lock the
+// organization's usage: of several launches that each fit in the quota on
+// their own, only as many as fit together go ahead
+func TestIntegrationConcurrentLaunchesShareQuota(t *testing.T) {
+	cfg := config.Default()
+	cfg.Sending.DailyRecipients = 2
+	c := &testClient{t: t, e: NewServer(testdb.New(t), cfg, nil, nil).echo}
+	org := c.createOrganization("Acme")
+
+	var email models.EmailAddress
+	c.expect(http.StatusCreated, &email, http.MethodPost, orgPath(org, "/email-addresses"), models.CreateEmailAddressRequest{Address: "ada@example.com"})
+	var group models.EmailGroup
+	c.expect(http.StatusCreated, &group, http.MethodPost, orgPath(org, "/email-groups"), models.CreateEmailGroup{Name: "Customers"})
+	c.expect(http.StatusCreated, nil, http.MethodPost, orgPath(org, "/email-group-members"), models.CreateEmailGroupMember{
+		EmailGroupID:   group.ID,
+		EmailAddressID: email.ID,
+	})
+
+	const launches = 6
+	campaigns := make([]models.Campaign, launches)
+	for i := range campaigns {
+		c.expect(http.StatusCreated, &campaigns[i], http.MethodPost, orgPath(org, "/campaigns"), models.CreateCampaign{Name: "Spring " + strconv.Itoa(i)})
+		c.expect(http.StatusOK, nil, http.MethodPatch, orgPath(org, "/campaigns/"+campaigns[i].ID), models.UpdateCampaign{
+			EmailGroups: []string{group.ID},
+		})
+	}
+
+	codes := make(chan int, launches)
+	var wg sync.WaitGroup
+	for _, campaign := range campaigns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- c.do(http.MethodPatch, orgPath(org, "/campaigns/"+campaign.ID), models.UpdateCampaign{Status: models.CampaignStatusLaunched}).Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	counts := map[int]int{}
+	for code := range codes {
+		counts[code]++
+	}
+	if counts[http.StatusOK] != 2 || counts[http.StatusUnprocessableEntity] != launches-2 {
+		t.Fatalf("status counts = %v", counts)
+	}
+
+	var usage models.SendingUsage
+	c.expect(http.StatusOK, &usage, http.MethodGet, orgPath(org, "/usage"), nil)
+	if usage.Day.Used != 2 || usage.Month.Used != 2 || *usage.Day.Remaining != 0 {
+		t.Fatalf("usage = %+v", usage)
+	}
+}
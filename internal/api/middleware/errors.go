@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/donnaloia/sendpulse/internal/services"
+	"github.com/donnaloia/sendpulse/pkg/response"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Error codes are part of the API contract; clients match on them, so they
+// must not change once published
+const (
+	CodeBadRequest         = "bad_request"
+	CodeInvalidQuery       = "invalid_query"
+	CodeUnauthorized       = "unauthorized"
+	CodeForbidden          = "forbidden"
+	CodeNotFound           = "not_found"
+	CodeMethodNotAllowed   = "method_not_allowed"
+	CodeConflict           = "conflict"
+	CodePreconditionFailed = "precondition_failed"
+	CodePreconditionNeeded = "precondition_required"
+	CodeTooManyRequests    = "too_many_requests"
+	CodeQuotaExceeded      = "quota_exceeded"
+	CodeValidationFailed   = "validation_failed"
+	CodeInternal           = "internal_error"
+	CodeServiceUnavailable = "service_unavailable"
+	CodeTimeout            = "timeout"
+)
+
+var statusCodes = map[int]string{
+	http.StatusBadRequest:           CodeBadRequest,
+	http.StatusUnauthorized:         CodeUnauthorized,
+	http.StatusForbidden:            CodeForbidden,
+	http.StatusNotFound:             CodeNotFound,
+	http.StatusMethodNotAllowed:     CodeMethodNotAllowed,
+	http.StatusConflict:             CodeConflict,
+	http.StatusPreconditionFailed:   CodePreconditionFailed,
+	http.StatusPreconditionRequired: CodePreconditionNeeded,
+	http.StatusTooManyRequests:      CodeTooManyRequests,
+	http.StatusUnprocessableEntity:  CodeValidationFailed,
+	http.StatusInternalServerError:  CodeInternal,
+	http.StatusServiceUnavailable:   CodeServiceUnavailable,
+}
+
+var kindStatus = []struct {
+	kind   error
+	status int
+	code   string
+}{
+	{services.ErrNotFound, http.StatusNotFound, CodeNotFound},
+	{services.ErrConflict, http.StatusConflict, CodeConflict},
+	{services.ErrValidation, http.StatusUnprocessableEntity, CodeValidationFailed},
+	{services.ErrForbidden, http.StatusForbidden, CodeForbidden},
+	{services.ErrPreconditionFailed, http.StatusPreconditionFailed, CodePreconditionFailed},
+	{services.ErrQuotaExceeded, http.StatusUnprocessableEntity, CodeQuotaExceeded},
+}
+
+// ErrorHandler renders every error returned by a handler or middleware as a
+// response.ErrorResponse. Domain errors from the services carry their own
+// status and code; unexpected errors are logged and reported as a bare 500
+// so database messages never reach the caller.
+func ErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	// The client has gone away; there's nobody to answer
+	if errors.Is(err, context.Canceled) {
+		slog.InfoContext(c.Request().Context(), "client went away", "error", err)
+		return
+	}
+
+	status, body := errorResponse(err)
+	body.Error.RequestID = requestID(c)
+	if status >= http.StatusInternalServerError {
+		slog.ErrorContext(c.Request().Context(), "request failed", "error", err)
+	}
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(status)
+	} else {
+		err = c.JSON(status, body)
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request().Context(), "error writing error response", "error", err)
+	}
+}
+
+func errorResponse(err error) (int, response.ErrorResponse) {
+	if domainErr, ok := services.AsError(err); ok {
+		for _, k := range kindStatus {
+			if errors.Is(domainErr.Kind, k.kind) {
+				return k.status, response.NewError(k.code, domainErr.Message, "", fieldErrors(domainErr.Details)...)
+			}
+		}
+	}
+
+	if services.IsTimeout(err) {
+		return http.StatusServiceUnavailable, response.NewError(CodeTimeout, "the request took too long; try again", "")
+	}
+
+	if errors.Is(err, services.ErrInvalidQuery) {
+		return http.StatusBadRequest, response.NewError(CodeInvalidQuery, err.Error(), "")
+	}
+
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		message := http.StatusText(he.Code)
+		if m, ok := he.Message.(string); ok && he.Code != http.StatusInternalServerError {
+			message = m
+		}
+		return he.Code, response.NewError(statusCode(he.Code), message, "")
+	}
+
+	return http.StatusInternalServerError, response.NewError(CodeInternal, "internal server error", "")
+}
+
+func statusCode(status int) string {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	// e.g. 413 -> "request_entity_too_large"
+	text := http.StatusText(status)
+	if text == "" {
+		return fmt.Sprintf("http_%d", status)
+	}
+	return strings.ReplaceAll(strings.ToLower(text), " ", "_")
+}
+
+func fieldErrors(details []services.FieldError) []response.FieldError {
+	if len(details) == 0 {
+		return nil
+	}
+	out := make([]response.FieldError, len(details))
+	for i, d := range details {
+		out[i] = response.FieldError{Field: d.Field, Message: d.Message}
+	}
+	return out
+}
+
+// requestID is the ID assigned by the RequestLogger middleware, or the one
+// the caller sent
+func requestID(c echo.Context) string {
+	if id := c.Response().Header().Get(echo.HeaderXRequestID); id != "" {
+		return id
+	}
+	return c.Request().Header.Get(echo.HeaderXRequestID)
+}
@@ -1,13 +1,76 @@
 package middleware
 
 import (
+	"log/slog"
+	"time"
+
+	"github.com/donnaloia/sendpulse/internal/api/validation"
+	"github.com/donnaloia/sendpulse/internal/auth"
+	"github.com/donnaloia/sendpulse/internal/idempotency"
+	"github.com/donnaloia/sendpulse/internal/metrics"
+	"github.com/donnaloia/sendpulse/internal/ratelimit"
+
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/labstack/echo/otelecho"
 )
 
-func Setup(e *echo.Echo) {
-	e.Use(middleware.Logger())
-	e.Use(middleware.Recover())
-	e.Use(middleware.CORS())
-	//e.Use(auth.Middleware())
+// serverName identifies the API in its spans
+const serverName = "sendpulse"
+
+// BodyLimit caps request bodies. It leaves room for a template at
+// models.MaxTemplateHTMLBytes once JSON-escaped.
+const BodyLimit = "2M"
+
+// Setup installs the global middleware and error handler. Auth is only
+// installed when an authenticator is provided, and rate limiting when it's
+// enabled.
+func Setup(e *echo.Echo, requestTimeout time.Duration, authenticator *auth.Authenticator, rateLimit *ratelimit.Config, idempotencyStore idempotency.Store) {
+	e.HTTPErrorHandler = ErrorHandler
+	e.Validator = validation.New()
+	e.Use(metrics.Middleware())
+	// Scraped and polled too often to be worth tracing
+	e.Use(otelecho.Middleware(serverName, otelecho.WithSkipper(isProbe)))
+	e.Use(RequestLogger())
+	e.Use(middleware.RecoverWithConfig(middleware.RecoverConfig{
+		LogErrorFunc: func(c echo.Context, err error, stack []byte) error {
+			slog.ErrorContext(c.Request().Context(), "panic handling request", "error", err, "stack", string(stack))
+			return err
+		},
+	}))
+	e.Use(RequestTimeout(requestTimeout))
+	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
+		// Let browser clients read the headers they need for retries and
+		// conditional requests
+		ExposeHeaders: []string{
+			echo.HeaderXRequestID, "ETag", idempotency.ReplayedHeader,
+			ratelimit.HeaderLimit, ratelimit.HeaderRemaining, ratelimit.HeaderReset, echo.HeaderRetryAfter,
+		},
+	}))
+	e.Use(middleware.BodyLimit(BodyLimit))
+	limits := ratelimit.NewMemoryStore()
+	if rateLimit.Enabled {
+		// Ahead of auth, so floods with bad credentials don't each get
+		// checked
+		e.Use(ratelimit.IPMiddleware(rateLimit, limits, isProbe))
+	}
+	if authenticator != nil {
+		e.Use(authenticator.Middleware())
+		e.Use(LogOrganization())
+	}
+	e.Use(validation.PathParams())
+	if rateLimit.Enabled {
+		e.Use(ratelimit.Middleware(rateLimit, limits))
+	}
+	e.Use(idempotency.Middleware(idempotencyStore, requestTimeout))
+}
+
+// isProbe reports whether the request is from monitoring rather than a
+// client
+func isProbe(c echo.Context) bool {
+	switch c.Path() {
+	case "/metrics", "/health", "/livez", "/readyz":
+		return true
+	}
+	return false
 }
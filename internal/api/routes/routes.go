@@ -2,6 +2,7 @@ package routes
 
 import (
 	"github.com/donnaloia/sendpulse/internal/api/handlers"
+	"github.com/donnaloia/sendpulse/internal/metrics"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -13,10 +14,16 @@ func Setup(e *echo.Echo) {
 
 	// Health routes
 	e.GET("/health", handlers.HealthCheck)
+	e.GET("/livez", handlers.Livez)
+	e.GET("/readyz", handlers.Readyz)
+	e.GET("/metrics", echo.WrapHandler(metrics.Handler()))
 
 	// API group
 	api := e.Group("/api/v1")
 
+	// Caller routes
+	api.GET("/me/permissions", handlers.MyPermissions)
+
 	// Organization as the base route
 	organizations := api.Group("/organizations")
 	organizations.GET("", handlers.Organizations.List)
@@ -50,6 +57,7 @@ func Setup(e *echo.Echo) {
 	emailGroupMembers.GET("", handlers.EmailGroupMembers.List)
 	emailGroupMembers.GET("/:id", handlers.EmailGroupMembers.Get)
 	emailGroupMembers.POST("", handlers.EmailGroupMembers.Create)
+	emailGroupMembers.DELETE("/:id", handlers.EmailGroupMembers.Delete)
 
 	// Campaign Routes
 	campaigns := org.Group("/campaigns")
@@ -63,4 +71,18 @@ func Setup(e *echo.Echo) {
 	templates.GET("", handlers.Templates.List)
 	templates.GET("/:id", handlers.Templates.Get)
 	templates.POST("", handlers.Templates.Create)
+	templates.PATCH("/:id", handlers.Templates.Update)
+
+	// API Key Routes
+	apiKeys := org.Group("/api-keys")
+	apiKeys.GET("", handlers.APIKeys.List)
+	apiKeys.GET("/:id", handlers.APIKeys.Get)
+	apiKeys.POST("", handlers.APIKeys.Create)
+	apiKeys.DELETE("/:id", handlers.APIKeys.Revoke)
+
+	// Audit Log Routes
+	org.GET("/audit-log", handlers.AuditLog.List)
+
+	// Sending Usage Routes
+	org.GET("/usage", handlers.Usage.Get)
 }
@@ -1,12 +1,23 @@
 package api
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
 
 	"github.com/donnaloia/sendpulse/internal/api/handlers"
 	"github.com/donnaloia/sendpulse/internal/api/middleware"
 	"github.com/donnaloia/sendpulse/internal/api/routes"
+	"github.com/donnaloia/sendpulse/internal/auth"
+	"github.com/donnaloia/sendpulse/internal/config"
+	"github.com/donnaloia/sendpulse/internal/health"
+	"github.com/donnaloia/sendpulse/internal/idempotency"
+	"github.com/donnaloia/sendpulse/internal/metrics"
+	"github.com/donnaloia/sendpulse/internal/services"
 
 	"github.com/labstack/echo/v4"
 )
@@ -16,28 +27,31 @@ type Server struct {
 	db   *sql.DB
 }
 
-func NewServer(db *sql.DB) *Server {
-	e := echo.New()
-
+// NewServer builds the API on db. relay may be nil, which leaves campaign
+// launches unannounced, and so may readiness, which leaves /readyz checking
+// nothing.
+func NewServer(db *sql.DB, cfg *config.Config, relay *services.OutboxRelay, readiness *health.Checker) *Server {
 	// Verify db connection
 	if err := db.Ping(); err != nil {
 		panic(fmt.Sprintf("Database connection failed: %v", err))
 	}
 
-	// Initialize handlers with database connection
-	handlers.InitEmails(db)
-	handlers.InitEmailGroups(db)
-	handlers.InitCampaigns(db)
-	handlers.InitEmailGroupMembers(db)
-	handlers.InitOrganizations(db)
-	handlers.InitProfiles(db)
-	handlers.InitTemplates(db)
+	store := services.NewPostgresStore(db)
+	store.SetSlowQueryThreshold(cfg.Database.SlowQueryThreshold)
 
-	// Add middleware
-	middleware.Setup(e)
+	// Build the authenticator when auth is enabled
+	var authenticator *auth.Authenticator
+	if cfg.Auth.Enabled {
+		a, err := auth.New(&cfg.Auth)
+		if err != nil {
+			panic(fmt.Sprintf("Auth configuration failed: %v", err))
+		}
+		a.SetAPIKeyVerifier(apiKeyVerifier(services.NewAPIKeyService(store)))
+		metrics.SetPermissionCache(a)
+		authenticator = a
+	}
 
-	// Setup routes
-	routes.Setup(e)
+	e := newEcho(cfg, store, authenticator, idempotency.NewPostgresStore(db), relay, readiness)
 
 	return &Server{
 		echo: e,
@@ -45,6 +59,104 @@ func NewServer(db *sql.DB) *Server {
 	}
 }
 
+// newEcho builds the application on top of store. authenticator may be nil,
+// which leaves every route open.
+func newEcho(cfg *config.Config, store services.Store, authenticator *auth.Authenticator, idempotencyStore idempotency.Store, relay *services.OutboxRelay, readiness *health.Checker) *echo.Echo {
+	e := echo.New()
+	// Requests are logged by middleware.RequestLogger; the server logs its
+	// own start
+	e.HideBanner = true
+	e.HidePort = true
+	// Client addresses are recorded in the audit log, so they're only taken
+	// from X-Forwarded-For when it was set by a trusted proxy
+	e.IPExtractor = ipExtractor(cfg.HTTP.TrustedProxies)
+
+	handlers.Configure(&handlers.Config{
+		RequireIfMatch: cfg.Features.RequireIfMatch,
+	})
+
+	// Initialize handlers with the store
+	handlers.InitEmails(store)
+	handlers.InitEmailGroups(store)
+	handlers.InitCampaigns(store, relay, &cfg.Sending)
+	handlers.InitEmailGroupMembers(store)
+	handlers.InitOrganizations(store)
+	handlers.InitProfiles(store)
+	handlers.InitTemplates(store)
+	handlers.InitAPIKeys(store)
+	handlers.InitAuditLog(store)
+	handlers.InitUsage(store, &cfg.Sending)
+	handlers.InitHealth(readiness)
+
+	// Add middleware
+	middleware.Setup(e, cfg.HTTP.RequestTimeout, authenticator, &cfg.RateLimit, idempotencyStore)
+
+	// Setup routes
+	routes.Setup(e)
+
+	// Every route must be public or have a permission mapping
+	if err := auth.ValidateRoutes(e.Routes()); err != nil {
+		panic(fmt.Sprintf("Route permission check failed: %v", err))
+	}
+
+	return e
+}
+
+// ipExtractor reads the client address from X-Forwarded-For, trusting only
+// the proxies in cidrs, or from the connection when there are none
+func ipExtractor(cidrs []string) echo.IPExtractor {
+	if len(cidrs) == 0 {
+		return echo.ExtractIPDirect()
+	}
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, cidr := range cidrs {
+		// Checked by config.Validate
+		if _, ipNet, err := net.ParseCIDR(cidr); err == nil {
+			options = append(options, echo.TrustIPRange(ipNet))
+		}
+	}
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
+// Start serves on addr until Shutdown is called, when it returns nil
 func (s *Server) Start(addr string) error {
-	return s.echo.Start(addr)
+	slog.Info("http server starting", "addr", addr)
+	if err := s.echo.Start(addr); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests to
+// finish. Requests still running at ctx's deadline have their connections
+// closed.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if err := s.echo.Shutdown(ctx); err != nil {
+		s.echo.Close()
+		return fmt.Errorf("requests still in flight: %w", err)
+	}
+	return nil
+}
+
+// apiKeyVerifier lets the auth middleware authenticate organization API keys
+func apiKeyVerifier(s *services.APIKeyService) auth.APIKeyVerifier {
+	return auth.APIKeyVerifierFunc(func(ctx context.Context, plaintext string) (*auth.Principal, error) {
+		key, err := s.Authenticate(ctx, plaintext)
+		if err != nil {
+			return nil, err
+		}
+		principal := &auth.Principal{
+			Subject:        key.ID,
+			OrganizationID: key.OrganizationID,
+			Permissions:    key.Permissions,
+		}
+		if key.ExpiresAt != nil {
+			principal.ExpiresAt = *key.ExpiresAt
+		}
+		return principal, nil
+	})
 }
@@ -0,0 +1,867 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/donnaloia/sendpulse/internal/auth"
+	"github.com/donnaloia/sendpulse/internal/config"
+	"github.com/donnaloia/sendpulse/internal/events"
+	"github.com/donnaloia/sendpulse/internal/health"
+	"github.com/donnaloia/sendpulse/internal/idempotency"
+	"github.com/donnaloia/sendpulse/internal/models"
+	"github.com/donnaloia/sendpulse/internal/ratelimit"
+	"github.com/donnaloia/sendpulse/internal/services"
+	"github.com/donnaloia/sendpulse/pkg/response"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// testClient sends requests to the application built on an in-memory store
+type testClient struct {
+	t       *testing.T
+	e       *echo.Echo
+	headers map[string]string
+}
+
+// newTestApp builds the application the endpoint tests run against, with
+// auth disabled. The integration build runs them against Postgres instead.
+var newTestApp = func(t *testing.T) *echo.Echo {
+	return newEcho(config.Default(), services.NewMemoryStore(), nil, idempotency.NewMemoryStore(), nil, nil)
+}
+
+func newTestClient(t *testing.T) *testClient {
+	t.Helper()
+	return &testClient{t: t, e: newTestApp(t)}
+}
+
+func (c *testClient) do(method, path string, body any, headers ...string) *httptest.ResponseRecorder {
+	c.t.Helper()
+
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	rec := httptest.NewRecorder()
+	c.e.ServeHTTP(rec, req)
+	return rec
+}
+
+// expect sends the request, checks the status and decodes the body into out
+func (c *testClient) expect(status int, out any, method, path string, body any, headers ...string) *httptest.ResponseRecorder {
+	c.t.Helper()
+	rec := c.do(method, path, body, headers...)
+	if rec.Code != status {
+		c.t.Fatalf("%s %s: status %d, want %d: %s", method, path, rec.Code, status, rec.Body.String())
+	}
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			c.t.Fatalf("%s %s: decoding response: %v", method, path, err)
+		}
+	}
+	return rec
+}
+
+// expectError checks the status and error code of a failed request
+func (c *testClient) expectError(status int, code string, method, path string, body any, headers ...string) response.Error {
+	c.t.Helper()
+	var resp response.ErrorResponse
+	c.expect(status, &resp, method, path, body, headers...)
+	if resp.Error.Code != code {
+		c.t.Fatalf("%s %s: error code %q, want %q", method, path, resp.Error.Code, code)
+	}
+	return resp.Error
+}
+
+func (c *testClient) createOrganization(name string) models.Organization {
+	c.t.Helper()
+	var org models.Organization
+	c.expect(http.StatusCreated, &org, http.MethodPost, "/api/v1/organizations", models.CreateOrganization{Name: name})
+	return org
+}
+
+func orgPath(org models.Organization, rest string) string {
+	return "/api/v1/organizations/" + org.ID + rest
+}
+
+func TestHealth(t *testing.T) {
+	c := newTestClient(t)
+	var resp response.Response
+	c.expect(http.StatusOK, &resp, http.MethodGet, "/health", nil)
+	if resp.Status != "success" {
+		t.Fatalf("status = %q", resp.Status)
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	c := newTestClient(t)
+	c.expect(http.StatusOK, nil, http.MethodGet, "/livez", nil)
+
+	var report health.Report
+	c.expect(http.StatusOK, &report, http.MethodGet, "/readyz", nil)
+	if report.Status != health.StatusReady {
+		t.Fatalf("report = %+v", report)
+	}
+
+	checker := health.NewChecker(time.Second, 0)
+	checker.Add("database", func(ctx context.Context) error { return nil })
+	checker.Add("kafka", func(ctx context.Context) error { return errors.New("no brokers") })
+	c = &testClient{t: t, e: newEcho(config.Default(), services.NewMemoryStore(), nil, idempotency.NewMemoryStore(), nil, checker)}
+	rec := c.expect(http.StatusServiceUnavailable, &report, http.MethodGet, "/readyz", nil)
+	if report.Status != health.StatusNotReady || report.Components["database"].Status != health.ComponentOK || report.Components["kafka"].Status != health.ComponentFailing {
+		t.Fatalf("report = %+v", report)
+	}
+	// Why a check failed is only logged
+	if strings.Contains(rec.Body.String(), "no brokers") {
+		t.Fatalf("body = %s", rec.Body)
+	}
+	// A failing dependency doesn't make the process unhealthy
+	c.expect(http.StatusOK, nil, http.MethodGet, "/livez", nil)
+}
+
+func TestRateLimit(t *testing.T) {
+	cfg := config.Default()
+	cfg.RateLimit.Plans["standard"] = ratelimit.Plan{Organization: ratelimit.Limit{RequestsPerSecond: 0.001, Burst: 2}}
+	c := &testClient{t: t, e: newEcho(cfg, services.NewMemoryStore(), nil, idempotency.NewMemoryStore(), nil, nil)}
+	// Creating organizations isn't tied to one, so isn't limited
+	org := c.createOrganization("Acme")
+	other := c.createOrganization("Globex")
+
+	rec := c.expect(http.StatusOK, nil, http.MethodGet, orgPath(org, "/templates"), nil)
+	if rec.Header().Get("RateLimit-Limit") != "2" || rec.Header().Get("RateLimit-Remaining") != "1" {
+		t.Fatalf("headers = %v", rec.Header())
+	}
+	c.expect(http.StatusOK, nil, http.MethodGet, orgPath(org, "/campaigns"), nil)
+	c.expectError(http.StatusTooManyRequests, "too_many_requests", http.MethodGet, orgPath(org, "/templates"), nil)
+	rec = c.do(http.MethodGet, orgPath(org, "/templates"), nil)
+	if rec.Header().Get("Retry-After") == "" || rec.Header().Get("RateLimit-Remaining") != "0" {
+		t.Fatalf("headers = %v", rec.Header())
+	}
+
+	// Other organizations aren't held up
+	c.expect(http.StatusOK, nil, http.MethodGet, orgPath(other, "/templates"), nil)
+}
+
+func TestRequestID(t *testing.T) {
+	c := newTestClient(t)
+
+	rec := c.do(http.MethodGet, "/health", nil, echo.HeaderXRequestID, "upstream-42")
+	if got := rec.Header().Get(echo.HeaderXRequestID); got != "upstream-42" {
+		t.Fatalf("X-Request-ID = %q", got)
+	}
+
+	// IDs that aren't safe to log are replaced
+	rec = c.do(http.MethodGet, "/health", nil, echo.HeaderXRequestID, "bad id\nINFO forged")
+	if got := rec.Header().Get(echo.HeaderXRequestID); len(got) != 32 {
+		t.Fatalf("X-Request-ID = %q", got)
+	}
+
+	rec = c.do(http.MethodGet, "/api/v1/organizations/00000000-0000-0000-0000-000000000000", nil)
+	var resp response.ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if id := rec.Header().Get(echo.HeaderXRequestID); id == "" || resp.Error.RequestID != id {
+		t.Fatalf("header %q, error body %+v", id, resp.Error)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	c := newTestClient(t)
+	org := c.createOrganization("Acme")
+	c.expect(http.StatusOK, nil, http.MethodGet, "/api/v1/organizations/"+org.ID, nil)
+	c.expectError(http.StatusNotFound, "not_found", http.MethodGet, "/api/v1/organizations/00000000-0000-0000-0000-000000000000", nil)
+
+	rec := c.expect(http.StatusOK, nil, http.MethodGet, "/metrics", nil)
+	// Requests are labelled by route pattern, with the status the error
+	// handler answered with
+	for _, series := range []string{
+		`sendpulse_http_request_duration_seconds_count{method="GET",route="/api/v1/organizations/:id",status="200"}`,
+		`sendpulse_http_request_duration_seconds_count{method="GET",route="/api/v1/organizations/:id",status="404"}`,
+		`sendpulse_imports_processed_total{outcome="failed"} 0`,
+		`sendpulse_campaigns_launched_total`,
+	} {
+		if !strings.Contains(rec.Body.String(), series) {
+			t.Errorf("%s missing from:\n%s", series, rec.Body.String())
+		}
+	}
+}
+
+func TestOrganizations(t *testing.T) {
+	c := newTestClient(t)
+	org := c.createOrganization("Acme")
+
+	var got models.Organization
+	c.expect(http.StatusOK, &got, http.MethodGet, "/api/v1/organizations/"+org.ID, nil)
+	if got.Name != "Acme" {
+		t.Fatalf("name = %q", got.Name)
+	}
+
+	c.createOrganization("Globex")
+	var list models.PaginatedResponse[models.Organization]
+	c.expect(http.StatusOK, &list, http.MethodGet, "/api/v1/organizations", nil)
+	// Newest first
+	if len(list.Results) != 2 || list.Results[0].Name != "Globex" || list.Results[1].Name != "Acme" {
+		t.Fatalf("results = %+v", list.Results)
+	}
+
+	c.expectError(http.StatusConflict, "conflict", http.MethodPost, "/api/v1/organizations", models.CreateOrganization{Name: "Acme"})
+	c.expectError(http.StatusUnprocessableEntity, "validation_failed", http.MethodPost, "/api/v1/organizations", models.CreateOrganization{})
+	c.expectError(http.StatusNotFound, "not_found", http.MethodGet, "/api/v1/organizations/00000000-0000-4000-8000-000000000000", nil)
+	c.expectError(http.StatusUnprocessableEntity, "validation_failed", http.MethodGet, "/api/v1/organizations/not-a-uuid", nil)
+}
+
+func TestProfiles(t *testing.T) {
+	c := newTestClient(t)
+	org := c.createOrganization("Acme")
+
+	bio := "Hello"
+	var profile models.Profile
+	c.expect(http.StatusCreated, &profile, http.MethodPost, orgPath(org, "/profiles"), models.CreateProfile{
+		ID:       "6f1c2a4e-9b7d-4c1a-8e2f-3a5b7c9d1e2f",
+		Username: "ada",
+		Email:    "ada@example.com",
+		Bio:      &bio,
+	})
+	if profile.OrganizationID != org.ID || profile.Bio == nil || *profile.Bio != bio {
+		t.Fatalf("profile = %+v", profile)
+	}
+
+	var got models.Profile
+	c.expect(http.StatusOK, &got, http.MethodGet, orgPath(org, "/profiles/"+profile.ID), nil)
+	if got.Username != "ada" {
+		t.Fatalf("username = %q", got.Username)
+	}
+
+	// A profile update replaces every field
+	var updated models.Profile
+	c.expect(http.StatusOK, &updated, http.MethodPatch, orgPath(org, "/profiles/"+profile.ID), models.UpdateProfile{Username: "lovelace", Email: "ada@example.com"})
+	if updated.Username != "lovelace" || updated.Email != "ada@example.com" || updated.Bio != nil {
+		t.Fatalf("updated = %+v", updated)
+	}
+
+	var list models.PaginatedResponse[models.Profile]
+	c.expect(http.StatusOK, &list, http.MethodGet, orgPath(org, "/profiles"), nil)
+	if len(list.Results) != 1 {
+		t.Fatalf("results = %+v", list.Results)
+	}
+
+	// Profiles are scoped to their organization
+	other := c.createOrganization("Globex")
+	c.expectError(http.StatusNotFound, "not_found", http.MethodGet, orgPath(other, "/profiles/"+profile.ID), nil)
+}
+
+func TestEmailAddresses(t *testing.T) {
+	c := newTestClient(t)
+	org := c.createOrganization("Acme")
+
+	var email models.EmailAddress
+	c.expect(http.StatusCreated, &email, http.MethodPost, orgPath(org, "/email-addresses"), models.CreateEmailAddressRequest{Address: "ada@example.com"})
+
+	var got models.EmailAddress
+	c.expect(http.StatusOK, &got, http.MethodGet, orgPath(org, "/email-addresses/"+email.ID), nil)
+	if got.Address != "ada@example.com" || got.OrganizationID != org.ID {
+		t.Fatalf("email = %+v", got)
+	}
+
+	c.expect(http.StatusCreated, nil, http.MethodPost, orgPath(org, "/email-addresses"), models.CreateEmailAddressRequest{Address: "grace@example.com"})
+	var list models.PaginatedResponse[models.EmailAddress]
+	c.expect(http.StatusOK, &list, http.MethodGet, orgPath(org, "/email-addresses?q=grace"), nil)
+	if len(list.Results) != 1 || list.Results[0].Address != "grace@example.com" {
+		t.Fatalf("results = %+v", list.Results)
+	}
+
+	c.expectError(http.StatusConflict, "conflict", http.MethodPost, orgPath(org, "/email-addresses"), models.CreateEmailAddressRequest{Address: "ada@example.com"})
+	c.expectError(http.StatusUnprocessableEntity, "validation_failed", http.MethodPost, orgPath(org, "/email-addresses"), models.CreateEmailAddressRequest{Address: "not an email"})
+}
+
+func TestEmailGroupsAndMembers(t *testing.T) {
+	c := newTestClient(t)
+	org := c.createOrganization("Acme")
+
+	var group models.EmailGroup
+	c.expect(http.StatusCreated, &group, http.MethodPost, orgPath(org, "/email-groups"), models.CreateEmailGroup{Name: "Customers"})
+
+	var got models.EmailGroup
+	c.expect(http.StatusOK, &got, http.MethodGet, orgPath(org, "/email-groups/"+group.ID), nil)
+	if got.Name != "Customers" {
+		t.Fatalf("group = %+v", got)
+	}
+
+	var groups models.PaginatedResponse[models.EmailGroup]
+	c.expect(http.StatusOK, &groups, http.MethodGet, orgPath(org, "/email-groups"), nil)
+	if len(groups.Results) != 1 {
+		t.Fatalf("results = %+v", groups.Results)
+	}
+
+	var email models.EmailAddress
+	c.expect(http.StatusCreated, &email, http.MethodPost, orgPath(org, "/email-addresses"), models.CreateEmailAddressRequest{Address: "ada@example.com"})
+
+	var member models.EmailGroupMember
+	c.expect(http.StatusCreated, &member, http.MethodPost, orgPath(org, "/email-group-members"), models.CreateEmailGroupMember{
+		EmailGroupID:   group.ID,
+		EmailAddressID: email.ID,
+	})
+
+	var gotMember models.EmailGroupMember
+	c.expect(http.StatusOK, &gotMember, http.MethodGet, orgPath(org, "/email-group-members/"+member.ID), nil)
+	if gotMember.EmailGroupID != group.ID || gotMember.EmailAddressID != email.ID {
+		t.Fatalf("member = %+v", gotMember)
+	}
+
+	var members models.PaginatedResponse[models.EmailGroupMember]
+	c.expect(http.StatusOK, &members, http.MethodGet, orgPath(org, "/email-group-members"), nil)
+	if len(members.Results) != 1 {
+		t.Fatalf("results = %+v", members.Results)
+	}
+
+	c.expectError(http.StatusConflict, "conflict", http.MethodPost, orgPath(org, "/email-group-members"), models.CreateEmailGroupMember{
+		EmailGroupID:   group.ID,
+		EmailAddressID: email.ID,
+	})
+
+	// Members of another organization's groups are invisible
+	other := c.createOrganization("Globex")
+	c.expectError(http.StatusNotFound, "not_found", http.MethodGet, orgPath(other, "/email-group-members/"+member.ID), nil)
+	c.expect(http.StatusOK, &members, http.MethodGet, orgPath(other, "/email-group-members"), nil)
+	if len(members.Results) != 0 {
+		t.Fatalf("other organization sees %+v", members.Results)
+	}
+	c.expectError(http.StatusNotFound, "not_found", http.MethodDelete, orgPath(other, "/email-group-members/"+member.ID), nil)
+	c.expectError(http.StatusUnprocessableEntity, "validation_failed", http.MethodPost, orgPath(other, "/email-group-members"), models.CreateEmailGroupMember{
+		EmailGroupID:   group.ID,
+		EmailAddressID: email.ID,
+	})
+
+	c.expect(http.StatusNoContent, nil, http.MethodDelete, orgPath(org, "/email-group-members/"+member.ID), nil)
+	c.expectError(http.StatusNotFound, "not_found", http.MethodGet, orgPath(org, "/email-group-members/"+member.ID), nil)
+}
+
+func TestTemplates(t *testing.T) {
+	c := newTestClient(t)
+	org := c.createOrganization("Acme")
+
+	var template models.Template
+	c.expect(http.StatusCreated, &template, http.MethodPost, orgPath(org, "/templates"), models.CreateTemplate{Name: "Welcome", HTML: "<p>Hi</p>"})
+	if template.Version != 1 {
+		t.Fatalf("version = %d", template.Version)
+	}
+
+	rec := c.expect(http.StatusOK, nil, http.MethodGet, orgPath(org, "/templates/"+template.ID), nil)
+	tag := rec.Header().Get("ETag")
+	if tag != `"1"` {
+		t.Fatalf("ETag = %q", tag)
+	}
+	c.expect(http.StatusNotModified, nil, http.MethodGet, orgPath(org, "/templates/"+template.ID), nil, "If-None-Match", tag)
+
+	var updated models.Template
+	c.expect(http.StatusOK, &updated, http.MethodPatch, orgPath(org, "/templates/"+template.ID), models.UpdateTemplate{HTML: "<p>Hello</p>"}, "If-Match", tag)
+	if updated.Version != 2 || updated.HTML != "<p>Hello</p>" || updated.Name != "Welcome" {
+		t.Fatalf("updated = %+v", updated)
+	}
+
+	// The old ETag is stale now
+	c.expectError(http.StatusPreconditionFailed, "precondition_failed", http.MethodPatch, orgPath(org, "/templates/"+template.ID), models.UpdateTemplate{Name: "Stale"}, "If-Match", tag)
+
+	var list models.PaginatedResponse[models.Template]
+	c.expect(http.StatusOK, &list, http.MethodGet, orgPath(org, "/templates?name=Welcome"), nil)
+	if len(list.Results) != 1 {
+		t.Fatalf("results = %+v", list.Results)
+	}
+}
+
+func TestCampaigns(t *testing.T) {
+	c := newTestClient(t)
+	org := c.createOrganization("Acme")
+
+	var template models.Template
+	c.expect(http.StatusCreated, &template, http.MethodPost, orgPath(org, "/templates"), models.CreateTemplate{Name: "Welcome", HTML: "<p>Hi</p>"})
+	var group models.EmailGroup
+	c.expect(http.StatusCreated, &group, http.MethodPost, orgPath(org, "/email-groups"), models.CreateEmailGroup{Name: "Customers"})
+
+	var campaign models.Campaign
+	c.expect(http.StatusCreated, &campaign, http.MethodPost, orgPath(org, "/campaigns"), models.CreateCampaign{Name: "Spring"})
+	if campaign.Status != models.CampaignStatusDraft {
+		t.Fatalf("status = %q", campaign.Status)
+	}
+
+	var updated models.Campaign
+	c.expect(http.StatusOK, &updated, http.MethodPatch, orgPath(org, "/campaigns/"+campaign.ID), models.UpdateCampaign{
+		Templates:   []string{template.ID},
+		EmailGroups: []string{group.ID},
+	})
+	if len(updated.Templates) != 1 || updated.Templates[0].ID != template.ID || len(updated.EmailGroups) != 1 || updated.EmailGroups[0].ID != group.ID {
+		t.Fatalf("updated = %+v", updated)
+	}
+
+	var got models.Campaign
+	c.expect(http.StatusOK, &got, http.MethodGet, orgPath(org, "/campaigns/"+campaign.ID), nil)
+	if got.Version != updated.Version || len(got.Templates) != 1 {
+		t.Fatalf("campaign = %+v", got)
+	}
+
+	// Another organization's template can't be linked
+	other := c.createOrganization("Globex")
+	var otherTemplate models.Template
+	c.expect(http.StatusCreated, &otherTemplate, http.MethodPost, orgPath(other, "/templates"), models.CreateTemplate{Name: "Theirs", HTML: "<p>Hi</p>"})
+	errResp := c.expectError(http.StatusUnprocessableEntity, "validation_failed", http.MethodPatch, orgPath(org, "/campaigns/"+campaign.ID), models.UpdateCampaign{
+		Templates: []string{otherTemplate.ID},
+	})
+	if len(errResp.Details) != 1 || errResp.Details[0].Field != "templates" {
+		t.Fatalf("details = %+v", errResp.Details)
+	}
+
+	var launched models.Campaign
+	c.expect(http.StatusOK, &launched, http.MethodPatch, orgPath(org, "/campaigns/"+campaign.ID), models.UpdateCampaign{Status: models.CampaignStatusLaunched})
+	if launched.Status != models.CampaignStatusLaunched {
+		t.Fatalf("status = %q", launched.Status)
+	}
+	c.expectError(http.StatusConflict, "conflict", http.MethodPatch, orgPath(org, "/campaigns/"+campaign.ID), models.UpdateCampaign{Status: models.CampaignStatusLaunched})
+
+	var list models.PaginatedResponse[models.Campaign]
+	c.expect(http.StatusOK, &list, http.MethodGet, orgPath(org, "/campaigns?status=launched"), nil)
+	if len(list.Results) != 1 || list.Results[0].ID != campaign.ID {
+		t.Fatalf("results = %+v", list.Results)
+	}
+}
+
+// recordingPublisher keeps the events it's given, or fails with err
+type recordingPublisher struct {
+	launched []events.CampaignLaunchedEvent
+	err      error
+}
+
+func (p *recordingPublisher) PublishCampaignLaunched(ctx context.Context, event events.CampaignLaunchedEvent) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.launched = append(p.launched, event)
+	return nil
+}
+
+// newRelayClient returns a client whose launches are published to the
+// returned publisher when the relay runs
+func newRelayClient(t *testing.T, cfg *config.Config) (*testClient, *services.OutboxRelay, *recordingPublisher) {
+	store := services.NewMemoryStore()
+	publisher := &recordingPublisher{}
+	relay := services.NewOutboxRelay(store, publisher)
+	return &testClient{t: t, e: newEcho(cfg, store, nil, idempotency.NewMemoryStore(), relay, nil)}, relay, publisher
+}
+
+// publishDue runs the relay as of at, expecting it to publish n events
+func publishDue(t *testing.T, relay *services.OutboxRelay, at time.Time, n int) {
+	t.Helper()
+	published, err := relay.PublishDue(context.Background(), at)
+	if err != nil || published != n {
+		t.Fatalf("published %d events: %v", published, err)
+	}
+}
+
+func TestCampaignLaunchPublishesEvent(t *testing.T) {
+	c, relay, publisher := newRelayClient(t, config.Default())
+	org := c.createOrganization("Acme")
+
+	var group models.EmailGroup
+	c.expect(http.StatusCreated, &group, http.MethodPost, orgPath(org, "/email-groups"), models.CreateEmailGroup{Name: "Customers"})
+	for _, address := range []string{"grace@example.com", "ada@example.com"} {
+		var email models.EmailAddress
+		c.expect(http.StatusCreated, &email, http.MethodPost, orgPath(org, "/email-addresses"), models.CreateEmailAddressRequest{Address: address})
+		c.expect(http.StatusCreated, nil, http.MethodPost, orgPath(org, "/email-group-members"), models.CreateEmailGroupMember{
+			EmailGroupID:   group.ID,
+			EmailAddressID: email.ID,
+		})
+	}
+	var template models.Template
+	c.expect(http.StatusCreated, &template, http.MethodPost, orgPath(org, "/templates"), models.CreateTemplate{Name: "Welcome", HTML: "<p>Hi</p>"})
+	var campaign models.Campaign
+	c.expect(http.StatusCreated, &campaign, http.MethodPost, orgPath(org, "/campaigns"), models.CreateCampaign{Name: "Spring"})
+	c.expect(http.StatusOK, nil, http.MethodPatch, orgPath(org, "/campaigns/"+campaign.ID), models.UpdateCampaign{
+		Templates:   []string{template.ID},
+		EmailGroups: []string{group.ID},
+	})
+	if len(publisher.launched) != 0 {
+		t.Fatalf("published before launch: %+v", publisher.launched)
+	}
+
+	publishDue(t, relay, time.Now(), 0)
+
+	// The launch stands while the brokers are down, and is published once
+	// they're back
+	publisher.err = errors.New("no brokers")
+	c.expect(http.StatusOK, nil, http.MethodPatch, orgPath(org, "/campaigns/"+campaign.ID), models.UpdateCampaign{Status: models.CampaignStatusLaunched})
+	c.expectError(http.StatusConflict, "conflict", http.MethodPatch, orgPath(org, "/campaigns/"+campaign.ID), models.UpdateCampaign{Status: models.CampaignStatusLaunched})
+	if n, err := relay.PublishDue(context.Background(), time.Now()); n != 0 || err == nil {
+		t.Fatalf("published %d events: %v", n, err)
+	}
+	publisher.err = nil
+	publishDue(t, relay, time.Now(), 1)
+	publishDue(t, relay, time.Now(), 0)
+
+	if len(publisher.launched) != 1 {
+		t.Fatalf("published %d events", len(publisher.launched))
+	}
+	event := publisher.launched[0]
+	if event.CampaignID != campaign.ID || event.OrganizationID != org.ID {
+		t.Fatalf("event = %+v", event)
+	}
+	if len(event.EmailAddresses) != 2 || event.EmailAddresses[0] != "ada@example.com" || len(event.TemplateIDs) != 1 || event.TemplateIDs[0] != template.ID {
+		t.Fatalf("event = %+v", event)
+	}
+}
+
+func TestRetriedLaunchIsReplayed(t *testing.T) {
+	c, relay, publisher := newRelayClient(t, config.Default())
+	org := c.createOrganization("Acme")
+	var campaign models.Campaign
+	c.expect(http.StatusCreated, &campaign, http.MethodPost, orgPath(org, "/campaigns"), models.CreateCampaign{Name: "Spring"})
+
+	launch := models.UpdateCampaign{Status: models.CampaignStatusLaunched}
+	var first, second models.Campaign
+	c.expect(http.StatusOK, &first, http.MethodPatch, orgPath(org, "/campaigns/"+campaign.ID), launch, idempotency.Header, "launch-1")
+	rec := c.expect(http.StatusOK, &second, http.MethodPatch, orgPath(org, "/campaigns/"+campaign.ID), launch, idempotency.Header, "launch-1")
+	if rec.Header().Get(idempotency.ReplayedHeader) != "true" || second.Status != models.CampaignStatusLaunched || second.Version != first.Version {
+		t.Fatalf("retry wasn't replayed: %+v", second)
+	}
+	// Without the key a second launch is refused as before
+	c.expectError(http.StatusConflict, "conflict", http.MethodPatch, orgPath(org, "/campaigns/"+campaign.ID), launch)
+
+	publishDue(t, relay, time.Now(), 1)
+	if len(publisher.launched) != 1 {
+		t.Fatalf("published %d events", len(publisher.launched))
+	}
+}
+
+func TestSendingQuota(t *testing.T) {
+	cfg := config.Default()
+	cfg.Sending.DailyRecipients = 3
+	cfg.Sending.MonthlyRecipients = 0
+	cfg.Sending.Domain = "mail.acme.test"
+	cfg.Sending.DomainRates = map[string]float64{"mail.acme.test": 5}
+	c, relay, publisher := newRelayClient(t, cfg)
+	org := c.createOrganization("Acme")
+
+	var group models.EmailGroup
+	c.expect(http.StatusCreated, &group, http.MethodPost, orgPath(org, "/email-groups"), models.CreateEmailGroup{Name: "Customers"})
+	for _, address := range []string{"grace@example.com", "ada@example.com"} {
+		var email models.EmailAddress
+		c.expect(http.StatusCreated, &email, http.MethodPost, orgPath(org, "/email-addresses"), models.CreateEmailAddressRequest{Address: address})
+		c.expect(http.StatusCreated, nil, http.MethodPost, orgPath(org, "/email-group-members"), models.CreateEmailGroupMember{
+			EmailGroupID:   group.ID,
+			EmailAddressID: email.ID,
+		})
+	}
+	var campaigns [2]models.Campaign
+	for i, name := range []string{"Spring", "Summer"} {
+		c.expect(http.StatusCreated, &campaigns[i], http.MethodPost, orgPath(org, "/campaigns"), models.CreateCampaign{Name: name})
+		c.expect(http.StatusOK, nil, http.MethodPatch, orgPath(org, "/campaigns/"+campaigns[i].ID), models.UpdateCampaign{
+			EmailGroups: []string{group.ID},
+		})
+	}
+
+	c.expect(http.StatusOK, nil, http.MethodPatch, orgPath(org, "/campaigns/"+campaigns[0].ID), models.UpdateCampaign{Status: models.CampaignStatusLaunched})
+	publishDue(t, relay, time.Now(), 1)
+	if len(publisher.launched) != 1 || publisher.launched[0].SendingDomain != "mail.acme.test" || publisher.launched[0].MaxSendRate != 5 {
+		t.Fatalf("events = %+v", publisher.launched)
+	}
+
+	var usage models.SendingUsage
+	c.expect(http.StatusOK, &usage, http.MethodGet, orgPath(org, "/usage"), nil)
+	if usage.Day.Used != 2 || *usage.Day.Limit != 3 || *usage.Day.Remaining != 1 || !usage.Day.ResetsAt.After(time.Now()) {
+		t.Fatalf("day = %+v", usage.Day)
+	}
+	if usage.Month.Used != 2 || usage.Month.Limit != nil || usage.Month.Remaining != nil {
+		t.Fatalf("month = %+v", usage.Month)
+	}
+	if usage.SendingDomain != "mail.acme.test" || usage.MaxSendRate != 5 {
+		t.Fatalf("usage = %+v", usage)
+	}
+
+	// The second audience doesn't fit in what's left of the day, so the
+	// campaign stays a draft and nothing is counted
+	errResp := c.expectError(http.StatusUnprocessableEntity, "quota_exceeded", http.MethodPatch, orgPath(org, "/campaigns/"+campaigns[1].ID), models.UpdateCampaign{Status: models.CampaignStatusLaunched})
+	if len(errResp.Details) != 1 || errResp.Details[0].Field != "recipients" {
+		t.Fatalf("error = %+v", errResp)
+	}
+	var draft models.Campaign
+	c.expect(http.StatusOK, &draft, http.MethodGet, orgPath(org, "/campaigns/"+campaigns[1].ID), nil)
+	if draft.Status == models.CampaignStatusLaunched {
+		t.Fatalf("status = %q", draft.Status)
+	}
+	publishDue(t, relay, time.Now(), 0)
+	c.expect(http.StatusOK, &usage, http.MethodGet, orgPath(org, "/usage"), nil)
+	if usage.Day.Used != 2 || len(publisher.launched) != 1 {
+		t.Fatalf("usage = %+v, events = %d", usage, len(publisher.launched))
+	}
+}
+
+func TestLaunchesArePacedPerDomain(t *testing.T) {
+	cfg := config.Default()
+	cfg.Sending.Domain = "mail.acme.test"
+	cfg.Sending.DomainRates = map[string]float64{"mail.acme.test": 1}
+	c, relay, publisher := newRelayClient(t, cfg)
+	org := c.createOrganization("Acme")
+
+	var group models.EmailGroup
+	c.expect(http.StatusCreated, &group, http.MethodPost, orgPath(org, "/email-groups"), models.CreateEmailGroup{Name: "Customers"})
+	for _, address := range []string{"grace@example.com", "ada@example.com"} {
+		var email models.EmailAddress
+		c.expect(http.StatusCreated, &email, http.MethodPost, orgPath(org, "/email-addresses"), models.CreateEmailAddressRequest{Address: address})
+		c.expect(http.StatusCreated, nil, http.MethodPost, orgPath(org, "/email-group-members"), models.CreateEmailGroupMember{
+			EmailGroupID:   group.ID,
+			EmailAddressID: email.ID,
+		})
+	}
+	var campaigns [2]models.Campaign
+	for i, name := range []string{"Spring", "Summer"} {
+		c.expect(http.StatusCreated, &campaigns[i], http.MethodPost, orgPath(org, "/campaigns"), models.CreateCampaign{Name: name})
+		c.expect(http.StatusOK, nil, http.MethodPatch, orgPath(org, "/campaigns/"+campaigns[i].ID), models.UpdateCampaign{
+			EmailGroups: []string{group.ID},
+		})
+		c.expect(http.StatusOK, nil, http.MethodPatch, orgPath(org, "/campaigns/"+campaigns[i].ID), models.UpdateCampaign{Status: models.CampaignStatusLaunched})
+	}
+
+	// The second launch waits the two seconds the first one's recipients
+	// take at one a second
+	publishDue(t, relay, time.Now(), 1)
+	publishDue(t, relay, time.Now().Add(time.Second), 0)
+	publishDue(t, relay, time.Now().Add(2*time.Second), 1)
+	if len(publisher.launched) != 2 || publisher.launched[0].CampaignID != campaigns[0].ID || publisher.launched[1].CampaignID != campaigns[1].ID {
+		t.Fatalf("events = %+v", publisher.launched)
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	c := newTestClient(t)
+	org := c.createOrganization("Acme")
+
+	var created models.CreatedAPIKey
+	c.expect(http.StatusCreated, &created, http.MethodPost, orgPath(org, "/api-keys"), models.CreateAPIKey{
+		Name:        "CI",
+		Permissions: []string{"campaign:read"},
+	})
+	if created.Key == "" || created.Prefix == "" {
+		t.Fatalf("created = %+v", created)
+	}
+
+	var got models.APIKey
+	c.expect(http.StatusOK, &got, http.MethodGet, orgPath(org, "/api-keys/"+created.ID), nil)
+	if got.Name != "CI" || got.RevokedAt != nil {
+		t.Fatalf("key = %+v", got)
+	}
+
+	var list models.PaginatedResponse[models.APIKey]
+	c.expect(http.StatusOK, &list, http.MethodGet, orgPath(org, "/api-keys"), nil)
+	if len(list.Results) != 1 {
+		t.Fatalf("results = %+v", list.Results)
+	}
+
+	c.expect(http.StatusNoContent, nil, http.MethodDelete, orgPath(org, "/api-keys/"+created.ID), nil)
+	c.expect(http.StatusOK, &got, http.MethodGet, orgPath(org, "/api-keys/"+created.ID), nil)
+	if got.RevokedAt == nil {
+		t.Fatal("key was not revoked")
+	}
+	c.expectError(http.StatusNotFound, "not_found", http.MethodDelete, orgPath(org, "/api-keys/"+created.ID), nil)
+
+	expired := time.Now().Add(-time.Minute)
+	errResp := c.expectError(http.StatusUnprocessableEntity, "validation_failed", http.MethodPost, orgPath(org, "/api-keys"), models.CreateAPIKey{
+		Name:      "Stale",
+		ExpiresAt: &expired,
+	})
+	if len(errResp.Details) != 1 || errResp.Details[0].Field != "expires_at" {
+		t.Fatalf("error = %+v", errResp)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	c := newTestClient(t)
+	org := c.createOrganization("Acme")
+
+	var template models.Template
+	c.expect(http.StatusCreated, &template, http.MethodPost, orgPath(org, "/templates"), models.CreateTemplate{Name: "Welcome", HTML: "<p>Hi</p>"})
+	// X-Forwarded-For from a client that isn't a trusted proxy is ignored
+	c.expect(http.StatusOK, nil, http.MethodPatch, orgPath(org, "/templates/"+template.ID), models.UpdateTemplate{Name: "Hello"}, echo.HeaderXForwardedFor, "203.0.113.9")
+
+	var list models.PaginatedResponse[models.AuditEntry]
+	c.expect(http.StatusOK, &list, http.MethodGet, orgPath(org, "/audit-log?resource_id="+template.ID), nil)
+	if len(list.Results) != 2 {
+		t.Fatalf("results = %+v", list.Results)
+	}
+	if ip := list.Results[0].IP; ip == nil || *ip != "192.0.2.1" {
+		t.Fatalf("ip = %v", ip)
+	}
+	// Template HTML is recorded by hash, not copied
+	if strings.Contains(string(list.Results[1].After), "<p>Hi</p>") || !strings.Contains(string(list.Results[1].After), `"html_bytes":9`) {
+		t.Fatalf("after = %s", list.Results[1].After)
+	}
+	// Newest first
+	if list.Results[0].Action != services.AuditActionUpdate || list.Results[1].Action != services.AuditActionCreate {
+		t.Fatalf("actions = %q, %q", list.Results[0].Action, list.Results[1].Action)
+	}
+	if list.Results[0].ActorType != "anonymous" {
+		t.Fatalf("actor type = %q", list.Results[0].ActorType)
+	}
+
+	c.expect(http.StatusOK, &list, http.MethodGet, orgPath(org, "/audit-log?action=update"), nil)
+	if len(list.Results) != 1 {
+		t.Fatalf("results = %+v", list.Results)
+	}
+	c.expectError(http.StatusBadRequest, "bad_request", http.MethodGet, orgPath(org, "/audit-log?created_after=yesterday"), nil)
+}
+
+func TestIdempotencyKeyReplaysResponse(t *testing.T) {
+	c := newTestClient(t)
+	org := c.createOrganization("Acme")
+
+	body := models.CreateEmailGroup{Name: "Customers"}
+	var first, second models.EmailGroup
+	c.expect(http.StatusCreated, &first, http.MethodPost, orgPath(org, "/email-groups"), body, idempotency.Header, "abc")
+	rec := c.expect(http.StatusCreated, &second, http.MethodPost, orgPath(org, "/email-groups"), body, idempotency.Header, "abc")
+	if first.ID != second.ID || rec.Header().Get(idempotency.ReplayedHeader) != "true" {
+		t.Fatalf("second request wasn't replayed: %+v", second)
+	}
+
+	// The key is spent on that request within the organization
+	c.expectError(http.StatusUnprocessableEntity, "validation_failed", http.MethodPost, orgPath(org, "/templates"), models.CreateTemplate{Name: "Welcome", HTML: "<p>Hi</p>"}, idempotency.Header, "abc")
+
+	// A new API key is only ever shown once
+	var key models.CreatedAPIKey
+	c.expect(http.StatusCreated, &key, http.MethodPost, orgPath(org, "/api-keys"), models.CreateAPIKey{Name: "CI"}, idempotency.Header, "def")
+	c.expectError(http.StatusConflict, "conflict", http.MethodPost, orgPath(org, "/api-keys"), models.CreateAPIKey{Name: "CI"}, idempotency.Header, "def")
+	var keys models.PaginatedResponse[models.APIKey]
+	c.expect(http.StatusOK, &keys, http.MethodGet, orgPath(org, "/api-keys"), nil)
+	if key.Key == "" || len(keys.Results) != 1 {
+		t.Fatalf("key = %+v, keys = %+v", key, keys.Results)
+	}
+}
+
+// stubVerifier accepts any token and reads the organization from it
+type stubVerifier struct{}
+
+func (stubVerifier) Verify(ctx context.Context, token string) (*auth.Claims, error) {
+	if token == "" {
+		return nil, errors.New("empty token")
+	}
+	return &auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: "user-1"},
+		OrganizationID:   token,
+	}, nil
+}
+
+// stubResolver grants the same permissions to everyone
+type stubResolver []string
+
+func (r stubResolver) Resolve(ctx context.Context, subject string, token string) (*auth.PermissionsResponse, error) {
+	return &auth.PermissionsResponse{UserID: subject, Permissions: r}, nil
+}
+
+func TestAuthentication(t *testing.T) {
+	store := services.NewMemoryStore()
+	org, err := services.NewOrganizationService(store).Create(context.Background(), models.Actor{ID: "test", Type: "test"}, &models.CreateOrganization{Name: "Acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authenticator := auth.NewWithVerifier(stubVerifier{}, stubResolver{"campaign:*", "api_key:*"})
+	authenticator.SetAPIKeyVerifier(apiKeyVerifier(services.NewAPIKeyService(store)))
+	c := &testClient{t: t, e: newEcho(config.Default(), store, authenticator, idempotency.NewMemoryStore(), nil, nil)}
+	bearer := "Bearer " + org.ID
+
+	c.expectError(http.StatusUnauthorized, "unauthorized", http.MethodGet, orgPath(*org, "/campaigns"), nil)
+	c.expectError(http.StatusForbidden, "forbidden", http.MethodGet, "/api/v1/organizations/00000000-0000-4000-8000-000000000000/campaigns", nil, "Authorization", bearer)
+	c.expectError(http.StatusForbidden, "forbidden", http.MethodGet, orgPath(*org, "/audit-log"), nil, "Authorization", bearer)
+	c.expect(http.StatusOK, nil, http.MethodGet, orgPath(*org, "/campaigns"), nil, "Authorization", bearer)
+
+	var perms struct {
+		Subject        string   `json:"subject"`
+		OrganizationID string   `json:"organization_id"`
+		Effective      []string `json:"effective"`
+	}
+	c.expect(http.StatusOK, &perms, http.MethodGet, "/api/v1/me/permissions", nil, "Authorization", bearer)
+	if perms.Subject != "user-1" || perms.OrganizationID != org.ID || len(perms.Effective) == 0 {
+		t.Fatalf("permissions = %+v", perms)
+	}
+
+	// An API key acts with its own permissions and is audited as itself
+	var created models.CreatedAPIKey
+	c.expect(http.StatusCreated, &created, http.MethodPost, orgPath(*org, "/api-keys"), models.CreateAPIKey{
+		Name:        "CI",
+		Permissions: []string{"campaign:read", "campaign:create"},
+	}, "Authorization", bearer)
+
+	c.expect(http.StatusCreated, nil, http.MethodPost, orgPath(*org, "/campaigns"), models.CreateCampaign{Name: "Spring"}, auth.APIKeyHeader, created.Key)
+	c.expectError(http.StatusForbidden, "forbidden", http.MethodPost, orgPath(*org, "/templates"), models.CreateTemplate{Name: "Welcome", HTML: "<p>Hi</p>"}, auth.APIKeyHeader, created.Key)
+	// Refused keys all get the same answer
+	if errResp := c.expectError(http.StatusUnauthorized, "unauthorized", http.MethodGet, orgPath(*org, "/campaigns"), nil, auth.APIKeyHeader, created.Key+"x"); errResp.Message != "invalid API key" {
+		t.Fatalf("message = %q", errResp.Message)
+	}
+
+	entries, err := services.NewAuditService(store).GetAll(context.Background(), org.ID, models.AuditFilter{ResourceType: "campaign"}, models.PaginationParams{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries.Results) != 1 || entries.Results[0].ActorID != created.ID || entries.Results[0].ActorType != auth.PrincipalAPIKey {
+		t.Fatalf("entries = %+v", entries.Results)
+	}
+}
+
+// TestEveryRouteHasAPermission guards the authorization middleware, which
+// refuses registered routes it has no permission for
+func TestEveryRouteHasAPermission(t *testing.T) {
+	routes := newTestApp(t).Routes()
+	if len(routes) == 0 {
+		t.Fatal("no routes registered")
+	}
+	if err := auth.ValidateRoutes(routes); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOrganizationsAreScopedToTheCaller(t *testing.T) {
+	store := services.NewMemoryStore()
+	var orgs []*models.Organization
+	for _, name := range []string{"Acme", "Globex"} {
+		org, err := services.NewOrganizationService(store).Create(context.Background(), models.Actor{ID: "test", Type: "test"}, &models.CreateOrganization{Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		orgs = append(orgs, org)
+	}
+	own, other := orgs[0], orgs[1]
+	bearer := "Bearer " + own.ID
+
+	c := &testClient{t: t, e: newEcho(config.Default(), store, auth.NewWithVerifier(stubVerifier{}, stubResolver{"*"}), idempotency.NewMemoryStore(), nil, nil)}
+	var list models.PaginatedResponse[models.Organization]
+	c.expect(http.StatusOK, &list, http.MethodGet, "/api/v1/organizations", nil, "Authorization", bearer)
+	if len(list.Results) != 1 || list.Results[0].ID != own.ID {
+		t.Fatalf("results = %+v", list.Results)
+	}
+	c.expect(http.StatusOK, nil, http.MethodGet, "/api/v1/organizations/"+own.ID, nil, "Authorization", bearer)
+	c.expectError(http.StatusNotFound, "not_found", http.MethodGet, "/api/v1/organizations/"+other.ID, nil, "Authorization", bearer)
+
+	// Only organization:admin, granted by name, reaches other tenants
+	c = &testClient{t: t, e: newEcho(config.Default(), store, auth.NewWithVerifier(stubVerifier{}, stubResolver{"organization:read", auth.PermOrganizationAdmin}), idempotency.NewMemoryStore(), nil, nil)}
+	c.expect(http.StatusOK, &list, http.MethodGet, "/api/v1/organizations", nil, "Authorization", bearer)
+	if len(list.Results) != 2 {
+		t.Fatalf("results = %+v", list.Results)
+	}
+	c.expect(http.StatusOK, nil, http.MethodGet, "/api/v1/organizations/"+other.ID, nil, "Authorization", bearer)
+}
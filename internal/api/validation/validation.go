@@ -0,0 +1,193 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	// The timezone tag loads zones by name; don't depend on the image
+	// shipping a zoneinfo database
+	_ "time/tzdata"
+
+	"github.com/donnaloia/sendpulse/internal/auth"
+	"github.com/donnaloia/sendpulse/internal/services"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/net/idna"
+)
+
+// Validator implements echo.Validator using the `validate` struct tags on
+// the request models. Every violation is reported at once, as a
+// services.Validation error, so clients get a single 422 listing them all.
+type Validator struct {
+	validate *validator.Validate
+}
+
+// New returns a Validator with the custom tags registered:
+//
+//	email_idn  an RFC 5322 addr-spec whose domain may be internationalized
+//	maxbytes   a string of at most N bytes (max counts characters)
+//	permission a permission known to the RBAC registry
+func New() *Validator {
+	v := validator.New(validator.WithRequiredStructEnabled())
+
+	// Report fields by their JSON names, as the client sent them
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return f.Name
+		}
+		return name
+	})
+
+	must(v.RegisterValidation("email_idn", func(fl validator.FieldLevel) bool {
+		return IsEmail(fl.Field().String())
+	}))
+	must(v.RegisterValidation("maxbytes", func(fl validator.FieldLevel) bool {
+		limit, err := strconv.Atoi(fl.Param())
+		if err != nil {
+			panic(fmt.Sprintf("maxbytes: bad limit %q", fl.Param()))
+		}
+		return len(fl.Field().String()) <= limit
+	}))
+	must(v.RegisterValidation("permission", func(fl validator.FieldLevel) bool {
+		return auth.IsValidPermission(fl.Field().String())
+	}))
+
+	return &Validator{validate: v}
+}
+
+func must(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Validate implements echo.Validator
+func (v *Validator) Validate(i any) error {
+	err := v.validate.Struct(i)
+	if err == nil {
+		return nil
+	}
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return err
+	}
+	details := make([]services.FieldError, len(verrs))
+	for i, fe := range verrs {
+		details[i] = services.FieldError{Field: fieldPath(fe), Message: message(fe)}
+	}
+	return services.Validation("request is invalid", details...)
+}
+
+// fieldPath is the field's path without the top-level struct name, e.g.
+// "templates[1]" rather than "UpdateCampaign.templates[1]"
+func fieldPath(fe validator.FieldError) string {
+	ns := fe.Namespace()
+	if _, rest, ok := strings.Cut(ns, "."); ok {
+		return rest
+	}
+	return ns
+}
+
+func message(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email_idn":
+		return "must be a valid email address"
+	case "uuid":
+		return "must be a UUID"
+	case "url", "http_url":
+		return "must be a URL"
+	case "timezone":
+		return "must be an IANA time zone, e.g. Europe/Berlin"
+	case "oneof":
+		return "must be one of: " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	case "max":
+		if fe.Kind() == reflect.Slice {
+			return fmt.Sprintf("must have at most %s items", fe.Param())
+		}
+		return fmt.Sprintf("must be at most %s characters", fe.Param())
+	case "min":
+		if fe.Kind() == reflect.Slice {
+			return fmt.Sprintf("must have at least %s items", fe.Param())
+		}
+		return fmt.Sprintf("must be at least %s characters", fe.Param())
+	case "maxbytes":
+		return fmt.Sprintf("must be at most %s bytes", fe.Param())
+	case "permission":
+		return "is not a known permission"
+	}
+	return fmt.Sprintf("failed the %s check", fe.Tag())
+}
+
+// Limits from RFC 5321 section 4.5.3.1
+const (
+	maxEmailLength = 254
+	maxLocalLength = 64
+)
+
+// IsEmail reports whether s is a bare RFC 5322 address (no display name or
+// comments) with a resolvable-looking domain. Internationalized domains are
+// accepted and checked in their punycode form; UTF-8 local parts are
+// allowed as in RFC 6531.
+func IsEmail(s string) bool {
+	if s == "" || len(s) > maxEmailLength || strings.ContainsAny(s, "<>()") {
+		return false
+	}
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Name != "" {
+		return false
+	}
+
+	at := strings.LastIndex(addr.Address, "@")
+	if at < 1 {
+		return false
+	}
+	local, domain := addr.Address[:at], addr.Address[at+1:]
+	if len(local) > maxLocalLength || !strings.HasSuffix(s, "@"+domain) {
+		return false
+	}
+
+	ascii, err := idna.Lookup.ToASCII(domain)
+	if err != nil || len(ascii) > 253 {
+		return false
+	}
+	// Dotless domains are legal but never valid recipients on the internet
+	return strings.Contains(ascii, ".") && !strings.HasSuffix(ascii, ".")
+}
+
+// idParam reports whether a path parameter holds a resource ID
+func idParam(name string) bool {
+	return name == "id" || strings.HasSuffix(name, "_id")
+}
+
+// PathParams rejects requests whose ID path parameters aren't UUIDs before
+// they reach a handler, all violations together as a 422
+func PathParams() echo.MiddlewareFunc {
+	v := validator.New()
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			var details []services.FieldError
+			for i, name := range c.ParamNames() {
+				if !idParam(name) {
+					continue
+				}
+				if err := v.Var(c.ParamValues()[i], "uuid"); err != nil {
+					details = append(details, services.FieldError{Field: name, Message: "must be a UUID"})
+				}
+			}
+			if details != nil {
+				return services.Validation("path is invalid", details...)
+			}
+			return next(c)
+		}
+	}
+}
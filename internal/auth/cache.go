@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// CacheStats are running counters for a CachingResolver
+type CacheStats struct {
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	StaleServed uint64 `json:"stale_served"`
+	Errors      uint64 `json:"errors"`
+	Rejected    uint64 `json:"rejected"`
+	Entries     int    `json:"entries"`
+	BreakerOpen bool   `json:"breaker_open"`
+}
+
+// HitRate is the fraction of lookups answered from the cache
+func (s CacheStats) HitRate() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+type cacheEntry struct {
+	key       string
+	value     *PermissionsResponse
+	expiresAt time.Time
+}
+
+// CachingResolver wraps a PermissionResolver with an LRU cache, collapses
+// concurrent lookups for the same key into one upstream call, and guards the
+// upstream with a circuit breaker. Entries are keyed on subject and token
+// expiry, so a refreshed token always gets a fresh lookup, and never outlive
+// the token they were resolved for.
+//
+// Expired entries are kept until evicted so they can be served when the
+// upstream is unavailable.
+type CachingResolver struct {
+	next       PermissionResolver
+	ttl        time.Duration
+	maxEntries int
+	breaker    *CircuitBreaker
+	group      singleflight.Group
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	staleServed atomic.Uint64
+	errors      atomic.Uint64
+	rejected    atomic.Uint64
+}
+
+func NewCachingResolver(next PermissionResolver, ttl time.Duration, maxEntries int, breaker *CircuitBreaker) *CachingResolver {
+	if maxEntries < 1 {
+		maxEntries = 1
+	}
+	return &CachingResolver{
+		next:       next,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		breaker:    breaker,
+		entries:    map[string]*list.Element{},
+		order:      list.New(),
+	}
+}
+
+// ResolveWithExpiry is Resolve for a token expiring at tokenExpiry
+func (r *CachingResolver) ResolveWithExpiry(ctx context.Context, subject string, token string, tokenExpiry time.Time) (*PermissionsResponse, error) {
+	key := subject + "|" + strconv.FormatInt(tokenExpiry.Unix(), 10)
+
+	value, fresh := r.get(key)
+	if fresh {
+		r.hits.Add(1)
+		return value, nil
+	}
+	r.misses.Add(1)
+
+	if r.breaker != nil && !r.breaker.Allow() {
+		r.rejected.Add(1)
+		return r.stale(value)
+	}
+
+	result, err, _ := r.group.Do(key, func() (interface{}, error) {
+		// Detach from the caller's cancellation: other requests may be
+		// waiting on this lookup
+		resp, err := r.next.Resolve(context.WithoutCancel(ctx), subject, token)
+		// Recorded here, once per call upstream, rather than by each of
+		// the requests that waited on it
+		if r.breaker != nil {
+			if errors.Is(err, ErrPermissionsUnavailable) {
+				r.breaker.Failure()
+			} else {
+				// Including refusals: the service answered, it just didn't
+				// like this caller
+				r.breaker.Success()
+			}
+		}
+		return resp, err
+	})
+	if err != nil {
+		r.errors.Add(1)
+		if errors.Is(err, ErrPermissionsUnavailable) {
+			return r.stale(value)
+		}
+		return nil, err
+	}
+
+	resp := result.(*PermissionsResponse)
+	expiresAt := time.Now().Add(r.ttl)
+	if !tokenExpiry.IsZero() && tokenExpiry.Before(expiresAt) {
+		expiresAt = tokenExpiry
+	}
+	r.put(key, resp, expiresAt)
+	return resp, nil
+}
+
+// Resolve implements PermissionResolver for callers that don't know the token
+// expiry; entries then live for the cache TTL
+func (r *CachingResolver) Resolve(ctx context.Context, subject string, token string) (*PermissionsResponse, error) {
+	return r.ResolveWithExpiry(ctx, subject, token, time.Time{})
+}
+
+// Stats returns a snapshot of the cache counters
+func (r *CachingResolver) Stats() CacheStats {
+	r.mu.Lock()
+	entries := r.order.Len()
+	r.mu.Unlock()
+
+	return CacheStats{
+		Hits:        r.hits.Load(),
+		Misses:      r.misses.Load(),
+		StaleServed: r.staleServed.Load(),
+		Errors:      r.errors.Load(),
+		Rejected:    r.rejected.Load(),
+		Entries:     entries,
+		BreakerOpen: r.breaker != nil && r.breaker.Open(),
+	}
+}
+
+func (r *CachingResolver) stale(value *PermissionsResponse) (*PermissionsResponse, error) {
+	if value != nil {
+		r.staleServed.Add(1)
+		return value, nil
+	}
+	return nil, ErrPermissionsUnavailable
+}
+
+// get returns the cached value for key, if any, and whether it is still fresh
+func (r *CachingResolver) get(key string) (*PermissionsResponse, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	el, ok := r.entries[key]
+	if !ok {
+		return nil, false
+	}
+	r.order.MoveToFront(el)
+	entry := el.Value.(*cacheEntry)
+	return entry.value, time.Now().Before(entry.expiresAt)
+}
+
+func (r *CachingResolver) put(key string, value *PermissionsResponse, expiresAt time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if el, ok := r.entries[key]; ok {
+		entry := el.Value.(*cacheEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		r.order.MoveToFront(el)
+		return
+	}
+
+	r.entries[key] = r.order.PushFront(&cacheEntry{key: key, value: value, expiresAt: expiresAt})
+	for r.order.Len() > r.maxEntries {
+		oldest := r.order.Back()
+		r.order.Remove(oldest)
+		delete(r.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
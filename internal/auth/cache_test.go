@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingResolver fails every lookup once released
+type blockingResolver struct {
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (r *blockingResolver) Resolve(ctx context.Context, subject string, token string) (*PermissionsResponse, error) {
+	r.calls.Add(1)
+	<-r.release
+	return nil, ErrPermissionsUnavailable
+}
+
+func TestCachingResolverCountsSharedLookupOnce(t *testing.T) {
+	upstream := &blockingResolver{release: make(chan struct{})}
+	breaker := NewCircuitBreaker(2, time.Minute)
+	r := NewCachingResolver(upstream, time.Minute, 10, breaker)
+
+	const waiters = 8
+	var wg sync.WaitGroup
+	for i := 0; i < waiters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.Resolve(context.Background(), "user-1", "token")
+		}()
+	}
+	for upstream.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// Let the other lookups join the one in flight
+	time.Sleep(50 * time.Millisecond)
+	close(upstream.release)
+	wg.Wait()
+
+	if n := upstream.calls.Load(); n != 1 {
+		t.Fatalf("upstream called %d times", n)
+	}
+	// One failed call is one failure, below the threshold of two
+	if breaker.Open() {
+		t.Fatal("breaker opened on a single failed lookup")
+	}
+	if stats := r.Stats(); stats.Misses != waiters || stats.Errors != waiters {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"errors"
+	"time"
+)
+
+type Config struct {
+	Enabled        bool          `yaml:"enabled" env:"AUTH_ENABLED"`
+	HMACSecret     string        `yaml:"hmac_secret" env:"AUTH_HMAC_SECRET" secret:"true"`
+	JWKSURL        string        `yaml:"jwks_url" env:"AUTH_JWKS_URL"`
+	JWKSCacheTTL   time.Duration `yaml:"jwks_cache_ttl" env:"AUTH_JWKS_CACHE_TTL"`
+	Issuer         string        `yaml:"issuer" env:"AUTH_ISSUER"`
+	Audience       string        `yaml:"audience" env:"AUTH_AUDIENCE"`
+	PermissionsURL string        `yaml:"permissions_url" env:"PERMISSIONS_SERVICE_URL"`
+
+	// Permission lookups are cached and guarded by a circuit breaker
+	PermissionsTimeout          time.Duration `yaml:"permissions_timeout" env:"PERMISSIONS_TIMEOUT"`
+	PermissionsCacheTTL         time.Duration `yaml:"permissions_cache_ttl" env:"PERMISSIONS_CACHE_TTL"`
+	PermissionsCacheSize        int           `yaml:"permissions_cache_size" env:"PERMISSIONS_CACHE_SIZE"`
+	PermissionsBreakerThreshold int           `yaml:"permissions_breaker_threshold" env:"PERMISSIONS_BREAKER_THRESHOLD"`
+	PermissionsBreakerCooldown  time.Duration `yaml:"permissions_breaker_cooldown" env:"PERMISSIONS_BREAKER_COOLDOWN"`
+	// PermissionsFailOpen lets token-verified requests through without a
+	// permission check when the permissions service is unavailable and no
+	// cached answer exists. Organization scoping still applies.
+	PermissionsFailOpen bool `yaml:"permissions_fail_open" env:"PERMISSIONS_FAIL_OPEN"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		JWKSCacheTTL:   10 * time.Minute,
+		PermissionsURL: "http://permissions_service:8000",
+
+		PermissionsTimeout:          2 * time.Second,
+		PermissionsCacheTTL:         time.Minute,
+		PermissionsCacheSize:        10000,
+		PermissionsBreakerThreshold: 5,
+		PermissionsBreakerCooldown:  30 * time.Second,
+	}
+}
+
+// Validate reports configuration that would leave the middleware unable to
+// verify tokens. A disabled config is always valid.
+func (c *Config) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	var errs []error
+	if c.HMACSecret == "" && c.JWKSURL == "" {
+		errs = append(errs, errors.New("auth is enabled but neither AUTH_HMAC_SECRET nor AUTH_JWKS_URL is set"))
+	}
+	if c.PermissionsURL == "" {
+		errs = append(errs, errors.New("auth is enabled but PERMISSIONS_SERVICE_URL is empty"))
+	}
+	if c.PermissionsTimeout <= 0 {
+		errs = append(errs, errors.New("PERMISSIONS_TIMEOUT must be positive"))
+	}
+	if c.PermissionsCacheSize < 0 || c.PermissionsBreakerThreshold < 0 {
+		errs = append(errs, errors.New("PERMISSIONS_CACHE_SIZE and PERMISSIONS_BREAKER_THRESHOLD can't be negative"))
+	}
+	return errors.Join(errs...)
+}
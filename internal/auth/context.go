@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ContextKey is the key the middleware stores the Principal under in the
+// echo context
+const ContextKey = "auth"
+
+type principalKey struct{}
+
+// Principal types
+const (
+	PrincipalUser   = "user"
+	PrincipalAPIKey = "api_key"
+)
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	Type           string    `json:"type"`
+	Subject        string    `json:"subject"`
+	OrganizationID string    `json:"organization_id"`
+	Permissions    []string  `json:"permissions"`
+	ExpiresAt      time.Time `json:"expires_at"`
+
+	// degraded is set when permissions couldn't be resolved and the
+	// authenticator is configured to fail open
+	degraded bool
+}
+
+// Degraded reports whether the principal was let through without a
+// permission lookup because the permissions service was unavailable
+func (p *Principal) Degraded() bool {
+	return p.degraded
+}
+
+// CrossOrganization reports whether the principal may read organizations
+// other than its own, which takes PermOrganizationAdmin granted by name
+func (p *Principal) CrossOrganization() bool {
+	return slices.Contains(p.Permissions, PermOrganizationAdmin)
+}
+
+// WithPrincipal returns a copy of ctx carrying the principal
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal stored in ctx, if any. Services should
+// use this rather than depending on echo.
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+// FromEcho returns the principal stored on the echo context, if any
+func FromEcho(c echo.Context) (*Principal, bool) {
+	p, ok := c.Get(ContextKey).(*Principal)
+	return p, ok && p != nil
+}
+
+// setPrincipal makes the principal available to both handlers (via the echo
+// context) and anything downstream holding the request context
+func setPrincipal(c echo.Context, p *Principal) {
+	c.Set(ContextKey, p)
+	req := c.Request()
+	c.SetRequest(req.WithContext(WithPrincipal(req.Context(), p)))
+}
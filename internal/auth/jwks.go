@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minJWKSRefreshInterval stops a flood of tokens with unknown key IDs from
+// hammering the JWKS endpoint
+const minJWKSRefreshInterval = 30 * time.Second
+
+// JWKSVerifier verifies RS256/ES256 tokens against a JSON Web Key Set. Keys are
+// cached for the configured TTL and refetched early when a token references
+// a key ID we haven't seen, which is how issuers roll keys.
+type JWKSVerifier struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+	parser *jwt.Parser
+	// minRefresh is minJWKSRefreshInterval, shortened by tests
+	minRefresh time.Duration
+
+	// fetchMu lets one fetch run at a time. It's held across the request,
+	// unlike mu, so verifications with cached keys never wait on the
+	// endpoint.
+	fetchMu sync.Mutex
+
+	mu          sync.RWMutex
+	keys        map[string]interface{}
+	fetchedAt   time.Time
+	lastAttempt time.Time
+}
+
+func NewJWKSVerifier(url string, ttl time.Duration, opts ...jwt.ParserOption) *JWKSVerifier {
+	opts = append(opts, jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}))
+	return &JWKSVerifier{
+		url:        url,
+		ttl:        ttl,
+		client:     &http.Client{Timeout: 5 * time.Second},
+		parser:     jwt.NewParser(opts...),
+		minRefresh: minJWKSRefreshInterval,
+		keys:       map[string]interface{}{},
+	}
+}
+
+func (v *JWKSVerifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := v.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		if kid == "" {
+			return nil, errors.New("token has no kid header")
+		}
+		return v.key(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("invalid token: missing subject")
+	}
+	return claims, nil
+}
+
+// key returns the public key for kid, refreshing the set when it is stale or
+// doesn't contain kid
+func (v *JWKSVerifier) key(ctx context.Context, kid string) (interface{}, error) {
+	v.mu.RLock()
+	key, ok := v.keys[kid]
+	fresh := time.Since(v.fetchedAt) < v.ttl
+	v.mu.RUnlock()
+	if ok && fresh {
+		return key, nil
+	}
+
+	// A known key that has gone stale is served while another request
+	// refreshes the set, rather than waiting for it
+	if err := v.refresh(ctx, !ok); err != nil {
+		// Serve a stale key rather than failing every request while the
+		// JWKS endpoint is unavailable
+		if ok {
+			return key, nil
+		}
+		return nil, err
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+// refresh refetches the key set, unless it was attempted in the last
+// minRefresh. When wait is false and a fetch is already running, it returns
+// at once.
+func (v *JWKSVerifier) refresh(ctx context.Context, wait bool) error {
+	if wait {
+		v.fetchMu.Lock()
+	} else if !v.fetchMu.TryLock() {
+		return nil
+	}
+	defer v.fetchMu.Unlock()
+
+	// Another request may have refreshed while we waited for the lock
+	v.mu.Lock()
+	if time.Since(v.lastAttempt) < v.minRefresh {
+		v.mu.Unlock()
+		return nil
+	}
+	v.lastAttempt = time.Now()
+	v.mu.Unlock()
+
+	keys, err := v.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	v.keys = keys
+	v.fetchedAt = time.Now()
+	v.mu.Unlock()
+	return nil
+}
+
+// fetch downloads the key set, keeping the signing keys it can use
+func (v *JWKSVerifier) fetch(ctx context.Context) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating JWKS request: %w", err)
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("JWKS endpoint returned status: %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("error parsing JWKS: %w", err)
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			// Skip keys we can't use rather than rejecting the whole set
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	return keys, nil
+}
+
+// jwk is the subset of RFC 7517 needed for RSA and EC signing keys
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding key parameter: %w", err)
+	}
+	return new(big.Int).SetBytes(b), nil
+}
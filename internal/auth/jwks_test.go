@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwksServer serves a key set that tests can change, fail or stall
+type jwksServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	keys    map[string]*rsa.PublicKey
+	status  int
+	stall   chan struct{}
+	fetches atomic.Int32
+}
+
+func newJWKSServer(t *testing.T, keys map[string]*rsa.PublicKey) *jwksServer {
+	t.Helper()
+	s := &jwksServer{keys: keys, status: http.StatusOK}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.fetches.Add(1)
+		s.mu.Lock()
+		status, stall := s.status, s.stall
+		set := struct {
+			Keys []jwk `json:"keys"`
+		}{}
+		for kid, key := range s.keys {
+			set.Keys = append(set.Keys, jwk{
+				Kid: kid,
+				Kty: "RSA",
+				Use: "sig",
+				N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		s.mu.Unlock()
+
+		if stall != nil {
+			<-stall
+		}
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) set(fn func(s *jwksServer)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(s)
+}
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func signToken(t *testing.T, key *rsa.PrivateKey, kid string, expiresAt time.Time) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "user-1",
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		OrganizationID: "org-1",
+	})
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func newTestJWKSVerifier(url string, ttl time.Duration) *JWKSVerifier {
+	v := NewJWKSVerifier(url, ttl, jwt.WithExpirationRequired())
+	v.minRefresh = 0
+	return v
+}
+
+func TestJWKSVerifierChecksSignatureAndExpiry(t *testing.T) {
+	ctx := context.Background()
+	key := newRSAKey(t)
+	server := newJWKSServer(t, map[string]*rsa.PublicKey{"k1": &key.PublicKey})
+	v := newTestJWKSVerifier(server.URL, time.Hour)
+
+	claims, err := v.Verify(ctx, signToken(t, key, "k1", time.Now().Add(time.Minute)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "user-1" || claims.OrganizationID != "org-1" {
+		t.Fatalf("claims = %+v", claims)
+	}
+
+	if _, err := v.Verify(ctx, signToken(t, key, "k1", time.Now().Add(-time.Minute))); err == nil {
+		t.Fatal("expired token verified")
+	}
+	// Signed by another key under the same key ID
+	if _, err := v.Verify(ctx, signToken(t, newRSAKey(t), "k1", time.Now().Add(time.Minute))); err == nil {
+		t.Fatal("token with a bad signature verified")
+	}
+	if n := server.fetches.Load(); n != 1 {
+		t.Fatalf("fetched %d times, want the cached set used", n)
+	}
+}
+
+func TestJWKSVerifierFollowsKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	oldKey, newKey := newRSAKey(t), newRSAKey(t)
+	server := newJWKSServer(t, map[string]*rsa.PublicKey{"old": &oldKey.PublicKey})
+	v := newTestJWKSVerifier(server.URL, time.Hour)
+
+	if _, err := v.Verify(ctx, signToken(t, oldKey, "old", time.Now().Add(time.Minute))); err != nil {
+		t.Fatal(err)
+	}
+
+	// An unseen key ID refetches the set before the TTL is up
+	server.set(func(s *jwksServer) { s.keys = map[string]*rsa.PublicKey{"new": &newKey.PublicKey} })
+	if _, err := v.Verify(ctx, signToken(t, newKey, "new", time.Now().Add(time.Minute))); err != nil {
+		t.Fatal(err)
+	}
+	// and the retired key goes with the old set
+	if _, err := v.Verify(ctx, signToken(t, oldKey, "old", time.Now().Add(time.Minute))); err == nil {
+		t.Fatal("token signed with a retired key verified")
+	}
+
+	_, err := v.Verify(ctx, signToken(t, newKey, "missing", time.Now().Add(time.Minute)))
+	if err == nil || !strings.Contains(err.Error(), `unknown key id "missing"`) {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestJWKSVerifierServesStaleKeysWhenEndpointFails(t *testing.T) {
+	ctx := context.Background()
+	key := newRSAKey(t)
+	server := newJWKSServer(t, map[string]*rsa.PublicKey{"k1": &key.PublicKey})
+	// Every lookup finds the set stale
+	v := newTestJWKSVerifier(server.URL, 0)
+
+	if _, err := v.Verify(ctx, signToken(t, key, "k1", time.Now().Add(time.Minute))); err != nil {
+		t.Fatal(err)
+	}
+
+	server.set(func(s *jwksServer) { s.status = http.StatusInternalServerError })
+	if _, err := v.Verify(ctx, signToken(t, key, "k1", time.Now().Add(time.Minute))); err != nil {
+		t.Fatalf("stale key not served: %v", err)
+	}
+	_, err := v.Verify(ctx, signToken(t, key, "k2", time.Now().Add(time.Minute)))
+	if err == nil || !strings.Contains(err.Error(), "status: 500") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestJWKSVerifierDoesNotWaitOnSlowRefresh(t *testing.T) {
+	ctx := context.Background()
+	key, other := newRSAKey(t), newRSAKey(t)
+	server := newJWKSServer(t, map[string]*rsa.PublicKey{"k1": &key.PublicKey})
+	v := newTestJWKSVerifier(server.URL, time.Hour)
+	if _, err := v.Verify(ctx, signToken(t, key, "k1", time.Now().Add(time.Minute))); err != nil {
+		t.Fatal(err)
+	}
+
+	// An unknown key ID starts a fetch that doesn't finish until released
+	stall := make(chan struct{})
+	server.set(func(s *jwksServer) { s.stall = stall })
+	refreshed := make(chan error, 1)
+	go func() {
+		_, err := v.Verify(ctx, signToken(t, other, "k2", time.Now().Add(time.Minute)))
+		refreshed <- err
+	}()
+	for server.fetches.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := v.Verify(ctx, signToken(t, key, "k1", time.Now().Add(time.Minute)))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("verifying with a cached key waited for the refresh")
+	}
+
+	close(stall)
+	if err := <-refreshed; err == nil {
+		t.Fatal("token with a key that isn't in the set verified")
+	}
+}
@@ -1,12 +1,14 @@
 package auth
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"strings"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
 )
 
@@ -16,167 +18,202 @@ type PermissionsResponse struct {
 	Permissions []string `json:"permissions"`
 }
 
+// APIKeyHeader carries an organization API key instead of a bearer token
+const APIKeyHeader = "X-API-Key"
+
+// APIKeyVerifier resolves a plaintext API key to the principal it acts as
+type APIKeyVerifier interface {
+	VerifyAPIKey(ctx context.Context, key string) (*Principal, error)
+}
+
+// APIKeyVerifierFunc adapts a function to APIKeyVerifier
+type APIKeyVerifierFunc func(ctx context.Context, key string) (*Principal, error)
+
+func (f APIKeyVerifierFunc) VerifyAPIKey(ctx context.Context, key string) (*Principal, error) {
+	return f(ctx, key)
+}
+
+// Authenticator verifies bearer tokens or API keys and resolves the caller's
+// permissions
+type Authenticator struct {
+	verifier    TokenVerifier
+	apiKeys     APIKeyVerifier
+	permissions PermissionResolver
+	failOpen    bool
+}
+
+// New builds an Authenticator from the config
+func New(cfg *Config) (*Authenticator, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	verifier, err := NewVerifier(cfg)
+	if err != nil {
+		return nil, err
+	}
+	resolver := NewCachingResolver(
+		NewHTTPPermissionResolver(cfg.PermissionsURL, cfg.PermissionsTimeout),
+		cfg.PermissionsCacheTTL,
+		cfg.PermissionsCacheSize,
+		NewCircuitBreaker(cfg.PermissionsBreakerThreshold, cfg.PermissionsBreakerCooldown),
+	)
+	a := NewWithVerifier(verifier, resolver)
+	a.failOpen = cfg.PermissionsFailOpen
+	return a, nil
+}
+
+// NewWithVerifier builds an Authenticator around a custom TokenVerifier and
+// PermissionResolver
+func NewWithVerifier(verifier TokenVerifier, permissions PermissionResolver) *Authenticator {
+	return &Authenticator{
+		verifier:    verifier,
+		permissions: permissions,
+	}
+}
+
+// PermissionCacheStats returns the permission cache counters, if the
+// resolver is cached
+func (a *Authenticator) PermissionCacheStats() (CacheStats, bool) {
+	if r, ok := a.permissions.(*CachingResolver); ok {
+		return r.Stats(), true
+	}
+	return CacheStats{}, false
+}
+
+// SetAPIKeyVerifier enables authentication with the X-API-Key header
+func (a *Authenticator) SetAPIKeyVerifier(v APIKeyVerifier) {
+	a.apiKeys = v
+}
+
 // Middleware checks permissions for all routes
-func Middleware() echo.MiddlewareFunc {
+func (a *Authenticator) Middleware() echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			// // uncomment this out to skip auth for all routes
-			// return next(c)
-
 			// Skip auth for certain paths
-			// if isPublicPath(c.Path()) {
-			// 	return next(c)
-			// }
-
-			// // Get token from Authorization header
-			// access_token := extractToken(c.Request())
-			// if access_token == "" {
-			// 	return echo.NewHTTPError(http.StatusUnauthorized, "missing authorization token")
-			// }
-
-			// // Call auth service to validate token and get permissions
-			// authResp, err := validateTokenWithAuthService(access_token)
-			// if err != nil {
-			// 	return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
-			// }
-
-			// // Get org ID from URL if present (e.g., /api/v1/orgs/:orgId/...)
-			// if orgID := c.Param("orgId"); orgID != "" {
-			// 	// Check if user belongs to this org
-			// 	if orgID != authResp.OrgID {
-			// 		return echo.NewHTTPError(http.StatusForbidden, "user does not belong to this organization")
-			// 	}
-			// }
-
-			// // Get required permission for this path and method
-			// requiredPerm := getRequiredPermission(c.Path(), c.Request().Method)
-			// if requiredPerm == "" {
-			// 	// No permission required for this path
-			// 	return next(c)
-			// }
-
-			// // Check if user has required permission
-			// if !hasPermission(authResp.Permissions, requiredPerm) {
-			// 	return echo.NewHTTPError(http.StatusForbidden,
-			// 		fmt.Sprintf("insufficient permissions: %s required", requiredPerm))
-			// }
-
-			// // Store auth response in context for later use
-			// c.Set("auth", authResp)
+			if isPublicPath(c.Path()) {
+				return next(c)
+			}
+
+			principal, err := a.authenticate(c)
+			if err != nil {
+				return err
+			}
+
+			// Get org ID from URL if present (e.g., /api/v1/organizations/:organization_id/...)
+			if orgID := c.Param("organization_id"); orgID != "" {
+				// Check if caller belongs to this org. IDs are UUIDs, which
+				// compare case-insensitively.
+				if !strings.EqualFold(orgID, principal.OrganizationID) {
+					return echo.NewHTTPError(http.StatusForbidden, "user does not belong to this organization")
+				}
+			}
+			// Other tenants' organizations don't exist as far as the caller
+			// is concerned
+			if c.Path() == organizationRoute && !strings.EqualFold(c.Param("id"), principal.OrganizationID) && !principal.CrossOrganization() {
+				return echo.NewHTTPError(http.StatusNotFound, "organization not found")
+			}
+
+			// Get required permission for this route and method. Every
+			// registered route should be mapped (see ValidateRoutes); one
+			// that isn't is refused rather than left open to every caller.
+			requiredPerm, ok := RequiredPermission(c.Request().Method, c.Path())
+			if !ok {
+				if isRegistered(c.Echo(), c.Request().Method, c.Path()) {
+					slog.ErrorContext(c.Request().Context(), "route has no permission mapping", "method", c.Request().Method, "route", c.Path())
+					return echo.NewHTTPError(http.StatusInternalServerError, "route has no permission mapping")
+				}
+				// Nothing is registered here, so the router answers 404/405
+				return next(c)
+			}
+			if requiredPerm != AuthenticatedOnly && !principal.degraded && !hasPermission(principal.Permissions, requiredPerm) {
+				return echo.NewHTTPError(http.StatusForbidden,
+					fmt.Sprintf("insufficient permissions: %s required", requiredPerm))
+			}
+
+			// Store principal in context for later use
+			setPrincipal(c, principal)
 
 			return next(c)
 		}
 	}
 }
 
-// isPublicPath checks if the given path should skip authentication
-func isPublicPath(path string) bool {
-	publicPaths := []string{
-		"/health",
-		"/api/v1/auth/login",
-		"/api/v1/auth/register",
-		"/api/v1/auth/refresh",
-	}
-
-	for _, p := range publicPaths {
-		if p == path {
+// isRegistered reports whether e has a route for method and path
+func isRegistered(e *echo.Echo, method, path string) bool {
+	for _, r := range e.Routes() {
+		if r.Method == method && r.Path == path {
 			return true
 		}
 	}
 	return false
 }
 
-// extractToken gets the JWT token from the Authorization header
-func extractToken(r *http.Request) string {
-	bearerToken := r.Header.Get("Authorization")
-	if len(bearerToken) > 7 && bearerToken[:7] == "Bearer " {
-		return bearerToken[7:]
-	}
-	return ""
-}
-
-// validateTokenWithAuthService calls the auth service to validate the token
-func validateTokenWithAuthService(token string) (*PermissionsResponse, error) {
-	// Parse the JWT token to extract the subject (uuid)
-	claims := &jwt.RegisteredClaims{}
-	_, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
-		// Replace with your actual secret key
-		return []byte("your-secret-key"), nil
-	})
-	if err != nil {
-		return nil, fmt.Errorf("invalid token: %v", err)
+// authenticate resolves the caller from an API key, if one was sent and API
+// keys are enabled, or otherwise from the bearer token
+func (a *Authenticator) authenticate(c echo.Context) (*Principal, error) {
+	if key := c.Request().Header.Get(APIKeyHeader); key != "" && a.apiKeys != nil {
+		principal, err := a.apiKeys.VerifyAPIKey(c.Request().Context(), key)
+		if err != nil {
+			// Why a key was refused is only logged, so callers guessing
+			// keys learn nothing about the ones they hit
+			slog.InfoContext(c.Request().Context(), "api key refused", "error", err)
+			return nil, echo.NewHTTPError(http.StatusUnauthorized, "invalid API key")
+		}
+		principal.Type = PrincipalAPIKey
+		return principal, nil
 	}
 
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: 10 * time.Second,
+	// Get token from Authorization header
+	accessToken := extractToken(c.Request())
+	if accessToken == "" {
+		return nil, echo.NewHTTPError(http.StatusUnauthorized, "missing authorization token")
 	}
 
-	// Create request to permissions endpoint using Subject from claims
-	url := fmt.Sprintf("http://localhost:8080/api/v1/users/%s/permissions", claims.Subject)
-	req, err := http.NewRequest("GET", url, nil)
+	claims, err := a.verifier.Verify(c.Request().Context(), accessToken)
 	if err != nil {
-		return nil, fmt.Errorf("error creating request: %v", err)
+		return nil, echo.NewHTTPError(http.StatusUnauthorized, err.Error())
 	}
 
-	// Add authorization header
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
-
-	// Make the request
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("error calling permissions service: %v", err)
+	principal := &Principal{
+		Type:           PrincipalUser,
+		Subject:        claims.Subject,
+		OrganizationID: claims.OrganizationID,
 	}
-	defer resp.Body.Close()
-
-	// Check status code
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("permissions service returned status: %d", resp.StatusCode)
+	if claims.ExpiresAt != nil {
+		principal.ExpiresAt = claims.ExpiresAt.Time
 	}
 
-	// Parse response
-	var authResp PermissionsResponse
-	if err := json.NewDecoder(resp.Body).Decode(&authResp); err != nil {
-		return nil, fmt.Errorf("error parsing response: %v", err)
+	// Call the permissions service (through the cache) to get permissions
+	authResp, err := a.resolvePermissions(c.Request().Context(), claims.Subject, accessToken, principal.ExpiresAt)
+	switch {
+	case errors.Is(err, ErrPermissionsUnavailable) && a.failOpen:
+		principal.degraded = true
+		return principal, nil
+	case errors.Is(err, ErrPermissionsUnavailable):
+		return nil, echo.NewHTTPError(http.StatusServiceUnavailable, err.Error())
+	case err != nil:
+		return nil, echo.NewHTTPError(http.StatusUnauthorized, err.Error())
 	}
 
-	// Set the UserID from the token subject
-	authResp.UserID = claims.Subject
-
-	return &authResp, nil
-}
-
-// getRequiredPermission returns the required permission for a given path and method
-func getRequiredPermission(path string, method string) string {
-	// Define your permission mappings here
-	permissionMap := map[string]map[string]string{
-		"/api/v1/emails": {
-			"POST":   "email:send",
-			"GET":    "email:read",
-			"DELETE": "email:delete",
-		},
-		"/api/v1/templates": {
-			"POST":   "template:create",
-			"GET":    "template:read",
-			"PUT":    "template:update",
-			"DELETE": "template:delete",
-		},
+	principal.Permissions = authResp.Permissions
+	if authResp.OrgID != "" {
+		principal.OrganizationID = authResp.OrgID
 	}
+	return principal, nil
+}
 
-	if methodPerms, ok := permissionMap[path]; ok {
-		if perm, ok := methodPerms[method]; ok {
-			return perm
-		}
+func (a *Authenticator) resolvePermissions(ctx context.Context, subject string, token string, expiresAt time.Time) (*PermissionsResponse, error) {
+	if r, ok := a.permissions.(*CachingResolver); ok {
+		return r.ResolveWithExpiry(ctx, subject, token, expiresAt)
 	}
-	return ""
+	return a.permissions.Resolve(ctx, subject, token)
 }
 
-// hasPermission checks if the user has the required permission
-func hasPermission(userPerms []string, requiredPerm string) bool {
-	for _, p := range userPerms {
-		if p == requiredPerm {
-			return true
-		}
+// extractToken gets the JWT token from the Authorization header
+func extractToken(r *http.Request) string {
+	bearerToken := r.Header.Get("Authorization")
+	if len(bearerToken) > 7 && bearerToken[:7] == "Bearer " {
+		return bearerToken[7:]
 	}
-	return false
+	return ""
 }
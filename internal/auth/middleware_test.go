@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// stubVerifier accepts "Bearer <org ID>" as a user of that organization
+type stubVerifier struct{}
+
+func (stubVerifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	if token == "" {
+		return nil, errors.New("empty token")
+	}
+	claims := &Claims{OrganizationID: token}
+	claims.Subject = "user-1"
+	return claims, nil
+}
+
+type stubResolver []string
+
+func (r stubResolver) Resolve(ctx context.Context, subject string, token string) (*PermissionsResponse, error) {
+	return &PermissionsResponse{UserID: subject, Permissions: r}, nil
+}
+
+// newMiddlewareTestApp serves the organization routes behind the
+// middleware, answering 200 when a request gets through
+func newMiddlewareTestApp(permissions ...string) *echo.Echo {
+	e := echo.New()
+	e.Use(NewWithVerifier(stubVerifier{}, stubResolver(permissions)).Middleware())
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	e.GET("/api/v1/organizations/:id", ok)
+	e.GET("/api/v1/organizations/:organization_id/campaigns", ok)
+	return e
+}
+
+func serve(e *echo.Echo, path, orgID string) int {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Authorization", "Bearer "+orgID)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestMiddlewareScopesOrganizationRoutes(t *testing.T) {
+	const own, other = "11111111-1111-4111-8111-111111111111", "22222222-2222-4222-8222-222222222222"
+
+	for _, tc := range []struct {
+		name        string
+		permissions []string
+		path        string
+		want        int
+	}{
+		{"own organization by :id", []string{PermOrganizationRead}, "/api/v1/organizations/" + own, http.StatusOK},
+		{"other organization by :id", []string{PermOrganizationRead}, "/api/v1/organizations/" + other, http.StatusNotFound},
+		{"wildcards don't reach other tenants", []string{"*", "role:admin"}, "/api/v1/organizations/" + other, http.StatusNotFound},
+		{"organization admin by :id", []string{PermOrganizationRead, PermOrganizationAdmin}, "/api/v1/organizations/" + other, http.StatusOK},
+		{"missing permission by :id", []string{PermCampaignRead}, "/api/v1/organizations/" + own, http.StatusForbidden},
+		{"own organization_id", []string{PermCampaignRead}, "/api/v1/organizations/" + own + "/campaigns", http.StatusOK},
+		{"own organization_id in upper case", []string{PermCampaignRead}, "/api/v1/organizations/" + strings.ToUpper(own) + "/campaigns", http.StatusOK},
+		{"other organization_id", []string{PermCampaignRead}, "/api/v1/organizations/" + other + "/campaigns", http.StatusForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if code := serve(newMiddlewareTestApp(tc.permissions...), tc.path, own); code != tc.want {
+				t.Fatalf("status %d, want %d", code, tc.want)
+			}
+		})
+	}
+}
+
+func TestMiddlewareRefusesUnmappedRoutes(t *testing.T) {
+	e := newMiddlewareTestApp("*")
+	e.GET("/api/v1/unmapped", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	if code := serve(e, "/api/v1/unmapped", "org-1"); code != http.StatusInternalServerError {
+		t.Fatalf("unmapped route: status %d", code)
+	}
+	// Routes that don't exist still get the router's answer
+	if code := serve(e, "/api/v1/missing", "org-1"); code != http.StatusNotFound {
+		t.Fatalf("missing route: status %d", code)
+	}
+}
+
+func TestMiddlewareFailsOpenOnlyWhenConfigured(t *testing.T) {
+	const own = "11111111-1111-4111-8111-111111111111"
+	server := newPermissionsServer(t)
+	server.setStatus(http.StatusServiceUnavailable)
+
+	for _, tc := range []struct {
+		failOpen bool
+		want     int
+	}{
+		{false, http.StatusServiceUnavailable},
+		{true, http.StatusOK},
+	} {
+		resolver := NewCachingResolver(NewHTTPPermissionResolver(server.URL, time.Second), time.Minute, 10, nil)
+		a := NewWithVerifier(stubVerifier{}, resolver)
+		a.failOpen = tc.failOpen
+		e := echo.New()
+		e.Use(a.Middleware())
+		e.GET("/api/v1/organizations/:organization_id/campaigns", func(c echo.Context) error {
+			if !c.Get(ContextKey).(*Principal).Degraded() {
+				t.Error("principal not marked degraded")
+			}
+			return c.NoContent(http.StatusOK)
+		})
+
+		if code := serve(e, "/api/v1/organizations/"+own+"/campaigns", own); code != tc.want {
+			t.Errorf("fail open %v: status %d, want %d", tc.failOpen, code, tc.want)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Permissions are "<resource>:<action>" strings. A "*" in either position is a
+// wildcard, so "campaign:*" grants every campaign action and "*" grants
+// everything.
+const (
+	PermOrganizationRead   = "organization:read"
+	PermOrganizationCreate = "organization:create"
+	// PermOrganizationAdmin lets the caller read every organization rather
+	// than only its own. It must be granted by name: wildcards and roles
+	// don't include it, so an organization's own admins can't see other
+	// tenants.
+	PermOrganizationAdmin = "organization:admin"
+
+	PermProfileRead   = "profile:read"
+	PermProfileCreate = "profile:create"
+	PermProfileUpdate = "profile:update"
+
+	PermEmailRead   = "email:read"
+	PermEmailCreate = "email:create"
+
+	PermEmailGroupRead   = "email_group:read"
+	PermEmailGroupCreate = "email_group:create"
+
+	PermEmailGroupMemberRead   = "email_group_member:read"
+	PermEmailGroupMemberCreate = "email_group_member:create"
+	PermEmailGroupMemberDelete = "email_group_member:delete"
+
+	PermCampaignRead   = "campaign:read"
+	PermCampaignCreate = "campaign:create"
+	PermCampaignUpdate = "campaign:update"
+
+	PermTemplateRead   = "template:read"
+	PermTemplateCreate = "template:create"
+	PermTemplateUpdate = "template:update"
+
+	PermAPIKeyRead   = "api_key:read"
+	PermAPIKeyCreate = "api_key:create"
+	PermAPIKeyRevoke = "api_key:revoke"
+
+	PermAuditLogRead = "audit_log:read"
+
+	PermUsageRead = "usage:read"
+)
+
+// AuthenticatedOnly marks routes that any authenticated caller may use
+const AuthenticatedOnly = ""
+
+// rolePrefix marks a role bundle in a permission list, e.g. "role:editor"
+const rolePrefix = "role:"
+
+// Roles bundle permissions under a name the permissions service can grant
+// instead of listing every permission
+var Roles = map[string][]string{
+	"viewer": {"*:read"},
+	"editor": {
+		"*:read",
+		"email:*",
+		"email_group:*",
+		"email_group_member:*",
+		"campaign:*",
+		"template:*",
+	},
+	"admin": {"*"},
+}
+
+type route struct {
+	method string
+	path   string
+}
+
+// organizationRoute addresses an organization by :id rather than
+// :organization_id
+const organizationRoute = "/api/v1/organizations/:id"
+
+// publicRoutes skip authentication entirely
+var publicRoutes = map[string]bool{
+	"/health":  true,
+	"/metrics": true,
+	"/livez":   true,
+	"/readyz":  true,
+}
+
+// routePermissions maps every route registered in routes.Setup, keyed on the
+// echo route pattern (c.Path()), to the permission it requires
+var routePermissions = map[route]string{
+	{http.MethodGet, "/api/v1/me/permissions"}: AuthenticatedOnly,
+
+	{http.MethodGet, "/api/v1/organizations"}:     PermOrganizationRead,
+	{http.MethodGet, "/api/v1/organizations/:id"}: PermOrganizationRead,
+	{http.MethodPost, "/api/v1/organizations"}:    PermOrganizationCreate,
+
+	{http.MethodGet, "/api/v1/organizations/:organization_id/profiles"}:       PermProfileRead,
+	{http.MethodGet, "/api/v1/organizations/:organization_id/profiles/:id"}:   PermProfileRead,
+	{http.MethodPost, "/api/v1/organizations/:organization_id/profiles"}:      PermProfileCreate,
+	{http.MethodPatch, "/api/v1/organizations/:organization_id/profiles/:id"}: PermProfileUpdate,
+
+	{http.MethodGet, "/api/v1/organizations/:organization_id/email-addresses"}:     PermEmailRead,
+	{http.MethodGet, "/api/v1/organizations/:organization_id/email-addresses/:id"}: PermEmailRead,
+	{http.MethodPost, "/api/v1/organizations/:organization_id/email-addresses"}:    PermEmailCreate,
+
+	{http.MethodGet, "/api/v1/organizations/:organization_id/email-groups"}:     PermEmailGroupRead,
+	{http.MethodGet, "/api/v1/organizations/:organization_id/email-groups/:id"}: PermEmailGroupRead,
+	{http.MethodPost, "/api/v1/organizations/:organization_id/email-groups"}:    PermEmailGroupCreate,
+
+	{http.MethodGet, "/api/v1/organizations/:organization_id/email-group-members"}:        PermEmailGroupMemberRead,
+	{http.MethodGet, "/api/v1/organizations/:organization_id/email-group-members/:id"}:    PermEmailGroupMemberRead,
+	{http.MethodPost, "/api/v1/organizations/:organization_id/email-group-members"}:       PermEmailGroupMemberCreate,
+	{http.MethodDelete, "/api/v1/organizations/:organization_id/email-group-members/:id"}: PermEmailGroupMemberDelete,
+
+	{http.MethodGet, "/api/v1/organizations/:organization_id/campaigns"}:       PermCampaignRead,
+	{http.MethodGet, "/api/v1/organizations/:organization_id/campaigns/:id"}:   PermCampaignRead,
+	{http.MethodPost, "/api/v1/organizations/:organization_id/campaigns"}:      PermCampaignCreate,
+	{http.MethodPatch, "/api/v1/organizations/:organization_id/campaigns/:id"}: PermCampaignUpdate,
+
+	{http.MethodGet, "/api/v1/organizations/:organization_id/templates"}:       PermTemplateRead,
+	{http.MethodGet, "/api/v1/organizations/:organization_id/templates/:id"}:   PermTemplateRead,
+	{http.MethodPost, "/api/v1/organizations/:organization_id/templates"}:      PermTemplateCreate,
+	{http.MethodPatch, "/api/v1/organizations/:organization_id/templates/:id"}: PermTemplateUpdate,
+
+	{http.MethodGet, "/api/v1/organizations/:organization_id/api-keys"}:        PermAPIKeyRead,
+	{http.MethodGet, "/api/v1/organizations/:organization_id/api-keys/:id"}:    PermAPIKeyRead,
+	{http.MethodPost, "/api/v1/organizations/:organization_id/api-keys"}:       PermAPIKeyCreate,
+	{http.MethodDelete, "/api/v1/organizations/:organization_id/api-keys/:id"}: PermAPIKeyRevoke,
+
+	{http.MethodGet, "/api/v1/organizations/:organization_id/audit-log"}: PermAuditLogRead,
+
+	{http.MethodGet, "/api/v1/organizations/:organization_id/usage"}: PermUsageRead,
+}
+
+// isPublicPath checks if the given route pattern should skip authentication
+func isPublicPath(path string) bool {
+	return publicRoutes[path]
+}
+
+// RequiredPermission returns the permission needed for a route pattern and
+// method. ok is false when the route isn't in the registry.
+func RequiredPermission(method, path string) (perm string, ok bool) {
+	perm, ok = routePermissions[route{method, path}]
+	return perm, ok
+}
+
+// ValidateRoutes fails if any registered route is neither public nor mapped to
+// a permission. Call it once all routes are registered.
+func ValidateRoutes(routes []*echo.Route) error {
+	var missing []string
+	for _, r := range routes {
+		if isPublicPath(r.Path) {
+			continue
+		}
+		if _, ok := RequiredPermission(r.Method, r.Path); !ok {
+			missing = append(missing, r.Method+" "+r.Path)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("routes without a permission mapping: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// KnownPermissions returns every concrete permission used by the registry
+func KnownPermissions() []string {
+	seen := map[string]bool{}
+	var perms []string
+	for _, p := range routePermissions {
+		if p == AuthenticatedOnly || seen[p] {
+			continue
+		}
+		seen[p] = true
+		perms = append(perms, p)
+	}
+	sort.Strings(perms)
+	return perms
+}
+
+// ExpandRoles replaces "role:<name>" entries with the permissions they bundle.
+// Unknown roles grant nothing.
+func ExpandRoles(perms []string) []string {
+	expanded := make([]string, 0, len(perms))
+	for _, p := range perms {
+		if role, ok := strings.CutPrefix(p, rolePrefix); ok {
+			expanded = append(expanded, Roles[role]...)
+			continue
+		}
+		expanded = append(expanded, p)
+	}
+	return expanded
+}
+
+// EffectivePermissions resolves granted permissions (including roles and
+// wildcards) to the concrete permissions known to the registry
+func EffectivePermissions(granted []string) []string {
+	effective := []string{}
+	for _, p := range KnownPermissions() {
+		if hasPermission(granted, p) {
+			effective = append(effective, p)
+		}
+	}
+	return effective
+}
+
+// IsSubset reports whether every permission granted by requested (after
+// expanding roles and wildcards) is also granted by granted. It's used to stop
+// callers minting credentials more powerful than their own.
+func IsSubset(requested, granted []string) bool {
+	for _, p := range EffectivePermissions(requested) {
+		if !hasPermission(granted, p) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsValidPermission reports whether p grants at least one known permission
+func IsValidPermission(p string) bool {
+	return len(EffectivePermissions([]string{p})) > 0
+}
+
+// hasPermission checks if the granted permissions satisfy the required one
+func hasPermission(userPerms []string, requiredPerm string) bool {
+	for _, p := range ExpandRoles(userPerms) {
+		if permissionMatches(p, requiredPerm) {
+			return true
+		}
+	}
+	return false
+}
+
+// permissionMatches reports whether a single granted permission, which may
+// contain wildcards, covers the required permission
+func permissionMatches(granted, required string) bool {
+	if granted == "*" || granted == required {
+		return true
+	}
+	gResource, gAction, ok := strings.Cut(granted, ":")
+	if !ok {
+		return false
+	}
+	rResource, rAction, ok := strings.Cut(required, ":")
+	if !ok {
+		return false
+	}
+	return (gResource == "*" || gResource == rResource) &&
+		(gAction == "*" || gAction == rAction)
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrPermissionsUnavailable means the permissions service couldn't be reached
+// (or the circuit breaker is open) and no cached answer was available
+var ErrPermissionsUnavailable = errors.New("permissions service unavailable")
+
+// PermissionResolver looks up the permissions granted to a token's subject
+type PermissionResolver interface {
+	Resolve(ctx context.Context, subject string, token string) (*PermissionsResponse, error)
+}
+
+// HTTPPermissionResolver calls the external permissions service
+type HTTPPermissionResolver struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewHTTPPermissionResolver(baseURL string, timeout time.Duration) *HTTPPermissionResolver {
+	return &HTTPPermissionResolver{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+func (r *HTTPPermissionResolver) Resolve(ctx context.Context, subject string, token string) (*PermissionsResponse, error) {
+	// Create request to permissions endpoint using Subject from claims
+	endpoint := fmt.Sprintf("%s/api/v1/users/%s/permissions", r.baseURL, url.PathEscape(subject))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	// Add authorization header
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	// Make the request
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPermissionsUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	// 5xx means the service is unhealthy; anything else non-200 is an answer
+	// about this particular caller
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return nil, fmt.Errorf("%w: status %d", ErrPermissionsUnavailable, resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("permissions service returned status: %d", resp.StatusCode)
+	}
+
+	// Parse response
+	var authResp PermissionsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&authResp); err != nil {
+		return nil, fmt.Errorf("error parsing response: %w", err)
+	}
+
+	// Set the UserID from the token subject
+	authResp.UserID = subject
+
+	return &authResp, nil
+}
@@ -0,0 +1,260 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// permissionsServer stands in for the permissions service, answering every
+// lookup with status and permissions, which tests can change
+type permissionsServer struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	status      int
+	permissions []string
+	lookups     atomic.Int32
+	lastPath    string
+	lastAuth    string
+}
+
+func newPermissionsServer(t *testing.T, permissions ...string) *permissionsServer {
+	t.Helper()
+	s := &permissionsServer{status: http.StatusOK, permissions: permissions}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.lookups.Add(1)
+		s.mu.Lock()
+		s.lastPath, s.lastAuth = r.URL.EscapedPath(), r.Header.Get("Authorization")
+		status, permissions := s.status, s.permissions
+		s.mu.Unlock()
+
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		json.NewEncoder(w).Encode(PermissionsResponse{OrgID: "org-1", Permissions: permissions})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *permissionsServer) setStatus(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+func TestHTTPPermissionResolverFetchesPermissions(t *testing.T) {
+	server := newPermissionsServer(t, PermCampaignRead, PermCampaignUpdate)
+	r := NewHTTPPermissionResolver(server.URL+"/", time.Second)
+
+	resp, err := r.Resolve(context.Background(), "user 1", "token-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.UserID != "user 1" || resp.OrgID != "org-1" || len(resp.Permissions) != 2 || resp.Permissions[1] != PermCampaignUpdate {
+		t.Fatalf("resp = %+v", resp)
+	}
+	if server.lastPath != "/api/v1/users/user%201/permissions" || server.lastAuth != "Bearer token-1" {
+		t.Fatalf("requested %s with %q", server.lastPath, server.lastAuth)
+	}
+}
+
+func TestHTTPPermissionResolverClassifiesFailures(t *testing.T) {
+	server := newPermissionsServer(t)
+	r := NewHTTPPermissionResolver(server.URL, time.Second)
+
+	for _, tc := range []struct {
+		status      int
+		unavailable bool
+	}{
+		{http.StatusInternalServerError, true},
+		{http.StatusServiceUnavailable, true},
+		// An answer about this caller, not a sign the service is down
+		{http.StatusForbidden, false},
+		{http.StatusNotFound, false},
+	} {
+		server.setStatus(tc.status)
+		_, err := r.Resolve(context.Background(), "user-1", "token")
+		if err == nil || errors.Is(err, ErrPermissionsUnavailable) != tc.unavailable {
+			t.Errorf("status %d: err = %v", tc.status, err)
+		}
+	}
+
+	// Nothing listening is unavailable too
+	server.Close()
+	if _, err := r.Resolve(context.Background(), "user-1", "token"); !errors.Is(err, ErrPermissionsUnavailable) {
+		t.Fatalf("closed server: err = %v", err)
+	}
+}
+
+func TestCachingResolverExpiresEntries(t *testing.T) {
+	ctx := context.Background()
+	server := newPermissionsServer(t, PermCampaignRead)
+	r := NewCachingResolver(NewHTTPPermissionResolver(server.URL, time.Second), 50*time.Millisecond, 10, nil)
+
+	for range 2 {
+		if _, err := r.Resolve(ctx, "user-1", "token"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := server.lookups.Load(); n != 1 {
+		t.Fatalf("%d lookups within the TTL", n)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, err := r.Resolve(ctx, "user-1", "token"); err != nil {
+		t.Fatal(err)
+	}
+	if n := server.lookups.Load(); n != 2 {
+		t.Fatalf("%d lookups after the TTL", n)
+	}
+	if stats := r.Stats(); stats.Hits != 1 || stats.Misses != 2 || stats.Entries != 1 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+func TestCachingResolverCapsEntriesAtTokenExpiry(t *testing.T) {
+	ctx := context.Background()
+	server := newPermissionsServer(t, PermCampaignRead)
+	r := NewCachingResolver(NewHTTPPermissionResolver(server.URL, time.Second), time.Hour, 10, nil)
+
+	expiry := time.Now().Add(50 * time.Millisecond)
+	for range 2 {
+		if _, err := r.ResolveWithExpiry(ctx, "user-1", "token", expiry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A refreshed token is looked up afresh
+	if _, err := r.ResolveWithExpiry(ctx, "user-1", "token-2", expiry.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if n := server.lookups.Load(); n != 2 {
+		t.Fatalf("%d lookups", n)
+	}
+
+	// The entry goes with its token, well inside the TTL
+	time.Sleep(time.Until(expiry) + 10*time.Millisecond)
+	if _, err := r.ResolveWithExpiry(ctx, "user-1", "token", expiry); err != nil {
+		t.Fatal(err)
+	}
+	if n := server.lookups.Load(); n != 3 {
+		t.Fatalf("%d lookups after the token expired", n)
+	}
+}
+
+func TestCachingResolverEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	server := newPermissionsServer(t, PermCampaignRead)
+	r := NewCachingResolver(NewHTTPPermissionResolver(server.URL, time.Second), time.Hour, 2, nil)
+
+	// user-1 is used again after user-2, so user-2 makes way for user-3
+	for _, subject := range []string{"user-1", "user-2", "user-1", "user-3", "user-1", "user-2"} {
+		if _, err := r.Resolve(ctx, subject, "token"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := server.lookups.Load(); n != 4 {
+		t.Fatalf("%d lookups", n)
+	}
+	if stats := r.Stats(); stats.Hits != 2 || stats.Entries != 2 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+func TestCachingResolverServesStaleEntriesWhenUnavailable(t *testing.T) {
+	ctx := context.Background()
+	server := newPermissionsServer(t, PermCampaignRead)
+	// Every entry is stale as soon as it's stored
+	r := NewCachingResolver(NewHTTPPermissionResolver(server.URL, time.Second), 0, 10, nil)
+
+	if _, err := r.Resolve(ctx, "user-1", "token"); err != nil {
+		t.Fatal(err)
+	}
+
+	server.setStatus(http.StatusBadGateway)
+	resp, err := r.Resolve(ctx, "user-1", "token")
+	if err != nil || len(resp.Permissions) != 1 || resp.Permissions[0] != PermCampaignRead {
+		t.Fatalf("stale lookup: %+v, %v", resp, err)
+	}
+	if _, err := r.Resolve(ctx, "user-2", "token"); !errors.Is(err, ErrPermissionsUnavailable) {
+		t.Fatalf("uncached lookup: err = %v", err)
+	}
+
+	// A refusal is an answer, so it isn't papered over
+	server.setStatus(http.StatusForbidden)
+	if _, err := r.Resolve(ctx, "user-1", "token"); err == nil || errors.Is(err, ErrPermissionsUnavailable) {
+		t.Fatalf("refused lookup: err = %v", err)
+	}
+	if stats := r.Stats(); stats.StaleServed != 1 || stats.Errors != 3 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+func TestCachingResolverBreakerCycle(t *testing.T) {
+	ctx := context.Background()
+	const cooldown = 50 * time.Millisecond
+	server := newPermissionsServer(t, PermCampaignRead)
+	breaker := NewCircuitBreaker(2, cooldown)
+	r := NewCachingResolver(NewHTTPPermissionResolver(server.URL, time.Second), 0, 10, breaker)
+
+	// Two failures in a row open the breaker, which then keeps lookups
+	// from the service
+	server.setStatus(http.StatusInternalServerError)
+	for range 3 {
+		if _, err := r.Resolve(ctx, "user-1", "token"); !errors.Is(err, ErrPermissionsUnavailable) {
+			t.Fatalf("err = %v", err)
+		}
+	}
+	if n := server.lookups.Load(); n != 2 || !breaker.Open() || r.Stats().Rejected != 1 {
+		t.Fatalf("%d lookups, stats = %+v", n, r.Stats())
+	}
+
+	// After the cooldown one trial goes through; failing, it re-opens the
+	// breaker straight away
+	time.Sleep(cooldown)
+	if _, err := r.Resolve(ctx, "user-1", "token"); !errors.Is(err, ErrPermissionsUnavailable) {
+		t.Fatalf("err = %v", err)
+	}
+	if n := server.lookups.Load(); n != 3 || !breaker.Open() {
+		t.Fatalf("%d lookups, open %v", n, breaker.Open())
+	}
+
+	// A trial that succeeds closes it
+	time.Sleep(cooldown)
+	server.setStatus(http.StatusOK)
+	for range 2 {
+		if _, err := r.Resolve(ctx, "user-1", "token"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := server.lookups.Load(); n != 5 || breaker.Open() {
+		t.Fatalf("%d lookups, open %v", n, breaker.Open())
+	}
+}
+
+func TestCircuitBreakerAllowsOneTrialWhenHalfOpen(t *testing.T) {
+	const cooldown = 50 * time.Millisecond
+	b := NewCircuitBreaker(1, cooldown)
+	b.Failure()
+	if b.Allow() {
+		t.Fatal("open breaker allowed a call")
+	}
+	time.Sleep(cooldown)
+	if !b.Allow() {
+		t.Fatal("no trial after the cooldown")
+	}
+	if b.Allow() {
+		t.Fatal("second call allowed while the trial is out")
+	}
+	b.Success()
+	if !b.Allow() || !b.Allow() {
+		t.Fatal("closed breaker refused a call")
+	}
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Claims are the JWT claims the service understands
+type Claims struct {
+	jwt.RegisteredClaims
+	OrganizationID string `json:"org_id,omitempty"`
+}
+
+// TokenVerifier validates a raw bearer token and returns its claims
+type TokenVerifier interface {
+	Verify(ctx context.Context, token string) (*Claims, error)
+}
+
+// NewVerifier builds the verifier selected by the config. A JWKS URL takes
+// precedence over an HMAC secret.
+func NewVerifier(cfg *Config) (TokenVerifier, error) {
+	switch {
+	case cfg.JWKSURL != "":
+		return NewJWKSVerifier(cfg.JWKSURL, cfg.JWKSCacheTTL, parserOptions(cfg)...), nil
+	case cfg.HMACSecret != "":
+		return NewHMACVerifier([]byte(cfg.HMACSecret), parserOptions(cfg)...), nil
+	default:
+		return nil, errors.New("no token verifier configured")
+	}
+}
+
+func parserOptions(cfg *Config) []jwt.ParserOption {
+	opts := []jwt.ParserOption{jwt.WithExpirationRequired()}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	return opts
+}
+
+// HMACVerifier verifies HS256/HS384/HS512 tokens signed with a shared secret
+type HMACVerifier struct {
+	secret []byte
+	parser *jwt.Parser
+}
+
+func NewHMACVerifier(secret []byte, opts ...jwt.ParserOption) *HMACVerifier {
+	opts = append(opts, jwt.WithValidMethods([]string{"HS256", "HS384", "HS512"}))
+	return &HMACVerifier{
+		secret: secret,
+		parser: jwt.NewParser(opts...),
+	}
+}
+
+func (v *HMACVerifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := v.parser.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return v.secret, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("invalid token: missing subject")
+	}
+	return claims, nil
+}
@@ -0,0 +1,204 @@
+// Package config is the service's configuration. Settings start from the
+// defaults, are overridden by an optional YAML file and then by environment
+// variables, and are checked as a whole by Validate:
+//
+//	cfg, err := config.Load(path)
+//	...
+//	if err := cfg.Validate(); err != nil {
+//
+// Each package owns the section it reads, tagged with its YAML key and
+// environment variable. Fields tagged secret:"true" are redacted by Print.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/mail"
+	"os"
+	"time"
+
+	"github.com/donnaloia/sendpulse/internal/auth"
+	"github.com/donnaloia/sendpulse/internal/database"
+	"github.com/donnaloia/sendpulse/internal/events"
+	"github.com/donnaloia/sendpulse/internal/logging"
+	"github.com/donnaloia/sendpulse/internal/ratelimit"
+	"github.com/donnaloia/sendpulse/internal/sending"
+	"github.com/donnaloia/sendpulse/internal/tracing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv names the YAML file to load when no path is given
+const FileEnv = "CONFIG_FILE"
+
+type Config struct {
+	HTTP      HTTP             `yaml:"http"`
+	Database  database.Config  `yaml:"database"`
+	Auth      auth.Config      `yaml:"auth"`
+	Kafka     events.Config    `yaml:"kafka"`
+	SMTP      SMTP             `yaml:"smtp"`
+	Features  Features         `yaml:"features"`
+	Log       logging.Config   `yaml:"log"`
+	Tracing   tracing.Config   `yaml:"tracing"`
+	RateLimit ratelimit.Config `yaml:"rate_limit"`
+	Sending   sending.Config   `yaml:"sending"`
+}
+
+type HTTP struct {
+	Addr string `yaml:"addr" env:"HTTP_ADDR"`
+	// RequestTimeout is the deadline for each request, after which its
+	// queries are cancelled. Zero disables it.
+	RequestTimeout time.Duration `yaml:"request_timeout" env:"REQUEST_TIMEOUT"`
+	// ShutdownTimeout bounds a graceful shutdown: draining in-flight
+	// requests, stopping workers and flushing events
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	// ShutdownDelay is how long the server keeps taking requests after
+	// /readyz starts failing, for load balancers to notice and stop sending
+	// them. It counts towards ShutdownTimeout.
+	ShutdownDelay time.Duration `yaml:"shutdown_delay" env:"SHUTDOWN_DELAY"`
+	// ReadinessTimeout bounds each of /readyz's checks
+	ReadinessTimeout time.Duration `yaml:"readiness_timeout" env:"READINESS_TIMEOUT"`
+	// ReadinessCacheTTL is how long /readyz reuses its checks' results
+	ReadinessCacheTTL time.Duration `yaml:"readiness_cache_ttl" env:"READINESS_CACHE_TTL"`
+	// TrustedProxies are the CIDRs of the proxies whose X-Forwarded-For is
+	// believed. Without any, the client's address is the connection's.
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+}
+
+// SMTP is the relay campaign emails are sent through
+type SMTP struct {
+	Host     string `yaml:"host" env:"SMTP_HOST"`
+	Port     int    `yaml:"port" env:"SMTP_PORT"`
+	Username string `yaml:"username" env:"SMTP_USERNAME"`
+	Password string `yaml:"password" env:"SMTP_PASSWORD" secret:"true"`
+	From     string `yaml:"from" env:"SMTP_FROM"`
+	// StartTLS upgrades the connection before authenticating
+	StartTLS bool `yaml:"starttls" env:"SMTP_STARTTLS"`
+}
+
+// Features toggles optional API behaviour
+type Features struct {
+	// RequireIfMatch rejects PATCHes to versioned resources that don't send
+	// If-Match with 428, instead of applying them unconditionally
+	RequireIfMatch bool `yaml:"require_if_match" env:"REQUIRE_IF_MATCH"`
+}
+
+// Default returns the configuration used when nothing is set
+func Default() *Config {
+	return &Config{
+		HTTP: HTTP{
+			Addr:              ":8080",
+			RequestTimeout:    30 * time.Second,
+			ShutdownTimeout:   30 * time.Second,
+			ReadinessTimeout:  2 * time.Second,
+			ReadinessCacheTTL: time.Second,
+		},
+		Database: database.DefaultConfig(),
+		Auth:     auth.DefaultConfig(),
+		Kafka:    events.DefaultConfig(),
+		SMTP: SMTP{
+			Port:     587,
+			StartTLS: true,
+		},
+		Log:     logging.DefaultConfig(),
+		Tracing: tracing.DefaultConfig(),
+
+		RateLimit: ratelimit.DefaultConfig(),
+		Sending:   sending.DefaultConfig(),
+	}
+}
+
+// Load reads the configuration from the YAML file at path, or at FileEnv
+// when path is empty, and the environment. Neither has to set anything.
+// The result isn't validated.
+func Load(path string) (*Config, error) {
+	if path == "" {
+		path = os.Getenv(FileEnv)
+	}
+	return load(path, os.LookupEnv)
+}
+
+func load(path string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	cfg := Default()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading config file: %w", err)
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		// A misspelt key would otherwise be silently ignored
+		decoder.KnownFields(true)
+		if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+		}
+	}
+	if err := applyEnv(cfg, lookupEnv); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate reports every invalid setting at once, by environment variable
+func (c *Config) Validate() error {
+	var errs []error
+	if _, _, err := net.SplitHostPort(c.HTTP.Addr); err != nil {
+		errs = append(errs, fmt.Errorf("HTTP_ADDR %q isn't a host:port address", c.HTTP.Addr))
+	}
+	if c.HTTP.RequestTimeout < 0 {
+		errs = append(errs, errors.New("REQUEST_TIMEOUT can't be negative"))
+	}
+	if c.HTTP.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("SHUTDOWN_TIMEOUT must be positive"))
+	}
+	if c.HTTP.ShutdownDelay < 0 || c.HTTP.ShutdownDelay >= c.HTTP.ShutdownTimeout {
+		errs = append(errs, errors.New("SHUTDOWN_DELAY must be at least zero and less than SHUTDOWN_TIMEOUT"))
+	}
+	if c.HTTP.ReadinessTimeout <= 0 {
+		errs = append(errs, errors.New("READINESS_TIMEOUT must be positive"))
+	}
+	if c.HTTP.ReadinessCacheTTL < 0 {
+		errs = append(errs, errors.New("READINESS_CACHE_TTL can't be negative"))
+	}
+	for _, cidr := range c.HTTP.TrustedProxies {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			errs = append(errs, fmt.Errorf("TRUSTED_PROXIES entry %q isn't a CIDR", cidr))
+		}
+	}
+	errs = append(errs, c.Database.Validate(), c.Auth.Validate(), c.Kafka.Validate(), c.SMTP.validate(), c.Log.Validate(), c.Tracing.Validate(), c.RateLimit.Validate(), c.Sending.Validate())
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return nil
+}
+
+func (s *SMTP) validate() error {
+	if s.Host == "" {
+		return nil
+	}
+	var errs []error
+	if s.Port < 1 || s.Port > 65535 {
+		errs = append(errs, fmt.Errorf("SMTP_PORT %d is out of range", s.Port))
+	}
+	if _, err := mail.ParseAddress(s.From); err != nil {
+		errs = append(errs, fmt.Errorf("SMTP_FROM %q isn't an email address", s.From))
+	}
+	if s.Username != "" && s.Password == "" {
+		errs = append(errs, errors.New("SMTP_USERNAME is set without SMTP_PASSWORD"))
+	}
+	return errors.Join(errs...)
+}
+
+// Print writes the configuration as YAML, with secrets redacted
+func (c *Config) Print(w io.Writer) error {
+	redacted := *c
+	redact(&redacted)
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&redacted); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
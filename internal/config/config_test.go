@@ -0,0 +1,159 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := vars[key]
+		return value, ok
+	}
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDefaultsAreValid(t *testing.T) {
+	cfg, err := load("", env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.HTTP.Addr != ":8080" || cfg.Database.Port != 5432 || cfg.Kafka.Enabled() {
+		t.Fatalf("cfg = %+v", cfg)
+	}
+}
+
+func TestEnvironmentOverridesFile(t *testing.T) {
+	path := writeFile(t, `
+http:
+  addr: ":9000"
+  request_timeout: 5s
+database:
+  host: file-db
+  max_open_conns: 50
+kafka:
+  brokers: [file-kafka:9092]
+features:
+  require_if_match: true
+`)
+	cfg, err := load(path, env(map[string]string{
+		"DB_HOST":         "env-db",
+		"KAFKA_BROKERS":   "kafka-1:9092, kafka-2:9092",
+		"REQUEST_TIMEOUT": "",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.HTTP.Addr != ":9000" || cfg.HTTP.RequestTimeout != 5*time.Second {
+		t.Fatalf("http = %+v", cfg.HTTP)
+	}
+	if cfg.Database.Host != "env-db" || cfg.Database.MaxOpenConns != 50 || cfg.Database.DBName != "sendpulse" {
+		t.Fatalf("database = %+v", cfg.Database)
+	}
+	if len(cfg.Kafka.Brokers) != 2 || cfg.Kafka.Brokers[1] != "kafka-2:9092" {
+		t.Fatalf("brokers = %q", cfg.Kafka.Brokers)
+	}
+	if !cfg.Features.RequireIfMatch {
+		t.Fatal("features weren't read")
+	}
+}
+
+func TestLoadRejectsBadInput(t *testing.T) {
+	if _, err := load(writeFile(t, "http:\n  adr: \":9000\"\n"), env(nil)); err == nil {
+		t.Fatal("unknown key accepted")
+	}
+	_, err := load("", env(map[string]string{"DB_PORT": "five", "AUTH_ENABLED": "maybe"}))
+	if err == nil || !strings.Contains(err.Error(), "DB_PORT") || !strings.Contains(err.Error(), "AUTH_ENABLED") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestValidateReportsEverySetting(t *testing.T) {
+	cfg, err := load("", env(map[string]string{
+		"HTTP_ADDR":    "8080",
+		"AUTH_ENABLED": "true",
+		"DB_SSLMODE":   "sometimes",
+		"SMTP_HOST":    "smtp.example.com",
+		"SMTP_FROM":    "not an address",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cfg.Validate()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, name := range []string{"HTTP_ADDR", "AUTH_HMAC_SECRET", "DB_SSLMODE", "SMTP_FROM"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("%s isn't reported in %v", name, err)
+		}
+	}
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	cfg, err := load("", env(map[string]string{
+		"DB_PASSWORD":      "hunter2",
+		"AUTH_HMAC_SECRET": "s3cret",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := cfg.Print(&out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "hunter2") || strings.Contains(out.String(), "s3cret") {
+		t.Fatalf("secrets printed:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "request_timeout: 30s") {
+		t.Fatalf("output:\n%s", out.String())
+	}
+	if cfg.Database.Password != "hunter2" {
+		t.Fatal("printing redacted the config itself")
+	}
+
+	// The printed config loads back to the same settings, secrets aside
+	reloaded, err := load(writeFile(t, out.String()), env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(reloaded.HTTP.TrustedProxies, cfg.HTTP.TrustedProxies) {
+		t.Fatalf("reloaded trusted proxies = %q", reloaded.HTTP.TrustedProxies)
+	}
+	reloaded.HTTP.TrustedProxies = cfg.HTTP.TrustedProxies
+	if !reflect.DeepEqual(reloaded.HTTP, cfg.HTTP) || reloaded.Database.Host != cfg.Database.Host {
+		t.Fatalf("reloaded = %+v", reloaded)
+	}
+}
+
+// TestExampleFile keeps config.example.yaml in step with the defaults
+func TestExampleFile(t *testing.T) {
+	cfg, err := load(filepath.Join("..", "..", "config.example.yaml"), env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got, want bytes.Buffer
+	cfg.Print(&got)
+	Default().Print(&want)
+	if got.String() != want.String() {
+		t.Fatalf("config.example.yaml differs from the defaults:\n%s", got.String())
+	}
+}
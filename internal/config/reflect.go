@@ -0,0 +1,99 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// applyEnv sets every field tagged env whose variable is set and not empty
+func applyEnv(cfg *Config, lookupEnv func(string) (string, bool)) error {
+	var errs []error
+	walk(reflect.ValueOf(cfg).Elem(), func(field reflect.StructField, v reflect.Value) {
+		name := field.Tag.Get("env")
+		if name == "" {
+			return
+		}
+		raw, ok := lookupEnv(name)
+		if !ok || raw == "" {
+			return
+		}
+		if err := setValue(v, raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	})
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid environment:\n%w", err)
+	}
+	return nil
+}
+
+func setValue(v reflect.Value, raw string) error {
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("%q isn't a duration, e.g. 30s", raw)
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(raw)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%q isn't true or false", raw)
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%q isn't a whole number", raw)
+		}
+		v.SetInt(int64(n))
+	case v.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("%q isn't a number", raw)
+		}
+		v.SetFloat(f)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		// Lists are comma separated, e.g. KAFKA_BROKERS=kafka-1:9092,kafka-2:9092
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			items = append(items, strings.TrimSpace(item))
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		panic(fmt.Sprintf("config: unsupported field type %s", v.Type()))
+	}
+	return nil
+}
+
+// redact blanks every non-empty field tagged secret
+func redact(cfg *Config) {
+	walk(reflect.ValueOf(cfg).Elem(), func(field reflect.StructField, v reflect.Value) {
+		if field.Tag.Get("secret") == "true" && v.Kind() == reflect.String && v.String() != "" {
+			v.SetString("[redacted]")
+		}
+	})
+}
+
+// walk calls fn for every leaf field of the struct v, depth first
+func walk(v reflect.Value, fn func(field reflect.StructField, v reflect.Value)) {
+	for i := 0; i < v.NumField(); i++ {
+		field, value := v.Type().Field(i), v.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if value.Kind() == reflect.Struct {
+			walk(value, fn)
+			continue
+		}
+		fn(field, value)
+	}
+}
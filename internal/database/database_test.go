@@ -0,0 +1,30 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestConnectionStringEscapesSettings(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.User = "app user"
+	cfg.Password = `p@ss word' dbname=other\`
+	cfg.DBName = "send pulse"
+	cfg.StatementTimeout = 5 * time.Second
+
+	dsn, err := pq.ParseURL(cfg.ConnectionString())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `dbname='send pulse' host='db' password='p@ss word\' dbname=other\\' port='5432' sslmode='disable' statement_timeout='5000' user='app user'`
+	if dsn != want {
+		t.Fatalf("dsn = %s\nwant  %s", dsn, want)
+	}
+
+	cfg.URL = "postgres://elsewhere/db"
+	if got := cfg.ConnectionString(); got != cfg.URL {
+		t.Fatalf("URL not used: %s", got)
+	}
+}
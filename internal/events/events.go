@@ -1,26 +1,103 @@
 package events
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
+
+	"github.com/donnaloia/sendpulse/internal/metrics"
 
 	"github.com/IBM/sarama" // Updated import path
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// Config is the Kafka connection. Publishing is off when no brokers are
+// set.
+type Config struct {
+	Brokers  []string `yaml:"brokers" env:"KAFKA_BROKERS"`
+	ClientID string   `yaml:"client_id" env:"KAFKA_CLIENT_ID"`
+	// CampaignLaunchedTopic receives an event for every launched campaign
+	CampaignLaunchedTopic string `yaml:"campaign_launched_topic" env:"KAFKA_CAMPAIGN_LAUNCHED_TOPIC"`
+	// Timeout bounds each publish, waiting for the brokers' acknowledgement
+	Timeout time.Duration `yaml:"timeout" env:"KAFKA_TIMEOUT"`
+	// OutboxInterval is how often the outbox is checked for launches that
+	// are due. A launch that's due straight away is published as it
+	// commits, so this paces launches held back by their domain's sending
+	// rate and retries while the brokers are down.
+	OutboxInterval time.Duration `yaml:"outbox_interval" env:"KAFKA_OUTBOX_INTERVAL"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		ClientID:              "email-campaign-service",
+		CampaignLaunchedTopic: "campaign.launched",
+		Timeout:               10 * time.Second,
+		OutboxInterval:        5 * time.Second,
+	}
+}
+
+// Enabled reports whether events should be published
+func (c *Config) Enabled() bool {
+	return len(c.Brokers) > 0
+}
+
+func (c *Config) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	var errs []error
+	for _, broker := range c.Brokers {
+		if broker == "" {
+			errs = append(errs, errors.New("KAFKA_BROKERS has an empty entry"))
+		}
+	}
+	if c.CampaignLaunchedTopic == "" {
+		errs = append(errs, errors.New("KAFKA_CAMPAIGN_LAUNCHED_TOPIC is empty"))
+	}
+	if c.Timeout <= 0 {
+		errs = append(errs, errors.New("KAFKA_TIMEOUT must be positive"))
+	}
+	if c.OutboxInterval <= 0 {
+		errs = append(errs, errors.New("KAFKA_OUTBOX_INTERVAL must be positive"))
+	}
+	return errors.Join(errs...)
+}
+
 type EventPublisher struct {
+	client   sarama.Client
 	producer sarama.SyncProducer
+	topic    string
+
+	// ping is the connectivity check in progress, if there is one
+	pingMu sync.Mutex
+	ping   *ping
 }
 
-func NewEventPublisher(brokers []string) (*EventPublisher, error) {
+func NewEventPublisher(cfg *Config) (*EventPublisher, error) {
 	config := sarama.NewConfig()
+	config.ClientID = cfg.ClientID
 	config.Producer.Return.Successes = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Timeout = cfg.Timeout
+	config.Net.DialTimeout = cfg.Timeout
 
-	producer, err := sarama.NewSyncProducer(brokers, config)
+	client, err := sarama.NewClient(cfg.Brokers, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to brokers: %w", err)
+	}
+	producer, err := sarama.NewSyncProducerFromClient(client)
 	if err != nil {
+		client.Close()
 		return nil, fmt.Errorf("failed to create producer: %w", err)
 	}
 
-	return &EventPublisher{producer: producer}, nil
+	return &EventPublisher{client: client, producer: producer, topic: cfg.CampaignLaunchedTopic}, nil
 }
 
 // CampaignLaunchedEvent represents the data structure for a campaign launch
@@ -29,28 +106,126 @@ type CampaignLaunchedEvent struct {
 	OrganizationID string   `json:"organization_id"`
 	EmailAddresses []string `json:"email_addresses"`
 	TemplateIDs    []string `json:"template_ids"`
+	// SendingDomain is the domain to send from. MaxSendRate is how many
+	// messages per second may be sent from it, across every campaign
+	// being sent from it; zero is no limit. Launches from a domain are
+	// published no faster than their recipients can be sent at that rate.
+	SendingDomain string  `json:"sending_domain,omitempty"`
+	MaxSendRate   float64 `json:"max_send_rate,omitempty"`
 }
 
-func (p *EventPublisher) PublishCampaignLaunched(event CampaignLaunchedEvent) error {
+// tracer starts a span for every publish
+var tracer = otel.Tracer("github.com/donnaloia/sendpulse/internal/events")
+
+// PublishCampaignLaunched sends the event and waits for the brokers to
+// acknowledge it. The message carries ctx's trace context in its headers,
+// so the consumer's spans join the launch's trace.
+func (p *EventPublisher) PublishCampaignLaunched(ctx context.Context, event CampaignLaunchedEvent) (err error) {
+	ctx, span := tracer.Start(ctx, p.topic+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			semconv.MessagingOperationTypePublish,
+			semconv.MessagingDestinationName(p.topic),
+			semconv.MessagingKafkaMessageKey(event.CampaignID),
+		),
+	)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
 	payload, err := json.Marshal(event)
 	if err != nil {
 		return fmt.Errorf("error marshaling event: %w", err)
 	}
 
 	msg := &sarama.ProducerMessage{
-		Topic: "campaign.launched",
+		Topic: p.topic,
 		Value: sarama.StringEncoder(payload),
 		Key:   sarama.StringEncoder(event.CampaignID),
 	}
+	otel.GetTextMapPropagator().Inject(ctx, headerCarrier{msg})
 
 	_, _, err = p.producer.SendMessage(msg)
 	if err != nil {
+		metrics.EventsFailed.WithLabelValues(p.topic).Inc()
 		return fmt.Errorf("error publishing event: %w", err)
 	}
+	metrics.EventsPublished.WithLabelValues(p.topic).Inc()
 
 	return nil
 }
 
+// Close waits for messages in flight and disconnects from the brokers
 func (p *EventPublisher) Close() error {
-	return p.producer.Close()
+	return errors.Join(p.producer.Close(), p.client.Close())
+}
+
+type ping struct {
+	done chan struct{}
+	err  error
+}
+
+// Ping checks that the brokers can be reached and know the topic, by
+// fetching its metadata. Concurrent calls share one fetch, so a slow
+// cluster isn't asked again by every caller that gave up waiting.
+func (p *EventPublisher) Ping(ctx context.Context) error {
+	p.pingMu.Lock()
+	current := p.ping
+	if current == nil {
+		current = &ping{done: make(chan struct{})}
+		p.ping = current
+		go func() {
+			current.err = p.client.RefreshMetadata(p.topic)
+			p.pingMu.Lock()
+			p.ping = nil
+			p.pingMu.Unlock()
+			close(current.done)
+		}()
+	}
+	p.pingMu.Unlock()
+
+	select {
+	case <-current.done:
+		return current.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// headerCarrier lets a propagator write trace context into a message's
+// headers, replacing any it already has
+type headerCarrier struct {
+	msg *sarama.ProducerMessage
+}
+
+func (c headerCarrier) Get(key string) string {
+	for _, h := range c.msg.Headers {
+		if string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (c headerCarrier) Set(key, value string) {
+	for i, h := range c.msg.Headers {
+		if string(h.Key) == key {
+			c.msg.Headers[i].Value = []byte(value)
+			return
+		}
+	}
+	c.msg.Headers = append(c.msg.Headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, len(c.msg.Headers))
+	for i, h := range c.msg.Headers {
+		keys[i] = string(h.Key)
+	}
+	return keys
 }
@@ -0,0 +1,52 @@
+package events
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestPublishPropagatesTrace(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var traceparent string
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		for _, h := range msg.Headers {
+			if string(h.Key) == "traceparent" {
+				traceparent = string(h.Value)
+			}
+		}
+		return nil
+	})
+	p := &EventPublisher{producer: producer, topic: "campaign.launched"}
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "launch")
+	if err := p.PublishCampaignLaunched(ctx, CampaignLaunchedEvent{CampaignID: "c1"}); err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+
+	ended := spans.Ended()
+	if len(ended) != 2 || ended[0].Name() != "campaign.launched publish" {
+		t.Fatalf("spans = %v", ended)
+	}
+	publish := ended[0]
+	if publish.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Fatal("publish span isn't a child of the caller's")
+	}
+	// The consumer continues from the publish span
+	if !strings.Contains(traceparent, publish.SpanContext().TraceID().String()) ||
+		!strings.Contains(traceparent, publish.SpanContext().SpanID().String()) {
+		t.Fatalf("traceparent = %q", traceparent)
+	}
+}
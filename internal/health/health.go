@@ -0,0 +1,181 @@
+// Package health reports whether the service is ready for traffic, by
+// checking the things it depends on: the database, its schema, the event
+// brokers and its background workers.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Overall statuses
+const (
+	StatusReady        = "ready"
+	StatusNotReady     = "not_ready"
+	StatusShuttingDown = "shutting_down"
+)
+
+// Component statuses
+const (
+	ComponentOK      = "ok"
+	ComponentFailing = "failing"
+)
+
+// Check returns nil when its component is usable. It must return once ctx
+// is done.
+type Check func(ctx context.Context) error
+
+// Checker runs the readiness checks. Their report is reused for cacheTTL,
+// so frequent polling doesn't load the dependencies, and concurrent polls
+// share one run.
+type Checker struct {
+	// timeout bounds each check
+	timeout  time.Duration
+	cacheTTL time.Duration
+
+	mu           sync.Mutex
+	names        []string
+	checks       map[string]Check
+	shuttingDown func() bool
+
+	// runMu is held while the checks run, and guards the last report
+	runMu    sync.Mutex
+	last     *Report
+	lastTime time.Time
+}
+
+func NewChecker(timeout, cacheTTL time.Duration) *Checker {
+	return &Checker{timeout: timeout, cacheTTL: cacheTTL, checks: map[string]Check{}}
+}
+
+// Add registers the check for a component
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.checks[name]; !ok {
+		c.names = append(c.names, name)
+	}
+	c.checks[name] = check
+}
+
+// SetShuttingDown makes the service not ready while shuttingDown reports
+// true, so load balancers stop sending requests before the server stops
+// taking them
+func (c *Checker) SetShuttingDown(shuttingDown func() bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.shuttingDown = shuttingDown
+}
+
+// Report is the outcome of the checks
+type Report struct {
+	Status     string               `json:"status"`
+	Components map[string]Component `json:"components"`
+}
+
+// Component is the state of one dependency. Only its status is served, as
+// /readyz is unauthenticated; why a check failed is logged instead.
+type Component struct {
+	Status   string        `json:"status"`
+	Error    string        `json:"-"`
+	Duration time.Duration `json:"-"`
+}
+
+// Ready reports whether every check passed
+func (r *Report) Ready() bool {
+	return r.Status == StatusReady
+}
+
+// Check runs every check at once and reports on them, unless they ran less
+// than cacheTTL ago. While shutting down the checks are skipped; what they
+// check is being stopped.
+func (c *Checker) Check(ctx context.Context) *Report {
+	c.mu.Lock()
+	names := append([]string(nil), c.names...)
+	checks := make([]Check, len(names))
+	for i, name := range names {
+		checks[i] = c.checks[name]
+	}
+	shuttingDown := c.shuttingDown
+	c.mu.Unlock()
+
+	if shuttingDown != nil && shuttingDown() {
+		return &Report{Status: StatusShuttingDown, Components: map[string]Component{}}
+	}
+
+	c.runMu.Lock()
+	defer c.runMu.Unlock()
+	if c.last != nil && time.Since(c.lastTime) < c.cacheTTL {
+		return c.last
+	}
+	// The report is shared, so one poller going away mustn't fail it
+	ctx = context.WithoutCancel(ctx)
+
+	report := &Report{Status: StatusReady, Components: map[string]Component{}}
+	results := make([]Component, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.run(ctx, names[i], check)
+		}()
+	}
+	wg.Wait()
+
+	for i, name := range names {
+		report.Components[name] = results[i]
+		if results[i].Status != ComponentOK {
+			report.Status = StatusNotReady
+		}
+	}
+	c.last, c.lastTime = report, time.Now()
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, name string, check Check) Component {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	result := Component{Status: ComponentOK, Duration: time.Since(start)}
+	if err != nil {
+		result.Status = ComponentFailing
+		result.Error = err.Error()
+		slog.WarnContext(ctx, "readiness check failed", "component", name, "error", err, "duration", result.Duration)
+	}
+	return result
+}
+
+// Heartbeat tracks a background worker that's meant to Beat at least every
+// maxAge. Its Check fails once the worker has gone quiet.
+type Heartbeat struct {
+	maxAge time.Duration
+	last   atomic.Int64
+}
+
+func NewHeartbeat(maxAge time.Duration) *Heartbeat {
+	return &Heartbeat{maxAge: maxAge}
+}
+
+// Beat records that the worker is alive
+func (h *Heartbeat) Beat() {
+	h.last.Store(time.Now().UnixNano())
+}
+
+func (h *Heartbeat) Check(ctx context.Context) error {
+	last := h.last.Load()
+	if last == 0 {
+		return errors.New("no heartbeat yet")
+	}
+	if age := time.Since(time.Unix(0, last)); age > h.maxAge {
+		return fmt.Errorf("last heartbeat %s ago", age.Round(time.Second))
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	c := NewChecker(20*time.Millisecond, 0)
+	c.Add("database", func(ctx context.Context) error { return nil })
+	c.Add("kafka", func(ctx context.Context) error { return errors.New("no brokers") })
+	c.Add("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	report := c.Check(context.Background())
+	if report.Ready() || report.Status != StatusNotReady {
+		t.Fatalf("status = %s", report.Status)
+	}
+	if got := report.Components["database"]; got.Status != ComponentOK || got.Error != "" {
+		t.Fatalf("database = %+v", got)
+	}
+	if got := report.Components["kafka"]; got.Status != ComponentFailing || got.Error != "no brokers" {
+		t.Fatalf("kafka = %+v", got)
+	}
+	if got := report.Components["slow"]; got.Status != ComponentFailing || got.Error != context.DeadlineExceeded.Error() {
+		t.Fatalf("slow = %+v", got)
+	}
+}
+
+func TestCheckReusesRecentResults(t *testing.T) {
+	c := NewChecker(time.Second, time.Hour)
+	runs := 0
+	var err error
+	c.Add("database", func(ctx context.Context) error { runs++; return err })
+
+	if report := c.Check(context.Background()); !report.Ready() {
+		t.Fatalf("status = %s", report.Status)
+	}
+	err = errors.New("down")
+	if report := c.Check(context.Background()); !report.Ready() || runs != 1 {
+		t.Fatalf("status = %s after %d runs", report.Status, runs)
+	}
+
+	c.lastTime = time.Now().Add(-time.Hour)
+	if report := c.Check(context.Background()); report.Ready() || runs != 2 {
+		t.Fatalf("status = %s after %d runs", report.Status, runs)
+	}
+}
+
+func TestNotReadyWhileShuttingDown(t *testing.T) {
+	c := NewChecker(time.Second, 0)
+	checked := false
+	c.Add("database", func(ctx context.Context) error { checked = true; return nil })
+	shuttingDown := false
+	c.SetShuttingDown(func() bool { return shuttingDown })
+
+	if report := c.Check(context.Background()); !report.Ready() {
+		t.Fatalf("status = %s", report.Status)
+	}
+	shuttingDown, checked = true, false
+	if report := c.Check(context.Background()); report.Status != StatusShuttingDown || checked {
+		t.Fatalf("status = %s, checked = %t", report.Status, checked)
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	h := NewHeartbeat(time.Minute)
+	if err := h.Check(context.Background()); err == nil {
+		t.Fatal("ready before the first beat")
+	}
+	h.Beat()
+	if err := h.Check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	h.last.Store(time.Now().Add(-2 * time.Minute).UnixNano())
+	if err := h.Check(context.Background()); err == nil {
+		t.Fatal("ready after the worker went quiet")
+	}
+}
@@ -0,0 +1,83 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps records in process memory, so it only catches
+// duplicates sent to the same process. It suits tests and single
+// instances.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]memoryRecord
+}
+
+type memoryRecord struct {
+	Record
+	expiresAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		records: map[string]memoryRecord{},
+	}
+}
+
+func memoryKey(scope, key string) string {
+	return scope + "\x00" + key
+}
+
+func (s *MemoryStore) Claim(ctx context.Context, scope, key, requestHash string, lease time.Duration) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := memoryKey(scope, key)
+	if rec, ok := s.records[k]; ok && time.Now().Before(rec.expiresAt) {
+		return &rec.Record, nil
+	}
+	s.records[k] = memoryRecord{Record: Record{RequestHash: requestHash}, expiresAt: time.Now().Add(lease)}
+	return nil, nil
+}
+
+func (s *MemoryStore) Complete(ctx context.Context, scope, key string, rec *Record, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := memoryKey(scope, key)
+	if claim, ok := s.records[k]; !ok || !claim.InProgress() || claim.RequestHash != rec.RequestHash {
+		return nil
+	}
+	stored := *rec
+	if stored.Redacted {
+		stored.Body = nil
+	}
+	s.records[k] = memoryRecord{Record: stored, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, scope, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := memoryKey(scope, key)
+	if rec, ok := s.records[k]; ok && rec.InProgress() {
+		delete(s.records, k)
+	}
+	return nil
+}
+
+// Purge deletes expired records
+func (s *MemoryStore) Purge(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for k, rec := range s.records {
+		if !now.Before(rec.expiresAt) {
+			delete(s.records, k)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/donnaloia/sendpulse/internal/auth"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// Header is the request header carrying the client's key
+	Header = "Idempotency-Key"
+	// ReplayedHeader is set on responses served from the store
+	ReplayedHeader = "Idempotent-Replayed"
+
+	// TTL is how long a response can be replayed
+	TTL = 24 * time.Hour
+
+	maxKeyLength  = 255
+	purgeInterval = time.Hour
+
+	// A claim outlasts the request timeout by claimMargin, or lasts
+	// maxClaimLease when requests have no timeout
+	claimMargin   = time.Minute
+	maxClaimLease = 10 * time.Minute
+
+	secretKey = "idempotency.secret"
+)
+
+// MarkSecret tells the middleware the response carries a secret, such as a
+// key that's only shown once. Its body isn't stored, and a retry with the
+// same key gets 409 rather than the secret again.
+func MarkSecret(c echo.Context) {
+	c.Set(secretKey, true)
+}
+
+// Middleware makes POST and PATCH requests carrying an Idempotency-Key safe
+// to retry, e.g. a campaign launch, which is a status PATCH. Keys are scoped
+// to the organization in the path. The first successful response for a key
+// is stored and replayed for later requests with the same key from the same
+// caller to the same endpoint with the same body; reusing a key for any
+// other request is rejected with 422, and a duplicate of a request that's
+// still running with 409.
+// Error responses aren't stored, so a failed request can be retried with
+// the same key. requestTimeout bounds how long a request holds its key.
+func Middleware(store Store, requestTimeout time.Duration) echo.MiddlewareFunc {
+	var lastPurge atomic.Int64
+	lease := maxClaimLease
+	if requestTimeout > 0 {
+		lease = requestTimeout + claimMargin
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get(Header)
+			if key == "" || !idempotentMethods[c.Request().Method] {
+				return next(c)
+			}
+			if len(key) > maxKeyLength {
+				return echo.NewHTTPError(http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+			}
+
+			hash, err := requestHash(c)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			}
+
+			ctx := c.Request().Context()
+			scope := requestScope(c)
+
+			rec, err := store.Claim(ctx, scope, key, hash, lease)
+			if err != nil {
+				return err
+			}
+			if rec != nil {
+				switch {
+				case rec.RequestHash != hash:
+					return echo.NewHTTPError(http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+				case rec.InProgress():
+					return echo.NewHTTPError(http.StatusConflict, "a request with this Idempotency-Key is still in progress")
+				case rec.Redacted:
+					return echo.NewHTTPError(http.StatusConflict, "the response to this Idempotency-Key held a secret and can't be replayed")
+				}
+				c.Response().Header().Set(ReplayedHeader, "true")
+				return c.Blob(rec.StatusCode, rec.ContentType, rec.Body)
+			}
+
+			// The request may be cancelled by the time it's done, but its
+			// key still needs completing or releasing
+			storeCtx := context.WithoutCancel(ctx)
+			completed := false
+			defer func() {
+				if completed {
+					return
+				}
+				if err := store.Release(storeCtx, scope, key); err != nil {
+					slog.ErrorContext(storeCtx, "error releasing idempotency key", "error", err)
+				}
+			}()
+
+			// Run the request, keeping a copy of what it writes
+			res := c.Response()
+			recorder := &responseRecorder{ResponseWriter: res.Writer}
+			res.Writer = recorder
+			err = next(c)
+			res.Writer = recorder.ResponseWriter
+			if err != nil || res.Status < 200 || res.Status >= 300 {
+				return err
+			}
+
+			rec = &Record{
+				RequestHash: hash,
+				StatusCode:  res.Status,
+				ContentType: res.Header().Get(echo.HeaderContentType),
+				Body:        recorder.body.Bytes(),
+			}
+			if secret, _ := c.Get(secretKey).(bool); secret {
+				rec.Body = nil
+				rec.Redacted = true
+			}
+			completed = true
+			if err := store.Complete(storeCtx, scope, key, rec, TTL); err != nil {
+				// The change itself went through; only a retry would
+				// repeat it. Don't turn a success into an error.
+				slog.ErrorContext(storeCtx, "error saving idempotent response", "error", err)
+			}
+
+			if now := time.Now().Unix(); now-lastPurge.Load() > int64(purgeInterval.Seconds()) {
+				lastPurge.Store(now)
+				if err := store.Purge(storeCtx); err != nil {
+					slog.ErrorContext(storeCtx, "error purging idempotency keys", "error", err)
+				}
+			}
+			return nil
+		}
+	}
+}
+
+// idempotentMethods are the methods whose requests honour a key
+var idempotentMethods = map[string]bool{
+	http.MethodPost:  true,
+	http.MethodPatch: true,
+}
+
+// requestScope is the organization in the path, or "" for routes outside
+// an organization. IDs are UUIDs, which compare case-insensitively.
+func requestScope(c echo.Context) string {
+	return strings.ToLower(c.Param("organization_id"))
+}
+
+// requestHash identifies a request by caller, method, path and body, so a
+// key reused by another caller or on another endpoint is a different
+// request, and puts the body back for the handler. Anonymous requests share
+// one caller.
+func requestHash(c echo.Context) (string, error) {
+	req := c.Request()
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return "", err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	caller := "anonymous"
+	if principal, ok := auth.FromEcho(c); ok {
+		caller = principal.Type + ":" + principal.Subject
+	}
+	h := sha256.New()
+	io.WriteString(h, caller+"\n"+req.Method+" "+req.URL.Path+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
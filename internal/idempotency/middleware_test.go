@@ -0,0 +1,168 @@
+package idempotency
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/donnaloia/sendpulse/internal/auth"
+
+	"github.com/labstack/echo/v4"
+)
+
+type testApp struct {
+	e       *echo.Echo
+	store   *MemoryStore
+	handler echo.HandlerFunc
+	runs    atomic.Int32
+}
+
+// newTestApp runs next behind the middleware, counting the requests that
+// get past it
+func newTestApp(next func(c echo.Context) error) *testApp {
+	app := &testApp{e: echo.New(), store: NewMemoryStore()}
+	app.handler = Middleware(app.store, 0)(func(c echo.Context) error {
+		app.runs.Add(1)
+		return next(c)
+	})
+	return app
+}
+
+func (app *testApp) post(path, subject, key, body string) (*httptest.ResponseRecorder, error) {
+	return app.do(http.MethodPost, testOrg, path, subject, key, body)
+}
+
+// testOrg is the organization requests are sent to unless they say
+// otherwise
+const testOrg = "3f2a0000-0000-4000-8000-000000000001"
+
+func (app *testApp) do(method, org, path, subject, key, body string) (*httptest.ResponseRecorder, error) {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set(Header, key)
+	rec := httptest.NewRecorder()
+	c := app.e.NewContext(req, rec)
+	c.SetParamNames("organization_id")
+	c.SetParamValues(org)
+	if subject != "" {
+		c.Set(auth.ContextKey, &auth.Principal{Type: auth.PrincipalUser, Subject: subject})
+	}
+	return rec, app.handler(c)
+}
+
+func statusOf(err error) int {
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		return he.Code
+	}
+	return 0
+}
+
+func TestMiddlewareScopesKeysToOrganization(t *testing.T) {
+	app := newTestApp(func(c echo.Context) error {
+		return c.String(http.StatusCreated, "created")
+	})
+
+	if _, err := app.post("/groups", "user-1", "k", "{}"); err != nil {
+		t.Fatal(err)
+	}
+	rec, err := app.post("/groups", "user-1", "k", "{}")
+	if err != nil || rec.Header().Get(ReplayedHeader) != "true" || rec.Body.String() != "created" {
+		t.Fatalf("replay: %v %v %q", err, rec.Header(), rec.Body)
+	}
+
+	// Within the organization the key is spent on that request: another
+	// body, caller, method or endpoint is a different request
+	for _, r := range []struct{ method, path, subject, body string }{
+		{http.MethodPost, "/groups", "user-1", `{"name":"other"}`},
+		{http.MethodPost, "/groups", "user-2", "{}"},
+		{http.MethodPost, "/groups", "", "{}"},
+		{http.MethodPatch, "/groups", "user-1", "{}"},
+		{http.MethodPost, "/templates", "user-1", "{}"},
+	} {
+		if _, err := app.do(r.method, testOrg, r.path, r.subject, "k", r.body); statusOf(err) != http.StatusUnprocessableEntity {
+			t.Fatalf("%s %s as %q: %v", r.method, r.path, r.subject, err)
+		}
+	}
+
+	// Another organization doesn't share the key, however its ID is cased
+	other := "3F2A0000-0000-4000-8000-000000000002"
+	for _, org := range []string{other, strings.ToLower(other)} {
+		rec, err := app.do(http.MethodPost, org, "/groups", "user-1", "k", "{}")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if replayed := rec.Header().Get(ReplayedHeader) == "true"; replayed != (org != other) {
+			t.Fatalf("%s: replayed %v", org, replayed)
+		}
+	}
+	if n := app.runs.Load(); n != 2 {
+		t.Fatalf("ran %d requests", n)
+	}
+}
+
+func TestMiddlewareRefusesDuplicatesInProgress(t *testing.T) {
+	var app *testApp
+	var inner error
+	app = newTestApp(func(c echo.Context) error {
+		// A duplicate arriving while this one runs
+		_, inner = app.post("/groups", "user-1", "k", "{}")
+		return c.String(http.StatusCreated, "created")
+	})
+
+	if _, err := app.post("/groups", "user-1", "k", "{}"); err != nil {
+		t.Fatal(err)
+	}
+	if statusOf(inner) != http.StatusConflict {
+		t.Fatalf("duplicate in progress: %v", inner)
+	}
+	if n := app.runs.Load(); n != 1 {
+		t.Fatalf("ran %d requests", n)
+	}
+}
+
+func TestMiddlewareReleasesKeysOfFailedRequests(t *testing.T) {
+	fail := true
+	app := newTestApp(func(c echo.Context) error {
+		if fail {
+			return echo.NewHTTPError(http.StatusServiceUnavailable)
+		}
+		return c.String(http.StatusCreated, "created")
+	})
+
+	if _, err := app.post("/groups", "user-1", "k", "{}"); statusOf(err) != http.StatusServiceUnavailable {
+		t.Fatalf("err = %v", err)
+	}
+	fail = false
+	if _, err := app.post("/groups", "user-1", "k", "{}"); err != nil {
+		t.Fatalf("retry after a failure: %v", err)
+	}
+	if n := app.runs.Load(); n != 2 {
+		t.Fatalf("ran %d requests", n)
+	}
+}
+
+func TestMiddlewareDoesNotStoreSecrets(t *testing.T) {
+	app := newTestApp(func(c echo.Context) error {
+		MarkSecret(c)
+		return c.String(http.StatusCreated, "sk_live_secret")
+	})
+
+	rec, err := app.post("/api-keys", "user-1", "k", "{}")
+	if err != nil || rec.Body.String() != "sk_live_secret" {
+		t.Fatalf("first: %v %q", err, rec.Body)
+	}
+	if _, err := app.post("/api-keys", "user-1", "k", "{}"); statusOf(err) != http.StatusConflict {
+		t.Fatalf("replay: %v", err)
+	}
+	if n := app.runs.Load(); n != 1 {
+		t.Fatalf("ran %d requests", n)
+	}
+	for _, r := range app.store.records {
+		if !r.Redacted || r.Body != nil {
+			t.Fatalf("stored %+v", r.Record)
+		}
+	}
+}
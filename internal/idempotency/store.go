@@ -0,0 +1,156 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Record is a stored response, or the claim of a request that's still
+// running
+type Record struct {
+	RequestHash string
+	// StatusCode is zero while the request is in progress
+	StatusCode  int
+	ContentType string
+	Body        []byte
+	// Redacted is set when the response held a secret, so its body wasn't
+	// kept and it can't be replayed
+	Redacted bool
+}
+
+// InProgress reports whether the request holding the key hasn't finished
+func (r *Record) InProgress() bool {
+	return r.StatusCode == 0
+}
+
+// Store keeps responses by scope and key. Claim takes a free key for a
+// request about to run, so a duplicate sent while the first is still
+// running finds its claim instead of running again. Complete replaces the
+// claim with the response, and Release gives the key up when there's no
+// response worth keeping. A claim lapses after its lease, so one left by an
+// instance that died mid-request doesn't hold the key forever.
+type Store interface {
+	// Claim returns nil once the key is claimed, or the record already
+	// holding it
+	Claim(ctx context.Context, scope, key, requestHash string, lease time.Duration) (*Record, error)
+	Complete(ctx context.Context, scope, key string, rec *Record, ttl time.Duration) error
+	Release(ctx context.Context, scope, key string) error
+	Purge(ctx context.Context) error
+}
+
+// PostgresStore keeps records in the idempotency_keys table, so duplicates
+// are caught across every instance of the service. Claims are rows, so no
+// connection is held while a request runs.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// maxClaimAttempts bounds retries when the record holding a key goes away
+// between trying to claim it and reading it
+const maxClaimAttempts = 3
+
+// Claim inserts a record without a response, taking over an expired record
+// for the same key
+func (s *PostgresStore) Claim(ctx context.Context, scope, key, requestHash string, lease time.Duration) (*Record, error) {
+	for range maxClaimAttempts {
+		res, err := s.db.ExecContext(ctx,
+			`INSERT INTO idempotency_keys (scope, key, request_hash, expires_at)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (scope, key) DO UPDATE SET
+				request_hash = EXCLUDED.request_hash,
+				status_code = NULL,
+				content_type = '',
+				response_body = NULL,
+				redacted = false,
+				created_at = CURRENT_TIMESTAMP,
+				expires_at = EXCLUDED.expires_at
+			WHERE idempotency_keys.expires_at <= CURRENT_TIMESTAMP`,
+			scope, key, requestHash, time.Now().Add(lease),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error claiming idempotency key: %w", err)
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return nil, fmt.Errorf("error claiming idempotency key: %w", err)
+		} else if n == 1 {
+			return nil, nil
+		}
+
+		rec, err := s.get(ctx, scope, key)
+		if err != nil || rec != nil {
+			return rec, err
+		}
+		// Released or lapsed since the insert; try again
+	}
+	return nil, errors.New("error claiming idempotency key: it keeps being released")
+}
+
+func (s *PostgresStore) get(ctx context.Context, scope, key string) (*Record, error) {
+	var rec Record
+	var statusCode sql.NullInt64
+	err := s.db.QueryRowContext(ctx,
+		`SELECT request_hash, status_code, content_type, response_body, redacted
+		FROM idempotency_keys
+		WHERE scope = $1 AND key = $2 AND expires_at > CURRENT_TIMESTAMP`,
+		scope, key,
+	).Scan(&rec.RequestHash, &statusCode, &rec.ContentType, &rec.Body, &rec.Redacted)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching idempotency key: %w", err)
+	}
+	rec.StatusCode = int(statusCode.Int64)
+	return &rec, nil
+}
+
+// Complete stores the response in place of the key's claim. A redacted
+// record keeps no body.
+func (s *PostgresStore) Complete(ctx context.Context, scope, key string, rec *Record, ttl time.Duration) error {
+	body := rec.Body
+	if rec.Redacted {
+		body = nil
+	}
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE idempotency_keys SET
+			status_code = $4,
+			content_type = $5,
+			response_body = $6,
+			redacted = $7,
+			expires_at = $8
+		WHERE scope = $1 AND key = $2 AND request_hash = $3 AND status_code IS NULL`,
+		scope, key, rec.RequestHash, rec.StatusCode, rec.ContentType, body, rec.Redacted, time.Now().Add(ttl),
+	)
+	if err != nil {
+		return fmt.Errorf("error saving idempotency key: %w", err)
+	}
+	return nil
+}
+
+// Release deletes the key's claim
+func (s *PostgresStore) Release(ctx context.Context, scope, key string) error {
+	_, err := s.db.ExecContext(ctx,
+		"DELETE FROM idempotency_keys WHERE scope = $1 AND key = $2 AND status_code IS NULL",
+		scope, key,
+	)
+	if err != nil {
+		return fmt.Errorf("error releasing idempotency key: %w", err)
+	}
+	return nil
+}
+
+// Purge deletes expired records
+func (s *PostgresStore) Purge(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE expires_at <= CURRENT_TIMESTAMP")
+	if err != nil {
+		return fmt.Errorf("error purging idempotency keys: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+// Package lifecycle runs the server's components and shuts them down in
+// order when the process is told to stop.
+//
+// Components are stopped in the reverse of the order they were added, like
+// deferred calls: add what everything else depends on (the database) first
+// and what takes traffic (the HTTP server) last, and the server stops
+// accepting requests before the things its requests use go away.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Component is a part of the process with a lifetime of its own. Either
+// function may be nil.
+type Component struct {
+	Name string
+	// Run does the component's work until ctx is cancelled or Stop is
+	// called. Returning early, with or without an error, shuts the whole
+	// process down.
+	Run func(ctx context.Context) error
+	// Stop releases the component, within ctx's deadline
+	Stop func(ctx context.Context) error
+}
+
+// Manager runs components until a signal arrives or one of them fails
+type Manager struct {
+	// timeout bounds the whole shutdown
+	timeout time.Duration
+
+	mu           sync.Mutex
+	components   []Component
+	shuttingDown atomic.Bool
+}
+
+func New(timeout time.Duration) *Manager {
+	return &Manager{timeout: timeout}
+}
+
+// Add registers a component. It must be called before Run.
+func (m *Manager) Add(c Component) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.components = append(m.components, c)
+}
+
+// ShuttingDown reports whether shutdown has begun
+func (m *Manager) ShuttingDown() bool {
+	return m.shuttingDown.Load()
+}
+
+// Run starts every component and blocks until SIGINT or SIGTERM, ctx being
+// cancelled, or a component's Run returning. It then stops the components
+// and returns the first error from any of them.
+func (m *Manager) Run(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	m.mu.Lock()
+	components := make([]*running, len(m.components))
+	for i, c := range m.components {
+		components[i] = &running{Component: c}
+	}
+	m.mu.Unlock()
+
+	exited := make(chan *running, len(components))
+	for _, c := range components {
+		c.start(exited)
+	}
+
+	var errs []error
+	select {
+	case <-ctx.Done():
+		slog.Info("shutting down", "reason", context.Cause(ctx))
+	case c := <-exited:
+		if c.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c.Name, c.err))
+			slog.Error("shutting down", "reason", "component failed", "component", c.Name, "error", c.err)
+		} else {
+			slog.Info("shutting down", "reason", "component stopped", "component", c.Name)
+		}
+		// Its error is reported; don't report it again when it's stopped
+		c.err = nil
+	}
+	stop()
+
+	return errors.Join(append(errs, m.shutdown(components))...)
+}
+
+// shutdown stops the components newest first, sharing one deadline. Each
+// has its Run cancelled, then its Stop called, and is waited for before the
+// next one is stopped. A component that fails to stop is logged and doesn't
+// hold up the rest.
+func (m *Manager) shutdown(components []*running) error {
+	m.shuttingDown.Store(true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+
+	var errs []error
+	for i := len(components) - 1; i >= 0; i-- {
+		c := components[i]
+		start := time.Now()
+		if err := c.stop(ctx); err != nil {
+			slog.Error("error stopping component", "component", c.Name, "error", err)
+			errs = append(errs, fmt.Errorf("stopping %s: %w", c.Name, err))
+			continue
+		}
+		slog.Info("stopped component", "component", c.Name, "duration", time.Since(start))
+	}
+	return errors.Join(errs...)
+}
+
+// running is a component that has been started
+type running struct {
+	Component
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+func (r *running) start(exited chan<- *running) {
+	if r.Run == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.done = make(chan struct{})
+	go func() {
+		r.err = r.Run(ctx)
+		close(r.done)
+		exited <- r
+	}()
+}
+
+func (r *running) stop(ctx context.Context) error {
+	if r.cancel != nil {
+		r.cancel()
+	}
+	var errs []error
+	if r.Stop != nil {
+		errs = append(errs, r.Stop(ctx))
+	}
+	if r.done != nil {
+		select {
+		case <-r.done:
+			errs = append(errs, r.err)
+		case <-ctx.Done():
+			errs = append(errs, errors.New("still running at the shutdown deadline"))
+		}
+	}
+	return errors.Join(errs...)
+}
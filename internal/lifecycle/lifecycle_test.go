@@ -0,0 +1,126 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder collects the order things happen in
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) add(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recorder) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return strings.Join(r.events, ",")
+}
+
+func TestStopsInReverseOrder(t *testing.T) {
+	var r recorder
+	m := New(time.Second)
+	m.Add(Component{
+		Name: "db",
+		Stop: func(ctx context.Context) error { r.add("db closed"); return nil },
+	})
+	m.Add(Component{
+		Name: "worker",
+		Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			r.add("worker stopped")
+			return nil
+		},
+	})
+	serverStopped := make(chan struct{})
+	m.Add(Component{
+		Name: "server",
+		Run: func(ctx context.Context) error {
+			<-serverStopped
+			r.add("server stopped")
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			if !m.ShuttingDown() {
+				t.Error("not shutting down while stopping")
+			}
+			r.add("server draining")
+			close(serverStopped)
+			return nil
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if err := m.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.String(); got != "server draining,server stopped,worker stopped,db closed" {
+		t.Fatalf("order = %s", got)
+	}
+}
+
+func TestFailingComponentShutsDown(t *testing.T) {
+	var r recorder
+	m := New(time.Second)
+	m.Add(Component{
+		Name: "db",
+		Stop: func(ctx context.Context) error { r.add("db closed"); return nil },
+	})
+	m.Add(Component{
+		Name: "worker",
+		Run:  func(ctx context.Context) error { return errors.New("boom") },
+	})
+
+	err := m.Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "worker: boom") || strings.Count(err.Error(), "boom") != 1 {
+		t.Fatalf("err = %v", err)
+	}
+	if r.String() != "db closed" {
+		t.Fatalf("order = %s", r.String())
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	var r recorder
+	m := New(20 * time.Millisecond)
+	m.Add(Component{
+		Name: "db",
+		Stop: func(ctx context.Context) error { r.add("db closed"); return nil },
+	})
+	m.Add(Component{
+		Name: "stuck",
+		Run: func(ctx context.Context) error {
+			time.Sleep(time.Second)
+			return nil
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	err := m.Run(ctx)
+	if err == nil || !strings.Contains(err.Error(), "stopping stuck") {
+		t.Fatalf("err = %v", err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatal("shutdown waited past its deadline")
+	}
+	// What's left is still stopped, however short of time
+	if r.String() != "db closed" {
+		t.Fatalf("order = %s", r.String())
+	}
+}
@@ -0,0 +1,127 @@
+// Package logging sets up the service's structured logs. Lines are written
+// with log/slog and pick up the attributes of the request they're logged
+// for, such as its request ID, from the context:
+//
+//	slog.InfoContext(ctx, "campaign launched", "campaign_id", id)
+//
+// Attributes are added to a request's context with NewContext and AddAttrs.
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+)
+
+// Attribute keys shared across packages, so the same thing is always logged
+// under the same name
+const (
+	KeyRequestID      = "request_id"
+	KeyOrganizationID = "organization_id"
+	KeyTraceID        = "trace_id"
+)
+
+type Config struct {
+	// Level is debug, info, warn or error
+	Level string `yaml:"level" env:"LOG_LEVEL"`
+	// Format is json, or text for reading locally
+	Format string `yaml:"format" env:"LOG_FORMAT"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Level:  "info",
+		Format: "json",
+	}
+}
+
+func (c *Config) Validate() error {
+	var errs []error
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Level)); err != nil {
+		errs = append(errs, fmt.Errorf("LOG_LEVEL %q isn't debug, info, warn or error", c.Level))
+	}
+	if c.Format != "json" && c.Format != "text" {
+		errs = append(errs, fmt.Errorf("LOG_FORMAT %q isn't json or text", c.Format))
+	}
+	return errors.Join(errs...)
+}
+
+// New returns a logger writing to w as configured. cfg must be valid.
+func New(cfg *Config, w io.Writer) *slog.Logger {
+	var level slog.Level
+	level.UnmarshalText([]byte(cfg.Level))
+	opts := &slog.HandlerOptions{Level: level}
+
+	var h slog.Handler
+	if cfg.Format == "text" {
+		h = slog.NewTextHandler(w, opts)
+	} else {
+		h = slog.NewJSONHandler(w, opts)
+	}
+	return slog.New(contextHandler{h})
+}
+
+// Setup makes New's logger the default, for slog and the log package
+func Setup(cfg *Config, w io.Writer) {
+	slog.SetDefault(New(cfg, w))
+}
+
+// contextHandler adds the attributes carried by the context to each record
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	r.AddAttrs(Attrs(ctx)...)
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+type attrsKey struct{}
+
+// contextAttrs can be added to after the context is made, so middleware
+// further down a request's chain can add attributes that the lines logged
+// further up, e.g. the access log, carry too
+type contextAttrs struct {
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+// NewContext returns a copy of ctx whose log lines carry attrs, along with
+// those of ctx
+func NewContext(ctx context.Context, attrs ...slog.Attr) context.Context {
+	return context.WithValue(ctx, attrsKey{}, &contextAttrs{attrs: append(Attrs(ctx), attrs...)})
+}
+
+// AddAttrs adds attrs to the lines logged with ctx and every context derived
+// from the one NewContext returned. It does nothing to a context without
+// one.
+func AddAttrs(ctx context.Context, attrs ...slog.Attr) {
+	if a, ok := ctx.Value(attrsKey{}).(*contextAttrs); ok {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		a.attrs = append(a.attrs, attrs...)
+	}
+}
+
+// Attrs returns the attributes ctx's log lines carry
+func Attrs(ctx context.Context) []slog.Attr {
+	a, ok := ctx.Value(attrsKey{}).(*contextAttrs)
+	if !ok {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]slog.Attr(nil), a.attrs...)
+}
@@ -0,0 +1,42 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestContextAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&Config{Level: "info", Format: "json"}, &buf)
+
+	ctx := NewContext(context.Background(), slog.String(KeyRequestID, "req-1"))
+	// Added further down the request, after the context was derived from
+	child, cancel := context.WithCancel(ctx)
+	defer cancel()
+	AddAttrs(child, slog.String(KeyOrganizationID, "org-1"))
+
+	logger.InfoContext(ctx, "request", "status", 200)
+	logger.DebugContext(ctx, "not logged")
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("%v: %s", err, buf.String())
+	}
+	if line["msg"] != "request" || line[KeyRequestID] != "req-1" || line[KeyOrganizationID] != "org-1" || line["status"] != float64(200) {
+		t.Fatalf("line = %v", line)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := DefaultConfig()
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	cfg = Config{Level: "loud", Format: "xml"}
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,119 @@
+// Package metrics is the service's Prometheus instrumentation, served at
+// /metrics. Metrics live in Registry rather than the global default so only
+// what's declared here (plus the Go runtime and process) is exported.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "sendpulse"
+
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	// Export both outcomes from the start, so rates and alerts on them work
+	// before the first import
+	for _, outcome := range []string{ImportSucceeded, ImportFailed} {
+		ImportsProcessed.WithLabelValues(outcome)
+	}
+}
+
+// Outcomes of an import
+const (
+	ImportSucceeded = "succeeded"
+	ImportFailed    = "failed"
+)
+
+// ImportFinished counts an import, failed if err isn't nil
+func ImportFinished(err error) {
+	outcome := ImportSucceeded
+	if err != nil {
+		outcome = ImportFailed
+	}
+	ImportsProcessed.WithLabelValues(outcome).Inc()
+}
+
+var (
+	// HTTPRequestDuration is labelled by the route pattern, not the
+	// requested path, so IDs don't each get a series
+	HTTPRequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Time taken to answer HTTP requests, by route pattern and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	CampaignsLaunched = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "campaigns_launched_total",
+		Help:      "Campaigns launched.",
+	})
+
+	// RecipientsEnqueued counts addresses handed to the sending service in
+	// launch events
+	RecipientsEnqueued = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "recipients_enqueued_total",
+		Help:      "Recipients of launched campaigns handed to the sending service.",
+	})
+
+	// LaunchesOverQuota counts launches refused for having more recipients
+	// than the organization's daily or monthly quota has left
+	LaunchesOverQuota = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "launches_over_quota_total",
+		Help:      "Campaign launches refused for exceeding a sending quota, by quota.",
+	}, []string{"quota"})
+
+	// ImportsProcessed counts imports as they finish, by outcome. Nothing
+	// imports yet, so it stays at zero until an import path calls
+	// ImportFinished.
+	ImportsProcessed = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "imports_processed_total",
+		Help:      "Imports finished, by outcome.",
+	}, []string{"outcome"})
+
+	RateLimited = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_requests_total",
+		Help:      "Requests refused by the rate limiter, by plan.",
+	}, []string{"plan"})
+
+	EventsPublished = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_published_total",
+		Help:      "Events published to Kafka, by topic.",
+	}, []string{"topic"})
+
+	EventsFailed = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_failed_total",
+		Help:      "Events that couldn't be published to Kafka, by topic.",
+	}, []string{"topic"})
+)
+
+// RegisterDB exports db's connection pool stats as go_sql_* metrics. It can
+// only be called once per pool.
+func RegisterDB(db *sql.DB, name string) error {
+	return Registry.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// Handler serves Registry in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
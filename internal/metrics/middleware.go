@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// statusClientClosed is recorded for requests whose client went away before
+// they were answered, as nginx does
+const statusClientClosed = 499
+
+// Middleware times every request into HTTPRequestDuration. It belongs first
+// in the chain so the time includes the other middleware.
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+			if err != nil && !c.Response().Committed {
+				// Render the error now so the status it's answered with
+				// is the one recorded
+				c.Error(err)
+			}
+
+			status := c.Response().Status
+			if !c.Response().Committed {
+				status = statusClientClosed
+			}
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			HTTPRequestDuration.
+				WithLabelValues(c.Request().Method, route, strconv.Itoa(status)).
+				Observe(time.Since(start).Seconds())
+			return err
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"sync/atomic"
+
+	"github.com/donnaloia/sendpulse/internal/auth"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// permissionCacheStats reads the permission cache's counters, when there's
+// a cache to read
+var permissionCacheStats atomic.Pointer[func() (auth.CacheStats, bool)]
+
+// SetPermissionCache exports the counters of the authenticator's permission
+// cache, read on every scrape. Later calls replace earlier ones.
+func SetPermissionCache(a *auth.Authenticator) {
+	stats := a.PermissionCacheStats
+	permissionCacheStats.Store(&stats)
+}
+
+func init() {
+	Registry.MustRegister(permissionCacheCollector{})
+}
+
+var (
+	permissionCacheLookupsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "permission_cache", "lookups_total"),
+		"Permission lookups, by whether the cache answered them (hit) or the permissions service was asked (miss).",
+		[]string{"result"}, nil,
+	)
+	permissionCacheStaleDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "permission_cache", "stale_served_total"),
+		"Expired permissions served because the permissions service was unavailable.",
+		nil, nil,
+	)
+	permissionCacheErrorsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "permission_cache", "errors_total"),
+		"Lookups the permissions service failed or refused.",
+		nil, nil,
+	)
+	permissionCacheRejectedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "permission_cache", "rejected_total"),
+		"Lookups not sent to the permissions service because its circuit breaker was open.",
+		nil, nil,
+	)
+	permissionCacheEntriesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "permission_cache", "entries"),
+		"Permission sets held in the cache.",
+		nil, nil,
+	)
+	permissionsBreakerOpenDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "permissions", "breaker_open"),
+		"1 while the permissions service's circuit breaker is open.",
+		nil, nil,
+	)
+)
+
+// permissionCacheCollector reports the cache's own counters rather than
+// keeping copies of them
+type permissionCacheCollector struct{}
+
+func (permissionCacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- permissionCacheLookupsDesc
+	ch <- permissionCacheStaleDesc
+	ch <- permissionCacheErrorsDesc
+	ch <- permissionCacheRejectedDesc
+	ch <- permissionCacheEntriesDesc
+	ch <- permissionsBreakerOpenDesc
+}
+
+func (permissionCacheCollector) Collect(ch chan<- prometheus.Metric) {
+	fn := permissionCacheStats.Load()
+	if fn == nil {
+		return
+	}
+	stats, ok := (*fn)()
+	if !ok {
+		return
+	}
+	breakerOpen := 0.0
+	if stats.BreakerOpen {
+		breakerOpen = 1
+	}
+	ch <- prometheus.MustNewConstMetric(permissionCacheLookupsDesc, prometheus.CounterValue, float64(stats.Hits), "hit")
+	ch <- prometheus.MustNewConstMetric(permissionCacheLookupsDesc, prometheus.CounterValue, float64(stats.Misses), "miss")
+	ch <- prometheus.MustNewConstMetric(permissionCacheStaleDesc, prometheus.CounterValue, float64(stats.StaleServed))
+	ch <- prometheus.MustNewConstMetric(permissionCacheErrorsDesc, prometheus.CounterValue, float64(stats.Errors))
+	ch <- prometheus.MustNewConstMetric(permissionCacheRejectedDesc, prometheus.CounterValue, float64(stats.Rejected))
+	ch <- prometheus.MustNewConstMetric(permissionCacheEntriesDesc, prometheus.GaugeValue, float64(stats.Entries))
+	ch <- prometheus.MustNewConstMetric(permissionsBreakerOpenDesc, prometheus.GaugeValue, breakerOpen)
+}
@@ -0,0 +1,448 @@
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Table records the applied migrations
+const Table = "schema_versions"
+
+// legacyTable is where the old runner recorded migrations, by file path
+const legacyTable = "schema_migrations"
+
+// lockID is the advisory lock held while migrating, so replicas starting
+// together take turns instead of racing each other
+var lockID = func() int64 {
+	sum := sha256.Sum256([]byte("sendpulse\x00migrate"))
+	return int64(binary.BigEndian.Uint64(sum[:8]))
+}()
+
+// Migrator applies and rolls back the migrations in a directory
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Migrations returns the known migrations, ordered by version
+func (m *Migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+// Status is a migration's state in the database
+type Status struct {
+	Version int64
+	Name    string
+	// AppliedAt is nil for pending migrations
+	AppliedAt *time.Time
+	// Modified means the file has changed since the migration was applied
+	Modified bool
+	// Missing means the migration is applied but this build doesn't have it
+	Missing bool
+}
+
+// applied is a row of the versions table
+type applied struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// Status lists every known and applied migration, ordered by version
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := m.locked(ctx, func(conn *sql.Conn, done map[int64]applied) error {
+		for _, mig := range m.migrations {
+			s := Status{Version: mig.Version, Name: mig.Name}
+			if a, ok := done[mig.Version]; ok {
+				appliedAt := a.appliedAt
+				s.AppliedAt = &appliedAt
+				s.Modified = !mig.Matches(a.checksum)
+			}
+			statuses = append(statuses, s)
+		}
+		for _, version := range m.unknown(done) {
+			a := done[version]
+			appliedAt := a.appliedAt
+			statuses = append(statuses, Status{Version: version, Name: a.name, AppliedAt: &appliedAt, Missing: true})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortStatuses(statuses)
+	return statuses, nil
+}
+
+// Pending returns the migrations Up would apply
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	var pending []Migration
+	err := m.locked(ctx, func(conn *sql.Conn, done map[int64]applied) error {
+		for _, mig := range m.migrations {
+			if _, ok := done[mig.Version]; !ok {
+				pending = append(pending, mig)
+			}
+		}
+		return nil
+	})
+	return pending, err
+}
+
+// Unapplied returns the migrations the database doesn't have, like Pending,
+// but without taking the migration lock or creating the versions table, so
+// it's cheap enough to poll. A migration that's running counts until it
+// commits.
+func (m *Migrator) Unapplied(ctx context.Context) ([]Migration, error) {
+	var exists bool
+	if err := m.db.QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, Table).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("error checking for %s: %w", Table, err)
+	}
+	done := map[int64]applied{}
+	if exists {
+		var err error
+		if done, err = m.applied(ctx, m.db); err != nil {
+			return nil, err
+		}
+	}
+
+	var unapplied []Migration
+	for _, mig := range m.migrations {
+		if _, ok := done[mig.Version]; !ok {
+			unapplied = append(unapplied, mig)
+		}
+	}
+	return unapplied, nil
+}
+
+// Up applies every pending migration and returns them
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	if len(m.migrations) == 0 {
+		return nil, nil
+	}
+	return m.Goto(ctx, m.migrations[len(m.migrations)-1].Version)
+}
+
+// Down rolls back the last steps applied migrations and returns them
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	if steps < 1 {
+		return nil, fmt.Errorf("steps must be at least 1")
+	}
+	var rolledBack []Migration
+	err := m.locked(ctx, func(conn *sql.Conn, done map[int64]applied) error {
+		if err := m.check(done); err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && len(rolledBack) < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := done[mig.Version]; !ok {
+				continue
+			}
+			if err := m.run(ctx, conn, mig, false); err != nil {
+				return err
+			}
+			rolledBack = append(rolledBack, mig)
+		}
+		return nil
+	})
+	return rolledBack, err
+}
+
+// Goto applies or rolls back migrations until version is the latest applied
+// one, and returns the migrations it ran. Version 0 rolls back everything.
+func (m *Migrator) Goto(ctx context.Context, version int64) ([]Migration, error) {
+	if version != 0 && m.find(version) < 0 {
+		return nil, fmt.Errorf("there is no migration %d", version)
+	}
+
+	var ran []Migration
+	err := m.locked(ctx, func(conn *sql.Conn, done map[int64]applied) error {
+		if err := m.check(done); err != nil {
+			return err
+		}
+
+		// Roll back anything after the target, newest first
+		for i := len(m.migrations) - 1; i >= 0 && m.migrations[i].Version > version; i-- {
+			mig := m.migrations[i]
+			if _, ok := done[mig.Version]; !ok {
+				continue
+			}
+			if err := m.run(ctx, conn, mig, false); err != nil {
+				return err
+			}
+			ran = append(ran, mig)
+		}
+
+		// Then apply what's pending up to it, oldest first
+		for _, mig := range m.migrations {
+			if mig.Version > version {
+				break
+			}
+			if _, ok := done[mig.Version]; ok {
+				continue
+			}
+			if err := m.run(ctx, conn, mig, true); err != nil {
+				return err
+			}
+			ran = append(ran, mig)
+		}
+		return nil
+	})
+	return ran, err
+}
+
+// check refuses to migrate a database whose history doesn't match the files:
+// edited or unknown migrations, or a pending migration older than an
+// applied one, which would run out of order
+func (m *Migrator) check(done map[int64]applied) error {
+	if unknown := m.unknown(done); len(unknown) > 0 {
+		return fmt.Errorf("migration %d (%s) is applied but this build doesn't have it", unknown[0], done[unknown[0]].name)
+	}
+
+	var latest int64
+	for version := range done {
+		latest = max(latest, version)
+	}
+	for _, mig := range m.migrations {
+		a, ok := done[mig.Version]
+		switch {
+		case ok && !mig.Matches(a.checksum):
+			return fmt.Errorf("migration %d (%s) has been edited since it was applied", mig.Version, mig.Name)
+		case !ok && mig.Version < latest:
+			return fmt.Errorf("migration %d (%s) is pending but later migration %d is already applied", mig.Version, mig.Name, latest)
+		}
+	}
+	return nil
+}
+
+// unknown returns the applied versions there's no migration for, in order
+func (m *Migrator) unknown(done map[int64]applied) []int64 {
+	var versions []int64
+	for version := range done {
+		if m.find(version) < 0 {
+			versions = append(versions, version)
+		}
+	}
+	sortVersions(versions)
+	return versions
+}
+
+func (m *Migrator) find(version int64) int {
+	for i, mig := range m.migrations {
+		if mig.Version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+// run applies or rolls back one migration in a transaction of its own,
+// together with its row in the versions table
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, mig Migration, up bool) error {
+	script, direction := mig.Up, "up"
+	if !up {
+		script, direction = mig.Down, "down"
+		if script == "" {
+			return fmt.Errorf("migration %d (%s) has no down file", mig.Version, mig.Name)
+		}
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("error running migration %d (%s) %s: %w", mig.Version, mig.Name, direction, err)
+	}
+
+	if up {
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO `+Table+` (version, name, checksum) VALUES ($1, $2, $3)`,
+			mig.Version, mig.Name, mig.Checksum,
+		)
+	} else {
+		_, err = tx.ExecContext(ctx, `DELETE FROM `+Table+` WHERE version = $1`, mig.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("error recording migration %d (%s): %w", mig.Version, mig.Name, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing migration %d (%s): %w", mig.Version, mig.Name, err)
+	}
+	return nil
+}
+
+// locked runs fn on a connection holding the migration lock, with the
+// applied migrations as of taking it
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn, done map[int64]applied) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("error acquiring connection: %w", err)
+	}
+	defer conn.Close()
+
+	// Migrations can legitimately run long (index builds on big tables), and
+	// so can waiting for another instance's
+	if _, err := conn.ExecContext(ctx, "SET statement_timeout = 0"); err != nil {
+		return fmt.Errorf("error disabling statement timeout: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), "RESET statement_timeout")
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockID); err != nil {
+		return fmt.Errorf("error acquiring migration lock: %w", err)
+	}
+	// The request may be gone by now; the lock must be released anyway
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockID)
+
+	if err := m.prepare(ctx, conn); err != nil {
+		return err
+	}
+	done, err := m.applied(ctx, conn)
+	if err != nil {
+		return err
+	}
+	return fn(conn, done)
+}
+
+// prepare creates the versions table, carrying over the history of the old
+// runner the first time
+func (m *Migrator) prepare(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS `+Table+` (
+			version BIGINT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			checksum CHAR(64) NOT NULL,
+			applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %w", Table, err)
+	}
+
+	var adopt bool
+	err = conn.QueryRowContext(ctx,
+		`SELECT to_regclass($1) IS NOT NULL AND NOT EXISTS (SELECT 1 FROM `+Table+`)`,
+		legacyTable,
+	).Scan(&adopt)
+	if err != nil {
+		return fmt.Errorf("error checking for %s: %w", legacyTable, err)
+	}
+	if !adopt {
+		return nil
+	}
+	return m.adoptLegacy(ctx, conn)
+}
+
+// adoptLegacy records the migrations the old runner applied. It kept no
+// checksums, so the current files' are taken as the applied ones. Its table
+// is left alone, so an older build can still start against the database.
+func (m *Migrator) adoptLegacy(ctx context.Context, conn *sql.Conn) error {
+	rows, err := conn.QueryContext(ctx, `SELECT filename, executed_at FROM `+legacyTable)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", legacyTable, err)
+	}
+	type legacy struct {
+		version    int64
+		executedAt time.Time
+	}
+	var found []legacy
+	for rows.Next() {
+		var filename string
+		var executedAt sql.NullTime
+		if err := rows.Scan(&filename, &executedAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("error reading %s: %w", legacyTable, err)
+		}
+		parts := filenamePattern.FindStringSubmatch(path.Base(filename))
+		if parts == nil || parts[3] != "up" {
+			continue
+		}
+		version, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		found = append(found, legacy{version: version, executedAt: executedAt.Time})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading %s: %w", legacyTable, err)
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+	for _, l := range found {
+		i := m.find(l.version)
+		if i < 0 {
+			continue
+		}
+		mig := m.migrations[i]
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO `+Table+` (version, name, checksum, applied_at)
+			VALUES ($1, $2, $3, COALESCE($4, CURRENT_TIMESTAMP))
+			ON CONFLICT (version) DO NOTHING`,
+			mig.Version, mig.Name, mig.Checksum, sql.NullTime{Time: l.executedAt, Valid: !l.executedAt.IsZero()},
+		)
+		if err != nil {
+			return fmt.Errorf("error adopting migration %d: %w", mig.Version, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+func (m *Migrator) applied(ctx context.Context, q interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}) (map[int64]applied, error) {
+	rows, err := q.QueryContext(ctx, `SELECT version, name, checksum, applied_at FROM `+Table)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", Table, err)
+	}
+	defer rows.Close()
+
+	done := map[int64]applied{}
+	for rows.Next() {
+		var version int64
+		var a applied
+		if err := rows.Scan(&version, &a.name, &a.checksum, &a.appliedAt); err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", Table, err)
+		}
+		done[version] = a
+	}
+	return done, rows.Err()
+}
+
+func sortStatuses(statuses []Status) {
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+}
+
+func sortVersions(versions []int64) {
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i] < versions[j]
+	})
+}
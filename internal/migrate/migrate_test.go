@@ -0,0 +1,201 @@
+//go:build integration
+
+package migrate_test
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/donnaloia/sendpulse/internal/migrate"
+	"github.com/donnaloia/sendpulse/internal/testdb"
+	"github.com/donnaloia/sendpulse/migrations"
+)
+
+func TestMain(m *testing.M) {
+	testdb.Main(m)
+}
+
+func newMigrator(t *testing.T, db *sql.DB, fsys fstest.MapFS) *migrate.Migrator {
+	t.Helper()
+	m, err := migrate.New(db, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	t.Helper()
+	var exists bool
+	if err := db.QueryRow(`SELECT to_regclass($1) IS NOT NULL`, name).Scan(&exists); err != nil {
+		t.Fatal(err)
+	}
+	return exists
+}
+
+var testMigrations = fstest.MapFS{
+	"1_a.up.sql":   {Data: []byte("CREATE TABLE a (id INT);")},
+	"1_a.down.sql": {Data: []byte("DROP TABLE a;")},
+	"2_b.up.sql":   {Data: []byte("CREATE TABLE b (id INT);")},
+	"2_b.down.sql": {Data: []byte("DROP TABLE b;")},
+	"3_c.up.sql":   {Data: []byte("CREATE TABLE c (id INT);")},
+	"3_c.down.sql": {Data: []byte("DROP TABLE c;")},
+}
+
+func TestUpDownGoto(t *testing.T) {
+	ctx := context.Background()
+	db := testdb.NewEmpty(t)
+	m := newMigrator(t, db, testMigrations)
+
+	// Before the versions table exists, everything is unapplied
+	if unapplied, err := m.Unapplied(ctx); err != nil || len(unapplied) != 3 {
+		t.Fatalf("unapplied = %+v, err = %v", unapplied, err)
+	}
+
+	ran, err := m.Up(ctx)
+	if err != nil || len(ran) != 3 {
+		t.Fatalf("up ran %d, err = %v", len(ran), err)
+	}
+	if ran, err := m.Up(ctx); err != nil || len(ran) != 0 {
+		t.Fatalf("second up ran %d, err = %v", len(ran), err)
+	}
+
+	if ran, err := m.Down(ctx, 2); err != nil || len(ran) != 2 || ran[0].Version != 3 {
+		t.Fatalf("down ran %+v, err = %v", ran, err)
+	}
+	if !tableExists(t, db, "a") || tableExists(t, db, "b") {
+		t.Fatal("down left the wrong tables")
+	}
+
+	if ran, err := m.Goto(ctx, 2); err != nil || len(ran) != 1 || ran[0].Version != 2 {
+		t.Fatalf("goto 2 ran %+v, err = %v", ran, err)
+	}
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 3 || statuses[1].AppliedAt == nil || statuses[2].AppliedAt != nil {
+		t.Fatalf("statuses = %+v", statuses)
+	}
+	if unapplied, err := m.Unapplied(ctx); err != nil || len(unapplied) != 1 || unapplied[0].Version != 3 {
+		t.Fatalf("unapplied = %+v, err = %v", unapplied, err)
+	}
+
+	if _, err := m.Goto(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if tableExists(t, db, "a") {
+		t.Fatal("goto 0 left table a")
+	}
+}
+
+func TestRefusesEditedMigrations(t *testing.T) {
+	ctx := context.Background()
+	db := testdb.NewEmpty(t)
+	if _, err := newMigrator(t, db, testMigrations).Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	edited := fstest.MapFS{}
+	for name, file := range testMigrations {
+		edited[name] = file
+	}
+	edited["2_b.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE b (id BIGINT);")}
+	edited["4_d.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE d (id INT);")}
+
+	m := newMigrator(t, db, edited)
+	if _, err := m.Up(ctx); err == nil {
+		t.Fatal("up applied over an edited migration")
+	}
+	if tableExists(t, db, "d") {
+		t.Fatal("migration 4 ran")
+	}
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !statuses[1].Modified {
+		t.Fatalf("statuses = %+v", statuses)
+	}
+}
+
+func TestRefusesUnknownMigrations(t *testing.T) {
+	ctx := context.Background()
+	db := testdb.NewEmpty(t)
+	if _, err := newMigrator(t, db, testMigrations).Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	older := fstest.MapFS{"1_a.up.sql": testMigrations["1_a.up.sql"], "1_a.down.sql": testMigrations["1_a.down.sql"]}
+	if _, err := newMigrator(t, db, older).Down(ctx, 1); err == nil {
+		t.Fatal("an older build rolled back")
+	}
+}
+
+// TestConcurrentUp checks the lock: replicas starting together each run Up,
+// and every migration is applied exactly once
+func TestConcurrentUp(t *testing.T) {
+	ctx := context.Background()
+	db := testdb.NewEmpty(t)
+
+	const replicas = 4
+	counts := make(chan int, replicas)
+	errs := make(chan error, replicas)
+	var wg sync.WaitGroup
+	for i := 0; i < replicas; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m, err := migrate.New(db, migrations.FS)
+			if err != nil {
+				errs <- err
+				return
+			}
+			ran, err := m.Up(ctx)
+			if err != nil {
+				errs <- err
+				return
+			}
+			counts <- len(ran)
+		}()
+	}
+	wg.Wait()
+	close(counts)
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	total := 0
+	for n := range counts {
+		total += n
+	}
+	all, _ := migrate.Load(migrations.FS)
+	if total != len(all) {
+		t.Fatalf("%d migrations applied across replicas, want %d", total, len(all))
+	}
+}
+
+func TestAdoptsLegacyHistory(t *testing.T) {
+	ctx := context.Background()
+	db := testdb.NewEmpty(t)
+	_, err := db.Exec(`
+		CREATE TABLE schema_migrations (filename VARCHAR(255) PRIMARY KEY, executed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP);
+		INSERT INTO schema_migrations (filename) VALUES ('/app/migrations/1_a.up.sql');
+		CREATE TABLE a (id INT);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ran, err := newMigrator(t, db, testMigrations).Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != 2 || ran[0].Version != 2 {
+		t.Fatalf("up ran %+v", ran)
+	}
+}
@@ -0,0 +1,108 @@
+package migrate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Migration is one numbered schema change
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	// Down is empty when the migration can't be rolled back
+	Down string
+	// Checksum is the SHA-256 of Up, recorded when it's applied so later
+	// edits to the file are caught
+	Checksum string
+	// Replaces lists earlier checksums of Up that are accepted as applied,
+	// for the rare deliberate edit. They're declared in the file itself:
+	//
+	//	-- migrate:replaces <sha256 of the previous contents>
+	Replaces []string
+}
+
+// Matches reports whether sum is the checksum of this migration, current or
+// replaced
+func (m Migration) Matches(sum string) bool {
+	return sum == m.Checksum || slices.Contains(m.Replaces, sum)
+}
+
+// Migrations are named <version>_<name>.up.sql, with an optional matching
+// <version>_<name>.down.sql, e.g. 000003_audit_log.up.sql
+var filenamePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+var replacesPattern = regexp.MustCompile(`(?m)^--\s*migrate:replaces\s+([0-9a-f]{64})\s*$`)
+
+// Load reads the migrations in the root of fsys, ordered by version
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("error reading migrations: %w", err)
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+		parts := filenamePattern.FindStringSubmatch(entry.Name())
+		if parts == nil {
+			return nil, fmt.Errorf("migration %s isn't named <version>_<name>.up.sql or .down.sql", entry.Name())
+		}
+		version, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("migration %s has an invalid version", entry.Name())
+		}
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration %s: %w", entry.Name(), err)
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: parts[2]}
+			byVersion[version] = m
+		}
+		if m.Name != parts[2] {
+			return nil, fmt.Errorf("migration %d is both %s and %s", version, m.Name, parts[2])
+		}
+
+		target := &m.Up
+		if parts[3] == "down" {
+			target = &m.Down
+		}
+		if *target != "" {
+			return nil, fmt.Errorf("migration %d has more than one %s file", version, parts[3])
+		}
+		*target = string(content)
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d (%s) has no up file", m.Version, m.Name)
+		}
+		m.Checksum = checksum(m.Up)
+		for _, match := range replacesPattern.FindAllStringSubmatch(m.Up, -1) {
+			m.Replaces = append(m.Replaces, match[1])
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+func checksum(sql string) string {
+	sum := sha256.Sum256([]byte(sql))
+	return hex.EncodeToString(sum[:])
+}
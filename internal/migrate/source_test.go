@@ -0,0 +1,82 @@
+package migrate
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/donnaloia/sendpulse/migrations"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"000010_later.up.sql":    {Data: []byte("CREATE TABLE later ();")},
+		"000002_second.up.sql":   {Data: []byte("CREATE TABLE second ();")},
+		"000002_second.down.sql": {Data: []byte("DROP TABLE second;")},
+		"README.md":              {Data: []byte("not a migration")},
+	}
+	got, err := Load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Version != 2 || got[1].Version != 10 {
+		t.Fatalf("migrations = %+v", got)
+	}
+	if got[0].Name != "second" || got[0].Down != "DROP TABLE second;" || got[1].Down != "" {
+		t.Fatalf("migrations = %+v", got)
+	}
+	if got[0].Checksum != checksum("CREATE TABLE second ();") || len(got[0].Checksum) != 64 {
+		t.Fatalf("checksum = %q", got[0].Checksum)
+	}
+}
+
+func TestLoadReplaces(t *testing.T) {
+	previous := checksum("CREATE TABLE a ();")
+	fsys := fstest.MapFS{
+		"1_a.up.sql": {Data: []byte("-- migrate:replaces " + previous + "\nCREATE TABLE a (id INT);")},
+	}
+	got, err := Load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got[0].Matches(previous) || !got[0].Matches(got[0].Checksum) || got[0].Matches(checksum("")) {
+		t.Fatalf("migration = %+v", got[0])
+	}
+}
+
+func TestLoadRejectsInvalidMigrations(t *testing.T) {
+	tests := map[string]fstest.MapFS{
+		"bad name":      {"init.sql": {}},
+		"zero version":  {"0_init.up.sql": {Data: []byte("SELECT 1;")}},
+		"name mismatch": {"1_a.up.sql": {Data: []byte("SELECT 1;")}, "1_b.down.sql": {Data: []byte("SELECT 1;")}},
+		"duplicate":     {"1_a.up.sql": {Data: []byte("SELECT 1;")}, "01_a.up.sql": {Data: []byte("SELECT 1;")}},
+		"down only":     {"1_a.down.sql": {Data: []byte("SELECT 1;")}},
+	}
+	for name, fsys := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Load(fsys); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+// TestEmbeddedMigrations checks the shipped migrations load and can all be
+// rolled back
+func TestEmbeddedMigrations(t *testing.T) {
+	got, err := Load(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	for i, m := range got {
+		if m.Version != int64(i+1) {
+			t.Errorf("migration %d_%s is out of sequence", m.Version, m.Name)
+		}
+		if strings.TrimSpace(m.Down) == "" {
+			t.Errorf("migration %d_%s has no down file", m.Version, m.Name)
+		}
+	}
+}
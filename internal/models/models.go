@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 const (
 	CampaignStatusDraft     = "draft"
@@ -18,7 +21,7 @@ type EmailAddress struct {
 
 // Create a single email address
 type CreateEmailAddressRequest struct {
-	Address        string `json:"address"`
+	Address        string `json:"address" validate:"required,email_idn"`
 	OrganizationID string `json:"organization_id"`
 }
 
@@ -32,9 +35,9 @@ type EmailGroup struct {
 
 // Create a single email group
 type CreateEmailGroup struct {
-	Name           string   `json:"name"`
+	Name           string   `json:"name" validate:"required,max=255"`
 	OrganizationID string   `json:"organization_id"`
-	EmailIDs       []string `json:"email_ids"` // Array of email address IDs instead of full objects
+	EmailIDs       []string `json:"email_ids" validate:"dive,uuid"` // Array of email address IDs instead of full objects
 }
 
 // EmailGroupMember represents the junction between EmailGroup and EmailAddress
@@ -47,8 +50,8 @@ type EmailGroupMember struct {
 
 // Create an email group member
 type CreateEmailGroupMember struct {
-	EmailGroupID   string `json:"email_group_id"`
-	EmailAddressID string `json:"email_address_id"`
+	EmailGroupID   string `json:"email_group_id" validate:"required,uuid"`
+	EmailAddressID string `json:"email_address_id" validate:"required,uuid"`
 }
 
 // Campaign is a high-level object representing a campaign
@@ -58,22 +61,23 @@ type Campaign struct {
 	Status         string       `json:"status"`
 	OrganizationID string       `json:"organization_id"`
 	CreatedAt      time.Time    `json:"created_at"`
+	Version        int          `json:"version"`
 	Templates      []Template   `json:"templates"`
 	EmailGroups    []EmailGroup `json:"email_groups"`
 }
 
 // Create a single campaign
 type CreateCampaign struct {
-	Name           string `json:"name"`
+	Name           string `json:"name" validate:"required,max=255"`
 	OrganizationID string `json:"organization_id"`
 }
 
 // Update a single campaign
 type UpdateCampaign struct {
-	Name        string   `json:"name,omitempty"`
-	Status      string   `json:"status,omitempty"`
-	Templates   []string `json:"templates,omitempty"`
-	EmailGroups []string `json:"email_groups,omitempty"` // Array of email group IDs
+	Name        string   `json:"name,omitempty" validate:"max=255"`
+	Status      string   `json:"status,omitempty" validate:"omitempty,oneof=draft scheduled launched"`
+	Templates   []string `json:"templates,omitempty" validate:"dive,uuid"`
+	EmailGroups []string `json:"email_groups,omitempty" validate:"dive,uuid"` // Array of email group IDs
 }
 
 // EmailGroupCampaign is an intermediary model that links an email group to a campaign
@@ -97,13 +101,24 @@ type Template struct {
 	Name           string    `json:"name"`
 	HTML           string    `json:"html"`
 	CreatedAt      time.Time `json:"created_at"`
+	Version        int       `json:"version"`
 }
 
+// MaxTemplateHTMLBytes caps the size of a template's HTML. Keep the
+// maxbytes tags on CreateTemplate and UpdateTemplate in sync.
+const MaxTemplateHTMLBytes = 512 << 10
+
 // Create a template
 type CreateTemplate struct {
 	OrganizationID string `json:"organization_id"`
-	Name           string `json:"name"`
-	HTML           string `json:"html"`
+	Name           string `json:"name" validate:"required,max=255"`
+	HTML           string `json:"html" validate:"required,maxbytes=524288"`
+}
+
+// Update a template
+type UpdateTemplate struct {
+	Name string `json:"name,omitempty" validate:"max=255"`
+	HTML string `json:"html,omitempty" validate:"maxbytes=524288"`
 }
 
 // CampaignTemplate is an intermediary model that links a campaign to a template
@@ -129,7 +144,7 @@ type Organization struct {
 
 // Create an organization
 type CreateOrganization struct {
-	Name string `json:"name"`
+	Name string `json:"name" validate:"required,max=255"`
 }
 
 // Profile is a high-level object representing a Profile
@@ -148,24 +163,108 @@ type Profile struct {
 
 // Create a profile
 type CreateProfile struct {
-	ID             string  `json:"id"`
-	Username       string  `json:"username"`
-	Email          string  `json:"email"`
-	FirstName      *string `json:"first_name"`
-	LastName       *string `json:"last_name"`
-	Timezone       *string `json:"timezone"`
-	Bio            *string `json:"bio"`
+	ID             string  `json:"id" validate:"required,uuid"`
+	Username       string  `json:"username" validate:"required,max=255"`
+	Email          string  `json:"email" validate:"required,email_idn"`
+	FirstName      *string `json:"first_name" validate:"omitnil,min=1,max=255"`
+	LastName       *string `json:"last_name" validate:"omitnil,min=1,max=255"`
+	Timezone       *string `json:"timezone" validate:"omitnil,timezone"`
+	Bio            *string `json:"bio" validate:"omitnil,min=1,max=255"`
 	OrganizationID string  `json:"organization_id"`
-	PictureURL     *string `json:"picture_url"`
+	PictureURL     *string `json:"picture_url" validate:"omitnil,http_url,max=255"`
 }
 
 // Update a profile
 type UpdateProfile struct {
-	Username   string  `json:"username"`
-	Email      string  `json:"email"`
-	FirstName  *string `json:"first_name"`
-	LastName   *string `json:"last_name"`
-	Timezone   *string `json:"timezone"`
-	Bio        *string `json:"bio"`
-	PictureURL *string `json:"picture_url"`
+	Username   string  `json:"username" validate:"max=255"`
+	Email      string  `json:"email" validate:"omitempty,email_idn"`
+	FirstName  *string `json:"first_name" validate:"omitnil,min=1,max=255"`
+	LastName   *string `json:"last_name" validate:"omitnil,min=1,max=255"`
+	Timezone   *string `json:"timezone" validate:"omitnil,timezone"`
+	Bio        *string `json:"bio" validate:"omitnil,min=1,max=255"`
+	PictureURL *string `json:"picture_url" validate:"omitnil,http_url,max=255"`
+}
+
+// APIKey is an organization-scoped key for machine-to-machine access
+type APIKey struct {
+	ID             string     `json:"id"`
+	OrganizationID string     `json:"organization_id"`
+	Name           string     `json:"name"`
+	Prefix         string     `json:"prefix"`
+	Permissions    []string   `json:"permissions"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	LastUsedAt     *time.Time `json:"last_used_at"`
+	RevokedAt      *time.Time `json:"revoked_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// Create an API key
+type CreateAPIKey struct {
+	Name        string     `json:"name" validate:"required,max=255"`
+	Permissions []string   `json:"permissions" validate:"dive,permission"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+}
+
+// CreatedAPIKey is returned once, on creation, and is the only time the
+// plaintext key is available
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// Actor identifies who made a change, for the audit log
+type Actor struct {
+	ID        string
+	Type      string
+	RequestID string
+	IP        string
+}
+
+// AuditEntry records a single mutating API call
+type AuditEntry struct {
+	ID             string          `json:"id"`
+	OrganizationID string          `json:"organization_id"`
+	ActorID        string          `json:"actor_id"`
+	ActorType      string          `json:"actor_type"`
+	Action         string          `json:"action"`
+	ResourceType   string          `json:"resource_type"`
+	ResourceID     string          `json:"resource_id"`
+	Before         json.RawMessage `json:"before"`
+	After          json.RawMessage `json:"after"`
+	Changes        json.RawMessage `json:"changes"`
+	RequestID      *string         `json:"request_id"`
+	IP             *string         `json:"ip"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+// AuditFilter narrows an audit log listing. Empty fields don't filter.
+type AuditFilter struct {
+	ActorID       string
+	Action        string
+	ResourceType  string
+	ResourceID    string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+}
+
+// SendingUsage is what an organization's launched campaigns have sent
+// against its quotas, and the rate they're sent at
+type SendingUsage struct {
+	OrganizationID string     `json:"organization_id"`
+	Day            QuotaUsage `json:"day"`
+	Month          QuotaUsage `json:"month"`
+	// SendingDomain is the domain the organization's campaigns are sent
+	// from, and MaxSendRate the messages per second that may be sent from
+	// it, or zero for no limit
+	SendingDomain string  `json:"sending_domain"`
+	MaxSendRate   float64 `json:"max_send_rate"`
+}
+
+// QuotaUsage is the recipients counted against one quota. Limit and
+// Remaining are null when there's no quota.
+type QuotaUsage struct {
+	Used      int       `json:"used"`
+	Limit     *int      `json:"limit"`
+	Remaining *int      `json:"remaining"`
+	ResetsAt  time.Time `json:"resets_at"`
 }
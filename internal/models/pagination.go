@@ -1,25 +1,82 @@
 package models
 
-// PaginationParams for incoming requests
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+const (
+	DefaultPageSize = 10
+	MaxPageSize     = 100
+)
+
+// Cursor directions
+const (
+	CursorNext = "next"
+	CursorPrev = "prev"
+)
+
+// PaginationParams for incoming requests. When Cursor is set it takes
+// precedence over Page.
 type PaginationParams struct {
-	Page     int
-	PageSize int
+	Page         int
+	PageSize     int
+	Cursor       string
+	IncludeTotal bool
+}
+
+// Cursor is the decoded form of an opaque page cursor. It holds the sort key
+// of the row to continue after (next) or before (prev): the values of the
+// sorted columns, with the ID breaking ties. Sort records the ordering the
+// cursor was issued for, so it can't be replayed against a different one.
+type Cursor struct {
+	Values    []string `json:"v"`
+	ID        string   `json:"i"`
+	Sort      string   `json:"s"`
+	Direction string   `json:"d"`
+}
+
+// Encode returns the opaque string form of the cursor
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor parses a cursor produced by Cursor.Encode
+func DecodeCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == "" {
+		return nil, errors.New("invalid cursor")
+	}
+	if c.Direction != CursorNext && c.Direction != CursorPrev {
+		return nil, errors.New("invalid cursor")
+	}
+	return &c, nil
 }
 
-// PaginatedResponse is a generic type for paginated results
+// PaginatedResponse is a generic type for paginated results. Total and the
+// page numbers are only present for page-based requests, or for cursor-based
+// requests that ask for include_total.
 type PaginatedResponse[T any] struct {
-	Results     []T `json:"results"`
-	Total       int `json:"total"`
-	CurrentPage int `json:"current_page"`
-	TotalPages  int `json:"total_pages"`
+	Results     []T    `json:"results"`
+	Total       *int   `json:"total,omitempty"`
+	CurrentPage int    `json:"current_page,omitempty"`
+	TotalPages  int    `json:"total_pages,omitempty"`
+	NextCursor  string `json:"next_cursor,omitempty"`
+	PrevCursor  string `json:"prev_cursor,omitempty"`
 }
 
-// NewPaginatedResponse creates a new paginated response
+// NewPaginatedResponse creates a new page-based paginated response
 func NewPaginatedResponse[T any](results []T, total, currentPage, pageSize int) *PaginatedResponse[T] {
 	totalPages := (total + pageSize - 1) / pageSize
 	return &PaginatedResponse[T]{
 		Results:     results,
-		Total:       total,
+		Total:       &total,
 		CurrentPage: currentPage,
 		TotalPages:  totalPages,
 	}
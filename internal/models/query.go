@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// SortField is one entry of a sort=name,-created_at parameter
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// ListQuery holds the filtering, sorting and search options of a list
+// request. Field names are checked against each resource's whitelist by the
+// services, never interpolated into SQL.
+type ListQuery struct {
+	Sort          []SortField
+	Filters       map[string][]string
+	Search        string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+}
@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often the memory store drops buckets that have
+// refilled, which are no different from ones that were never used
+const sweepInterval = time.Minute
+
+// MemoryStore keeps buckets in process memory. Each instance of the service
+// counts on its own, so behind a load balancer an organization gets its
+// limit from every instance; use a shared store there.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+}
+
+type memoryBucket struct {
+	tokens  float64
+	updated time.Time
+	// full is when the bucket will have refilled
+	full time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*memoryBucket{}}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, buckets []Bucket, now time.Time) ([]Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	held := make([]*memoryBucket, len(buckets))
+	allowed := true
+	for i, bucket := range buckets {
+		b, ok := s.buckets[bucket.Key]
+		if !ok {
+			b = &memoryBucket{tokens: float64(bucket.Limit.Burst), updated: now}
+			s.buckets[bucket.Key] = b
+		}
+		b.tokens, b.updated = refill(b.tokens, b.updated, bucket.Limit, now), now
+		held[i] = b
+		allowed = allowed && b.tokens >= 1
+	}
+	results := make([]Result, len(buckets))
+	for i, b := range held {
+		results[i], b.tokens = take(b.tokens, buckets[i].Limit, allowed)
+		b.full = now.Add(results[i].Reset)
+	}
+
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		s.lastSweep = now
+		for k, b := range s.buckets {
+			if !now.Before(b.full) {
+				delete(s.buckets, k)
+			}
+		}
+	}
+	return results, nil
+}
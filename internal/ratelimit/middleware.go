@@ -0,0 +1,118 @@
+package ratelimit
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/donnaloia/sendpulse/internal/auth"
+	"github.com/donnaloia/sendpulse/internal/metrics"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// Response headers, from the IETF RateLimit header fields draft
+const (
+	HeaderLimit     = "RateLimit-Limit"
+	HeaderRemaining = "RateLimit-Remaining"
+	HeaderReset     = "RateLimit-Reset"
+)
+
+// IPMiddleware limits requests by client address before they're
+// authenticated, so a flood of requests with bad credentials is turned away
+// without checking each one. It must run before authentication; requests
+// skip says to leave alone, such as probes, aren't limited.
+func IPMiddleware(cfg *Config, store Store, skip middleware.Skipper) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if cfg.PerIP.isZero() {
+			return next
+		}
+		return func(c echo.Context) error {
+			if skip != nil && skip(c) {
+				return next(c)
+			}
+			// RealIP only believes X-Forwarded-For from trusted proxies
+			return limit(c, next, perIPLabel, []Bucket{{"ip:" + c.RealIP(), cfg.PerIP}}, store)
+		}
+	}
+}
+
+// Middleware limits requests by organization: the one in the route, or
+// else the caller's. Requests made with an API key also take from the key's
+// own bucket, and only when both buckets allow them. Requests that can't be
+// tied to an organization aren't limited. It must run after
+// authentication.
+//
+// Every limited response carries RateLimit-* headers for the bucket closest
+// to running out. Denied requests get 429 with Retry-After. If the store
+// fails, requests are let through rather than failed.
+func Middleware(cfg *Config, store Store) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			principal, _ := auth.FromEcho(c)
+			orgID := c.Param("organization_id")
+			if orgID == "" && principal != nil {
+				orgID = principal.OrganizationID
+			}
+			if orgID == "" {
+				return next(c)
+			}
+
+			planName, plan := cfg.plan(orgID)
+			var buckets []Bucket
+			if principal != nil && principal.Type == auth.PrincipalAPIKey && !plan.APIKey.isZero() {
+				buckets = append(buckets, Bucket{"api_key:" + principal.Subject, plan.APIKey})
+			}
+			buckets = append(buckets, Bucket{"organization:" + orgID, plan.Organization})
+			return limit(c, next, planName, buckets, store)
+		}
+	}
+}
+
+// perIPLabel stands in for the plan in the metrics of requests refused by
+// the per-IP limit
+const perIPLabel = "per_ip"
+
+// limit takes the request from its buckets, then runs next if they all
+// allowed it. label is the plan counted in the metrics when they didn't.
+func limit(c echo.Context, next echo.HandlerFunc, label string, buckets []Bucket, store Store) error {
+	ctx := c.Request().Context()
+	results, err := store.Take(ctx, buckets, time.Now())
+	if err != nil {
+		slog.ErrorContext(ctx, "error checking rate limit", "error", err)
+		return next(c)
+	}
+
+	// The headers describe the bucket that refused the request, or else
+	// the one with the least left
+	tightest := &results[0]
+	for i := range results {
+		res := &results[i]
+		if !tightest.Allowed {
+			break
+		}
+		if !res.Allowed || res.Remaining < tightest.Remaining {
+			tightest = res
+		}
+	}
+
+	h := c.Response().Header()
+	h.Set(HeaderLimit, strconv.Itoa(tightest.Limit))
+	h.Set(HeaderRemaining, strconv.Itoa(tightest.Remaining))
+	h.Set(HeaderReset, strconv.Itoa(ceilSeconds(tightest.Reset)))
+	if !tightest.Allowed {
+		metrics.RateLimited.WithLabelValues(label).Inc()
+		h.Set(echo.HeaderRetryAfter, strconv.Itoa(ceilSeconds(tightest.RetryAfter)))
+		return echo.NewHTTPError(http.StatusTooManyRequests, "rate limit exceeded")
+	}
+	return next(c)
+}
+
+// ceilSeconds rounds up to whole seconds, and at least one, so clients
+// retrying at Retry-After aren't early
+func ceilSeconds(d time.Duration) int {
+	return max(1, int(math.Ceil(d.Seconds())))
+}
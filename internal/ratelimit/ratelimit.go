@@ -0,0 +1,117 @@
+// Package ratelimit keeps one organization from using up the service for
+// everyone. Each organization has a token bucket sized by its plan, and so
+// does each of its API keys, so one runaway script can't use up its
+// organization's allowance either. Each client address has a bucket too,
+// checked before requests are authenticated.
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Limit is a token bucket: Burst requests at once, refilled at
+// RequestsPerSecond
+type Limit struct {
+	RequestsPerSecond float64 `yaml:"requests_per_second"`
+	Burst             int     `yaml:"burst"`
+}
+
+func (l Limit) isZero() bool {
+	return l == Limit{}
+}
+
+// Plan is the limits an organization gets
+type Plan struct {
+	Organization Limit `yaml:"organization"`
+	// APIKey limits each of the organization's API keys within its
+	// allowance. Zero leaves keys limited by the organization's only.
+	APIKey Limit `yaml:"api_key"`
+}
+
+// Config is the limits. Plans and the organizations on them are only read
+// from the config file.
+type Config struct {
+	Enabled     bool            `yaml:"enabled" env:"RATE_LIMIT_ENABLED"`
+	DefaultPlan string          `yaml:"default_plan" env:"RATE_LIMIT_DEFAULT_PLAN"`
+	Plans       map[string]Plan `yaml:"plans"`
+	// Organizations puts organizations, by ID, on plans other than the
+	// default
+	Organizations map[string]string `yaml:"organizations"`
+	// PerIP limits each client address, whoever it's authenticated as.
+	// Zero turns it off.
+	PerIP Limit `yaml:"per_ip"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Enabled:     true,
+		DefaultPlan: "standard",
+		Plans: map[string]Plan{
+			"standard": {
+				Organization: Limit{RequestsPerSecond: 50, Burst: 100},
+				APIKey:       Limit{RequestsPerSecond: 25, Burst: 50},
+			},
+		},
+		PerIP: Limit{RequestsPerSecond: 100, Burst: 200},
+	}
+}
+
+func (c *Config) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	var errs []error
+	if _, ok := c.Plans[c.DefaultPlan]; !ok {
+		errs = append(errs, fmt.Errorf("RATE_LIMIT_DEFAULT_PLAN %q isn't one of the plans", c.DefaultPlan))
+	}
+	for _, name := range sortedKeys(c.Plans) {
+		plan := c.Plans[name]
+		if err := plan.Organization.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("rate limit plan %q: organization %w", name, err))
+		}
+		if err := plan.APIKey.validate(); err != nil && !plan.APIKey.isZero() {
+			errs = append(errs, fmt.Errorf("rate limit plan %q: api_key %w", name, err))
+		}
+	}
+	if err := c.PerIP.validate(); err != nil && !c.PerIP.isZero() {
+		errs = append(errs, fmt.Errorf("rate limit per_ip %w", err))
+	}
+	for _, orgID := range sortedKeys(c.Organizations) {
+		if _, ok := c.Plans[c.Organizations[orgID]]; !ok {
+			errs = append(errs, fmt.Errorf("organization %s is on rate limit plan %q, which doesn't exist", orgID, c.Organizations[orgID]))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (l Limit) validate() error {
+	if l.RequestsPerSecond <= 0 || l.Burst < 1 {
+		return errors.New("limit needs a positive requests_per_second and a burst of at least 1")
+	}
+	return nil
+}
+
+// plan returns the plan an organization is on, and its name
+func (c *Config) plan(orgID string) (string, Plan) {
+	name := c.DefaultPlan
+	for id, plan := range c.Organizations {
+		// IDs are UUIDs, which compare case-insensitively
+		if strings.EqualFold(id, orgID) {
+			name = plan
+			break
+		}
+	}
+	return name, c.Plans[name]
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,180 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/donnaloia/sendpulse/internal/auth"
+
+	"github.com/labstack/echo/v4"
+)
+
+// takeOne takes a request from a single bucket
+func takeOne(s *MemoryStore, key string, limit Limit, now time.Time) Result {
+	results, _ := s.Take(context.Background(), []Bucket{{key, limit}}, now)
+	return results[0]
+}
+
+func TestMemoryStoreRefills(t *testing.T) {
+	s := NewMemoryStore()
+	limit := Limit{RequestsPerSecond: 2, Burst: 3}
+	now := time.Now()
+
+	for i := 2; i >= 0; i-- {
+		res := takeOne(s, "org", limit, now)
+		if !res.Allowed || res.Remaining != i || res.Limit != 3 {
+			t.Fatalf("take %d: %+v", 3-i, res)
+		}
+	}
+	res := takeOne(s, "org", limit, now)
+	if res.Allowed || res.RetryAfter != 500*time.Millisecond || res.Reset != 1500*time.Millisecond {
+		t.Fatalf("over the limit: %+v", res)
+	}
+	// Other keys have buckets of their own
+	if res := takeOne(s, "other", limit, now); !res.Allowed {
+		t.Fatalf("other: %+v", res)
+	}
+
+	res = takeOne(s, "org", limit, now.Add(500*time.Millisecond))
+	if !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("after refilling one: %+v", res)
+	}
+	// A bucket never holds more than its burst
+	res = takeOne(s, "org", limit, now.Add(time.Hour))
+	if !res.Allowed || res.Remaining != 2 {
+		t.Fatalf("after refilling: %+v", res)
+	}
+}
+
+func TestMemoryStoreSweepsFullBuckets(t *testing.T) {
+	s := NewMemoryStore()
+	limit := Limit{RequestsPerSecond: 1, Burst: 1}
+	now := time.Now()
+	takeOne(s, "idle", limit, now)
+	takeOne(s, "busy", limit, now.Add(2*sweepInterval))
+	if _, ok := s.buckets["idle"]; ok || len(s.buckets) != 1 {
+		t.Fatalf("buckets = %v", s.buckets)
+	}
+}
+
+func TestMemoryStoreTakesFromEveryBucketOrNone(t *testing.T) {
+	s := NewMemoryStore()
+	now := time.Now()
+	small, large := Limit{RequestsPerSecond: 1, Burst: 1}, Limit{RequestsPerSecond: 1, Burst: 5}
+	takeOne(s, "small", small, now)
+
+	results, _ := s.Take(context.Background(), []Bucket{{"large", large}, {"small", small}}, now)
+	if !results[0].Allowed || results[1].Allowed {
+		t.Fatalf("results = %+v", results)
+	}
+	// The refused request left the large bucket as it was
+	if res := takeOne(s, "large", large, now); res.Remaining != 4 {
+		t.Fatalf("large = %+v", res)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := DefaultConfig()
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Plans["free"] = Plan{Organization: Limit{RequestsPerSecond: 1}}
+	cfg.Organizations = map[string]string{"3f2a": "gold"}
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	cfg = DefaultConfig()
+	cfg.Organizations = map[string]string{"3F2A": "standard"}
+	cfg.Plans["free"] = Plan{Organization: Limit{RequestsPerSecond: 1, Burst: 5}}
+	cfg.DefaultPlan = "free"
+	if name, _ := cfg.plan("3f2a"); name != "standard" {
+		t.Fatalf("plan = %s", name)
+	}
+	if name, _ := cfg.plan("9c1b"); name != "free" {
+		t.Fatalf("plan = %s", name)
+	}
+}
+
+func TestMiddlewareLimitsAPIKeysWithinTheirOrganization(t *testing.T) {
+	cfg := &Config{
+		Enabled:     true,
+		DefaultPlan: "standard",
+		Plans: map[string]Plan{"standard": {
+			Organization: Limit{RequestsPerSecond: 0.001, Burst: 3},
+			APIKey:       Limit{RequestsPerSecond: 0.001, Burst: 2},
+		}},
+	}
+	e := echo.New()
+	store := NewMemoryStore()
+	handler := Middleware(cfg, store)(func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	})
+	request := func(key string) (*httptest.ResponseRecorder, error) {
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+		rec := c.Response().Writer.(*httptest.ResponseRecorder)
+		c.Set(auth.ContextKey, &auth.Principal{Type: auth.PrincipalAPIKey, Subject: key, OrganizationID: "org"})
+		return rec, handler(c)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := request("key-1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rec, err := request("key-1")
+	var he *echo.HTTPError
+	if !errors.As(err, &he) || he.Code != http.StatusTooManyRequests {
+		t.Fatalf("err = %v", err)
+	}
+	if rec.Header().Get(HeaderLimit) != "2" || rec.Header().Get(HeaderRemaining) != "0" || rec.Header().Get(echo.HeaderRetryAfter) == "" {
+		t.Fatalf("headers = %v", rec.Header())
+	}
+
+	// The denied request didn't count against the organization, which has
+	// one request left for its other keys
+	rec, err = request("key-2")
+	if err != nil || rec.Header().Get(HeaderLimit) != "3" || rec.Header().Get(HeaderRemaining) != "0" {
+		t.Fatalf("err = %v, headers = %v", err, rec.Header())
+	}
+	if _, err := request("key-3"); !errors.As(err, &he) || he.Code != http.StatusTooManyRequests {
+		t.Fatalf("err = %v", err)
+	}
+	// and the request the organization refused didn't count against the key
+	if res := takeOne(store, "api_key:key-3", cfg.Plans["standard"].APIKey, time.Now()); res.Remaining != 1 {
+		t.Fatalf("key-3 = %+v", res)
+	}
+}
+
+func TestIPMiddlewareLimitsClientAddresses(t *testing.T) {
+	cfg := &Config{Enabled: true, PerIP: Limit{RequestsPerSecond: 0.001, Burst: 1}}
+	e := echo.New()
+	handler := IPMiddleware(cfg, NewMemoryStore(), func(c echo.Context) bool {
+		return c.Request().URL.Path == "/livez"
+	})(func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	})
+	request := func(path, addr string) error {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = addr + ":1234"
+		return handler(e.NewContext(req, httptest.NewRecorder()))
+	}
+
+	if err := request("/", "192.0.2.1"); err != nil {
+		t.Fatal(err)
+	}
+	var he *echo.HTTPError
+	if err := request("/", "192.0.2.1"); !errors.As(err, &he) || he.Code != http.StatusTooManyRequests {
+		t.Fatalf("err = %v", err)
+	}
+	if err := request("/", "192.0.2.2"); err != nil {
+		t.Fatalf("other address: %v", err)
+	}
+	if err := request("/livez", "192.0.2.1"); err != nil {
+		t.Fatalf("skipped path: %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Result is the state of a bucket after a request has taken from it
+type Result struct {
+	// Allowed is set when the bucket had a token for the request
+	Allowed bool
+	// Limit is the bucket's size and Remaining what's left in it
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is how long until a denied request would be allowed
+	RetryAfter time.Duration
+}
+
+// Bucket is a token bucket a request takes from
+type Bucket struct {
+	Key   string
+	Limit Limit
+}
+
+// Store keeps the buckets by key. Take refills each of a request's buckets
+// for the time since it was last used, then takes a token from every one of
+// them if each has one to give, or else from none, so a request one bucket
+// refuses doesn't use up the others. Results are in the order of the
+// buckets. Implementations shared between instances must make Take atomic
+// across them.
+type Store interface {
+	Take(ctx context.Context, buckets []Bucket, now time.Time) ([]Result, error)
+}
+
+// refill returns what a bucket holding tokens as of updated holds as of now
+func refill(tokens float64, updated time.Time, limit Limit, now time.Time) float64 {
+	if elapsed := now.Sub(updated).Seconds(); elapsed > 0 {
+		tokens = min(float64(limit.Burst), tokens+elapsed*limit.RequestsPerSecond)
+	}
+	return tokens
+}
+
+// take applies one request to a bucket holding tokens, taking one of them
+// if it has one and the request's other buckets do too. It returns the
+// result and the tokens left.
+func take(tokens float64, limit Limit, allowed bool) (Result, float64) {
+	res := Result{Limit: limit.Burst, Allowed: tokens >= 1}
+	if !res.Allowed {
+		res.RetryAfter = seconds((1 - tokens) / limit.RequestsPerSecond)
+	} else if allowed {
+		tokens--
+	}
+	res.Remaining = int(tokens)
+	res.Reset = seconds((float64(limit.Burst) - tokens) / limit.RequestsPerSecond)
+	return res, tokens
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,318 @@
+package seed
+
+import (
+	"context"
+	crand "crypto/rand"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Options size the generated fixtures
+type Options struct {
+	// Organization is the name of the organization to create. It defaults to
+	// one stamped with the current time, so repeated runs don't collide.
+	Organization string
+	Addresses    int
+	Groups       int
+	Campaigns    int
+	Templates    int
+	// Overlap is the share of addresses that belong to a second group
+	Overlap float64
+	// Seed makes the shapes and names of the generated data reproducible.
+	// IDs are random whatever the seed, so repeated runs don't collide, and
+	// addresses carry a tag of the organization's ID.
+	Seed int64
+	// Logf reports progress, if set
+	Logf func(format string, args ...any)
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Addresses: 1_000_000,
+		Groups:    50,
+		Campaigns: 200,
+		Templates: 20,
+		Overlap:   0.3,
+		Seed:      1,
+	}
+}
+
+func (o Options) validate() error {
+	switch {
+	case o.Addresses < 0, o.Campaigns < 0, o.Templates < 0:
+		return fmt.Errorf("counts can't be negative")
+	case o.Groups < 1:
+		return fmt.Errorf("at least one group is needed")
+	case o.Overlap < 0 || o.Overlap > 1:
+		return fmt.Errorf("overlap must be between 0 and 1")
+	}
+	return nil
+}
+
+func (o Options) logf(format string, args ...any) {
+	if o.Logf != nil {
+		o.Logf(format, args...)
+	}
+}
+
+// generator produces the rows of a generated organization. Group sizes
+// follow a Zipf distribution, as real lists do: a few large segments and a
+// long tail of small ones.
+type generator struct {
+	opts  Options
+	rand  *rand.Rand
+	zipf  *rand.Zipf
+	tag   string
+	now   time.Time
+	since time.Duration
+}
+
+func newGenerator(opts Options, organizationID string, now time.Time) *generator {
+	r := rand.New(rand.NewSource(opts.Seed))
+	g := &generator{
+		opts:  opts,
+		rand:  r,
+		tag:   organizationID[:8],
+		now:   now,
+		since: 365 * 24 * time.Hour,
+	}
+	if opts.Groups > 1 {
+		g.zipf = rand.NewZipf(r, 1.1, 1, uint64(opts.Groups-1))
+	}
+	return g
+}
+
+// id returns a random version 4 UUID. They're generated here rather than by
+// Postgres so memberships and links can be written without reading a
+// million IDs back, and from crypto/rand rather than the seeded source so
+// runs with the same seed don't generate the same IDs.
+func (g *generator) id() string {
+	var b [16]byte
+	if _, err := crand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("error generating id: %v", err))
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// createdAt returns a time within the last year
+func (g *generator) createdAt() time.Time {
+	return g.now.Add(-time.Duration(g.rand.Int63n(int64(g.since))))
+}
+
+// address returns the i-th address. Addresses are unique across
+// organizations, so each carries the organization's tag as well as its index.
+func (g *generator) address(i int) string {
+	first := firstNames[g.rand.Intn(len(firstNames))]
+	last := lastNames[g.rand.Intn(len(lastNames))]
+	domain := domains[g.rand.Intn(len(domains))]
+	return fmt.Sprintf("%s.%s.%s%d@%s", first, last, g.tag, i, domain)
+}
+
+// group picks a group index for a membership
+func (g *generator) group() int {
+	if g.zipf == nil {
+		return 0
+	}
+	return int(g.zipf.Uint64())
+}
+
+// pick returns n distinct indexes below max, or all of them if there are
+// fewer
+func (g *generator) pick(n, max int) []int {
+	if n > max {
+		n = max
+	}
+	return g.rand.Perm(max)[:n]
+}
+
+func runGenerate(ctx context.Context, tx *sql.Tx, opts Options) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	now := time.Now()
+	if opts.Organization == "" {
+		opts.Organization = "Load test " + now.UTC().Format("2006-01-02 15:04:05")
+	}
+
+	var organizationID string
+	err := tx.QueryRowContext(ctx, `INSERT INTO organizations (name) VALUES ($1) RETURNING id`, opts.Organization).Scan(&organizationID)
+	if err != nil {
+		return err
+	}
+	opts.logf("created organization %s (%s)", opts.Organization, organizationID)
+	g := newGenerator(opts, organizationID, now)
+
+	groupIDs := make([]string, opts.Groups)
+	err = copyRows(ctx, tx, "email_groups", []string{"id", "name", "organization_id", "created_at"}, opts.Groups, func(i int) []any {
+		groupIDs[i] = g.id()
+		name := groupNames[i%len(groupNames)]
+		if i >= len(groupNames) {
+			name = fmt.Sprintf("%s %d", name, i/len(groupNames)+1)
+		}
+		return []any{groupIDs[i], name, organizationID, g.createdAt()}
+	})
+	if err != nil {
+		return err
+	}
+	opts.logf("created %d email groups", opts.Groups)
+
+	// A connection can only run one COPY at a time, so memberships are
+	// collected while the addresses stream and copied afterwards
+	addresses, err := tx.PrepareContext(ctx, pq.CopyIn("email_addresses", "id", "address", "organization_id", "created_at"))
+	if err != nil {
+		return err
+	}
+	defer addresses.Close()
+	var memberships []membership
+	for i := 0; i < opts.Addresses; i++ {
+		id, createdAt := g.id(), g.createdAt()
+		if _, err := addresses.ExecContext(ctx, id, g.address(i), organizationID, createdAt); err != nil {
+			return err
+		}
+		first := g.group()
+		memberships = append(memberships, membership{groupIDs[first], id, createdAt})
+		if opts.Groups > 1 && g.rand.Float64() < opts.Overlap {
+			second := g.group()
+			if second == first {
+				second = (first + 1) % opts.Groups
+			}
+			memberships = append(memberships, membership{groupIDs[second], id, createdAt})
+		}
+		if (i+1)%100_000 == 0 {
+			opts.logf("created %d email addresses", i+1)
+		}
+	}
+	if _, err := addresses.ExecContext(ctx); err != nil {
+		return err
+	}
+	opts.logf("created %d email addresses", opts.Addresses)
+
+	err = copyRows(ctx, tx, "email_group_members", []string{"email_group_id", "email_address_id", "created_at"}, len(memberships), func(i int) []any {
+		m := memberships[i]
+		return []any{m.groupID, m.addressID, m.createdAt}
+	})
+	if err != nil {
+		return err
+	}
+	opts.logf("created %d email group memberships", len(memberships))
+
+	templateIDs := make([]string, opts.Templates)
+	err = copyRows(ctx, tx, "templates", []string{"id", "name", "html", "organization_id", "created_at"}, opts.Templates, func(i int) []any {
+		templateIDs[i] = g.id()
+		name := templateNames[i%len(templateNames)]
+		html := fmt.Sprintf("<div><h1>%s</h1><p>Hi {{first_name}}, here's what's new.</p></div>", name)
+		return []any{templateIDs[i], name, html, organizationID, g.createdAt()}
+	})
+	if err != nil {
+		return err
+	}
+	opts.logf("created %d templates", opts.Templates)
+
+	campaignIDs := make([]string, opts.Campaigns)
+	err = copyRows(ctx, tx, "campaigns", []string{"id", "name", "status", "organization_id", "created_at"}, opts.Campaigns, func(i int) []any {
+		campaignIDs[i] = g.id()
+		name := fmt.Sprintf("%s %d", campaignNames[g.rand.Intn(len(campaignNames))], now.Year()-g.rand.Intn(3))
+		return []any{campaignIDs[i], name, campaignStatuses[g.rand.Intn(len(campaignStatuses))], organizationID, g.createdAt()}
+	})
+	if err != nil {
+		return err
+	}
+
+	// Each campaign goes to one to three groups, with one or two templates
+	var groupLinks, templateLinks [][2]string
+	for _, campaignID := range campaignIDs {
+		for _, i := range g.pick(1+g.rand.Intn(3), opts.Groups) {
+			groupLinks = append(groupLinks, [2]string{groupIDs[i], campaignID})
+		}
+		for _, i := range g.pick(1+g.rand.Intn(2), opts.Templates) {
+			templateLinks = append(templateLinks, [2]string{campaignID, templateIDs[i]})
+		}
+	}
+	err = copyRows(ctx, tx, "email_group_campaigns", []string{"email_group_id", "campaign_id"}, len(groupLinks), func(i int) []any {
+		return []any{groupLinks[i][0], groupLinks[i][1]}
+	})
+	if err != nil {
+		return err
+	}
+	err = copyRows(ctx, tx, "campaign_templates", []string{"campaign_id", "template_id"}, len(templateLinks), func(i int) []any {
+		return []any{templateLinks[i][0], templateLinks[i][1]}
+	})
+	if err != nil {
+		return err
+	}
+	opts.logf("created %d campaigns", opts.Campaigns)
+
+	// So the planner knows the tables' new sizes straight away
+	for _, table := range []string{"email_addresses", "email_groups", "email_group_members", "campaigns", "templates", "email_group_campaigns", "campaign_templates"} {
+		if _, err := tx.ExecContext(ctx, "ANALYZE "+table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type membership struct {
+	groupID   string
+	addressID string
+	createdAt time.Time
+}
+
+// copyRows streams n rows into table with COPY
+func copyRows(ctx context.Context, tx *sql.Tx, table string, columns []string, n int, row func(i int) []any) error {
+	if n == 0 {
+		return nil
+	}
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(table, columns...))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for i := 0; i < n; i++ {
+		if _, err := stmt.ExecContext(ctx, row(i)...); err != nil {
+			return fmt.Errorf("error copying into %s: %w", table, err)
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return fmt.Errorf("error copying into %s: %w", table, err)
+	}
+	return nil
+}
+
+var (
+	firstNames = []string{
+		"ada", "alan", "amara", "ben", "carmen", "chen", "dana", "diego", "elena", "farah",
+		"grace", "hana", "ivan", "jamal", "julia", "kai", "lena", "liam", "maya", "mohammed",
+		"nina", "omar", "priya", "quinn", "rosa", "sam", "sofia", "tariq", "uma", "yuki",
+	}
+	lastNames = []string{
+		"adams", "becker", "castillo", "dubois", "evans", "fischer", "garcia", "hughes", "ito", "jensen",
+		"khan", "lopez", "murphy", "nguyen", "okafor", "patel", "rossi", "silva", "tanaka", "walker",
+	}
+	// Weighted towards the big providers, as real lists are
+	domains = []string{
+		"gmail.com", "gmail.com", "gmail.com", "gmail.com", "yahoo.com", "yahoo.com",
+		"outlook.com", "outlook.com", "hotmail.com", "icloud.com", "aol.com", "proton.me",
+		"comcast.net", "example.com",
+	}
+	groupNames = []string{
+		"Everyone", "Subscribers", "Newsletter", "Customers", "Leads", "VIP", "Trial Users",
+		"Churned", "Over 65", "Under 25", "Impulsive Buyers", "Longterm Subscribers",
+		"Cancelled Subscribers", "Event Attendees", "Webinar Signups", "Partners",
+	}
+	templateNames = []string{
+		"Welcome Email", "Monthly Newsletter", "Product Launch", "Holiday Special", "Birthday Wishes",
+		"Abandoned Cart", "Event Invitation", "Feedback Request", "Order Confirmation", "Weekly Digest",
+	}
+	campaignNames = []string{
+		"Spring Sale", "Summer Sale", "Back to School", "Black Friday", "Holiday", "New Year",
+		"Valentine's Day", "Re-engagement", "Product Launch", "Anniversary", "Catalog", "Special Offers",
+	}
+	// Most campaigns are drafts
+	campaignStatuses = []string{"draft", "draft", "draft", "scheduled", "launched", "launched"}
+)
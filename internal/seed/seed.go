@@ -0,0 +1,93 @@
+// Package seed loads named sets of data into a migrated database, for local
+// development and load testing. Migrations only ever change the schema.
+package seed
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"fmt"
+	"sort"
+)
+
+// Fixture is a named set of data
+type Fixture struct {
+	Name        string
+	Description string
+	run         func(ctx context.Context, tx *sql.Tx, opts Options) error
+}
+
+var fixtures = map[string]Fixture{}
+
+func register(f Fixture) {
+	fixtures[f.Name] = f
+}
+
+func init() {
+	register(Fixture{
+		Name:        "sample",
+		Description: "the sendPulse and Test Org organizations with a handful of addresses, groups, campaigns and templates",
+		run:         runSample,
+	})
+	register(Fixture{
+		Name:        "load",
+		Description: "a generated organization sized by the options, 1M addresses across 50 groups by default",
+		run:         runGenerate,
+	})
+}
+
+// Fixtures returns every fixture, ordered by name
+func Fixtures() []Fixture {
+	list := make([]Fixture, 0, len(fixtures))
+	for _, f := range fixtures {
+		list = append(list, f)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// Run loads the named fixture in a single transaction, so a failure leaves
+// nothing behind
+func Run(ctx context.Context, db *sql.DB, name string, opts Options) error {
+	f, ok := fixtures[name]
+	if !ok {
+		return fmt.Errorf("there is no fixture %q", name)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Large fixtures take far longer than any request should
+	if _, err := tx.ExecContext(ctx, "SET LOCAL statement_timeout = 0"); err != nil {
+		return fmt.Errorf("error disabling statement timeout: %w", err)
+	}
+	if err := f.run(ctx, tx, opts); err != nil {
+		return fmt.Errorf("error seeding %s: %w", name, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+//go:embed sample.sql
+var sampleSQL string
+
+// runSample loads the data the first migration used to insert
+func runSample(ctx context.Context, tx *sql.Tx, _ Options) error {
+	var exists bool
+	err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM organizations WHERE name IN ('sendPulse', 'Test Org'))`).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("the sample organizations already exist")
+	}
+	_, err = tx.ExecContext(ctx, sampleSQL)
+	return err
+}
@@ -0,0 +1,92 @@
+//go:build integration
+
+package seed_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/donnaloia/sendpulse/internal/seed"
+	"github.com/donnaloia/sendpulse/internal/testdb"
+)
+
+func TestMain(m *testing.M) {
+	testdb.Main(m)
+}
+
+func count(t *testing.T, db *sql.DB, query string, args ...any) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestSample(t *testing.T) {
+	ctx := context.Background()
+	db := testdb.New(t)
+
+	if err := seed.Run(ctx, db, "sample", seed.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM organizations`); n != 2 {
+		t.Fatalf("%d organizations", n)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM templates`); n == 0 {
+		t.Fatal("no templates")
+	}
+
+	if err := seed.Run(ctx, db, "sample", seed.Options{}); err == nil {
+		t.Fatal("sample seeded twice")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	ctx := context.Background()
+	db := testdb.New(t)
+
+	opts := seed.DefaultOptions()
+	opts.Organization = "Load"
+	opts.Addresses = 2000
+	opts.Groups = 5
+	opts.Campaigns = 10
+	opts.Templates = 3
+	if err := seed.Run(ctx, db, "load", opts); err != nil {
+		t.Fatal(err)
+	}
+	// Another run gets its own organization and addresses
+	opts.Organization = "Load again"
+	if err := seed.Run(ctx, db, "load", opts); err != nil {
+		t.Fatal(err)
+	}
+
+	var orgID string
+	if err := db.QueryRow(`SELECT id FROM organizations WHERE name = 'Load'`).Scan(&orgID); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM email_addresses WHERE organization_id = $1`, orgID); n != opts.Addresses {
+		t.Fatalf("%d addresses", n)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM email_groups WHERE organization_id = $1`, orgID); n != opts.Groups {
+		t.Fatalf("%d groups", n)
+	}
+	// Every address is in a group, some in two
+	members := count(t, db, `
+		SELECT COUNT(*) FROM email_group_members m
+		JOIN email_groups g ON g.id = m.email_group_id
+		WHERE g.organization_id = $1`, orgID)
+	if members <= opts.Addresses || members > 2*opts.Addresses {
+		t.Fatalf("%d memberships", members)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM campaigns WHERE organization_id = $1`, orgID); n != opts.Campaigns {
+		t.Fatalf("%d campaigns", n)
+	}
+}
+
+func TestUnknownFixture(t *testing.T) {
+	if err := seed.Run(context.Background(), testdb.New(t), "nope", seed.Options{}); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,129 @@
+// Package sending holds the limits on what organizations send: how many
+// recipients their launched campaigns may reach per day and per month, and
+// how fast the sending service may send from each domain.
+package sending
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Limits are an organization's quotas, counted in recipients of launched
+// campaigns per UTC day and calendar month. Zero is no quota.
+type Limits struct {
+	DailyRecipients   int
+	MonthlyRecipients int
+	// Domain is the domain the organization's campaigns are sent from
+	Domain string
+}
+
+// Override is an organization's limits where they differ from the
+// defaults. Fields left out keep the default, so an override can set just
+// a domain; a quota set to 0 is no quota.
+type Override struct {
+	DailyRecipients   *int   `yaml:"daily_recipients"`
+	MonthlyRecipients *int   `yaml:"monthly_recipients"`
+	Domain            string `yaml:"domain"`
+}
+
+// Config is the limits. Per-domain rates and per-organization limits are
+// only read from the config file.
+type Config struct {
+	DailyRecipients   int    `yaml:"daily_recipients" env:"SENDING_DAILY_RECIPIENTS"`
+	MonthlyRecipients int    `yaml:"monthly_recipients" env:"SENDING_MONTHLY_RECIPIENTS"`
+	Domain            string `yaml:"domain" env:"SENDING_DOMAIN"`
+	// MaxSendRate is how many messages per second the sending service may
+	// send from a domain that isn't in DomainRates. Zero is no limit.
+	MaxSendRate float64            `yaml:"max_send_rate" env:"SENDING_MAX_SEND_RATE"`
+	DomainRates map[string]float64 `yaml:"domain_rates"`
+	// Organizations gives organizations, by ID, limits other than the
+	// defaults
+	Organizations map[string]Override `yaml:"organizations"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		DailyRecipients:   10000,
+		MonthlyRecipients: 100000,
+		MaxSendRate:       10,
+	}
+}
+
+func (c *Config) Validate() error {
+	var errs []error
+	if c.DailyRecipients < 0 {
+		errs = append(errs, errors.New("SENDING_DAILY_RECIPIENTS can't be negative"))
+	}
+	if c.MonthlyRecipients < 0 {
+		errs = append(errs, errors.New("SENDING_MONTHLY_RECIPIENTS can't be negative"))
+	}
+	if c.MaxSendRate < 0 {
+		errs = append(errs, errors.New("SENDING_MAX_SEND_RATE can't be negative"))
+	}
+	for _, domain := range sortedKeys(c.DomainRates) {
+		if domain == "" {
+			errs = append(errs, errors.New("sending domain_rates has an empty domain"))
+		}
+		if c.DomainRates[domain] < 0 {
+			errs = append(errs, fmt.Errorf("sending rate for domain %q can't be negative", domain))
+		}
+	}
+	for _, orgID := range sortedKeys(c.Organizations) {
+		override := c.Organizations[orgID]
+		if negative(override.DailyRecipients) || negative(override.MonthlyRecipients) {
+			errs = append(errs, fmt.Errorf("sending quotas of organization %s can't be negative", orgID))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// For returns an organization's limits
+func (c *Config) For(orgID string) Limits {
+	limits := Limits{
+		DailyRecipients:   c.DailyRecipients,
+		MonthlyRecipients: c.MonthlyRecipients,
+		Domain:            c.Domain,
+	}
+	for id, override := range c.Organizations {
+		// IDs are UUIDs, which compare case-insensitively
+		if strings.EqualFold(id, orgID) {
+			if override.DailyRecipients != nil {
+				limits.DailyRecipients = *override.DailyRecipients
+			}
+			if override.MonthlyRecipients != nil {
+				limits.MonthlyRecipients = *override.MonthlyRecipients
+			}
+			if override.Domain != "" {
+				limits.Domain = override.Domain
+			}
+			break
+		}
+	}
+	return limits
+}
+
+// SendRate returns how many messages per second may be sent from domain,
+// or zero for no limit
+func (c *Config) SendRate(domain string) float64 {
+	for d, rate := range c.DomainRates {
+		if strings.EqualFold(d, domain) {
+			return rate
+		}
+	}
+	return c.MaxSendRate
+}
+
+func negative(n *int) bool {
+	return n != nil && *n < 0
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,50 @@
+package sending
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestForMergesOverridesFieldByField(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Domain = "mail.sendpulse.test"
+	err := yaml.Unmarshal([]byte(`
+organizations:
+  3F2A0000-0000-0000-0000-000000000001:
+    domain: mail.acme.test
+  3f2a0000-0000-0000-0000-000000000002:
+    daily_recipients: 0
+    monthly_recipients: 500
+`), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		orgID string
+		want  Limits
+	}{
+		// Only the domain is overridden; the quotas stay the defaults
+		{"3f2a0000-0000-0000-0000-000000000001", Limits{DailyRecipients: 10000, MonthlyRecipients: 100000, Domain: "mail.acme.test"}},
+		// A quota set to 0 is no quota
+		{"3f2a0000-0000-0000-0000-000000000002", Limits{DailyRecipients: 0, MonthlyRecipients: 500, Domain: "mail.sendpulse.test"}},
+		{"3f2a0000-0000-0000-0000-000000000003", Limits{DailyRecipients: 10000, MonthlyRecipients: 100000, Domain: "mail.sendpulse.test"}},
+	} {
+		if got := cfg.For(tt.orgID); got != tt.want {
+			t.Errorf("For(%s) = %+v, want %+v", tt.orgID, got, tt.want)
+		}
+	}
+}
+
+func TestValidateRejectsNegativeOverrides(t *testing.T) {
+	cfg := DefaultConfig()
+	negative := -1
+	cfg.Organizations = map[string]Override{"3f2a": {MonthlyRecipients: &negative}}
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/donnaloia/sendpulse/internal/models"
+)
+
+// API keys look like "sp_<prefix>_<secret>". The prefix is stored in the
+// clear so a key can be looked up and identified in listings; the secret is
+// only ever stored hashed.
+const (
+	apiKeyScheme      = "sp"
+	apiKeyPrefixBytes = 6
+	apiKeySecretBytes = 32
+)
+
+type APIKeyService struct {
+	store Store
+}
+
+func NewAPIKeyService(store Store) *APIKeyService {
+	return &APIKeyService{store: store}
+}
+
+// apiKeyKey is a key's position in a list
+func apiKeyKey(k models.APIKey) rowKey {
+	return rowKey{"created_at": k.CreatedAt, "id": k.ID}
+}
+
+func (s *APIKeyService) GetAll(ctx context.Context, organizationID string, params models.PaginationParams) (*models.PaginatedResponse[models.APIKey], error) {
+	return s.store.APIKeys().List(ctx, organizationID, params)
+}
+
+func (s *APIKeyService) GetByID(ctx context.Context, organizationID string, id string) (*models.APIKey, error) {
+	return s.store.APIKeys().Get(ctx, organizationID, id)
+}
+
+// Create generates a new key. The plaintext key is returned once and can't be
+// recovered afterwards.
+func (s *APIKeyService) Create(ctx context.Context, actor models.Actor, organizationID string, req *models.CreateAPIKey) (*models.CreatedAPIKey, error) {
+	// A key that has already expired could never be used
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, Validation("the key would already have expired", FieldError{Field: "expires_at", Message: "must be in the future"})
+	}
+
+	prefix, err := randomHex(apiKeyPrefixBytes)
+	if err != nil {
+		return nil, fmt.Errorf("error generating api key: %w", err)
+	}
+	secret, err := randomHex(apiKeySecretBytes)
+	if err != nil {
+		return nil, fmt.Errorf("error generating api key: %w", err)
+	}
+	plaintext := fmt.Sprintf("%s_%s_%s", apiKeyScheme, prefix, secret)
+
+	var created models.CreatedAPIKey
+	err = s.store.InTx(ctx, func(tx Store) error {
+		key, err := tx.APIKeys().Create(ctx, organizationID, req, prefix, hashAPIKey(plaintext))
+		if err != nil {
+			return err
+		}
+		created.APIKey = *key
+
+		// The audit snapshot deliberately excludes the plaintext key
+		return recordAudit(ctx, tx, actor, auditRecord{
+			organizationID: organizationID,
+			action:         AuditActionCreate,
+			resourceType:   "api_key",
+			resourceID:     key.ID,
+			after:          key,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	created.Key = plaintext
+	return &created, nil
+}
+
+// Revoke marks a key as revoked. Revoked keys stay listed for auditing.
+func (s *APIKeyService) Revoke(ctx context.Context, actor models.Actor, organizationID string, id string) error {
+	return s.store.InTx(ctx, func(tx Store) error {
+		before, err := tx.APIKeys().GetForUpdate(ctx, organizationID, id)
+		if err != nil {
+			return err
+		}
+		if before.RevokedAt != nil {
+			return NotFound("api key")
+		}
+
+		after, err := tx.APIKeys().Revoke(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		return recordAudit(ctx, tx, actor, auditRecord{
+			organizationID: organizationID,
+			action:         AuditActionRevoke,
+			resourceType:   "api_key",
+			resourceID:     id,
+			before:         before,
+			after:          after,
+		})
+	})
+}
+
+// Authenticate resolves a plaintext key to an active API key and records that
+// it was used
+func (s *APIKeyService) Authenticate(ctx context.Context, plaintext string) (*models.APIKey, error) {
+	scheme, rest, ok := strings.Cut(plaintext, "_")
+	if !ok || scheme != apiKeyScheme {
+		return nil, fmt.Errorf("malformed api key")
+	}
+	prefix, _, ok := strings.Cut(rest, "_")
+	if !ok || prefix == "" {
+		return nil, fmt.Errorf("malformed api key")
+	}
+
+	key, keyHash, err := s.store.APIKeys().GetByPrefix(ctx, prefix)
+	if errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("invalid api key")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(keyHash), []byte(hashAPIKey(plaintext))) != 1 {
+		return nil, fmt.Errorf("invalid api key")
+	}
+	if key.RevokedAt != nil {
+		return nil, fmt.Errorf("api key has been revoked")
+	}
+	if key.ExpiresAt != nil && time.Now().After(*key.ExpiresAt) {
+		return nil, fmt.Errorf("api key has expired")
+	}
+
+	// last_used_at is only kept to the minute, so most requests skip the
+	// write entirely
+	if key.LastUsedAt == nil || time.Since(*key.LastUsedAt) >= apiKeyTouchInterval {
+		if err := s.store.APIKeys().Touch(ctx, key.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return key, nil
+}
+
+// apiKeyTouchInterval is how stale last_used_at may get before a request
+// with the key updates it
+const apiKeyTouchInterval = time.Minute
+
+func hashAPIKey(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/donnaloia/sendpulse/internal/models"
+)
+
+// Audit actions
+const (
+	AuditActionCreate = "create"
+	AuditActionUpdate = "update"
+	AuditActionDelete = "delete"
+	AuditActionLaunch = "launch"
+	AuditActionRevoke = "revoke"
+)
+
+type AuditService struct {
+	store Store
+}
+
+func NewAuditService(store Store) *AuditService {
+	return &AuditService{store: store}
+}
+
+// auditKey is an entry's position in a list
+func auditKey(e models.AuditEntry) rowKey {
+	return rowKey{"created_at": e.CreatedAt, "id": e.ID}
+}
+
+func (s *AuditService) GetAll(ctx context.Context, organizationID string, filter models.AuditFilter, params models.PaginationParams) (*models.PaginatedResponse[models.AuditEntry], error) {
+	return s.store.AuditLog().List(ctx, organizationID, filter, params)
+}
+
+// auditRecord describes one change to write to the audit log
+type auditRecord struct {
+	organizationID string
+	action         string
+	resourceType   string
+	resourceID     string
+	before         any
+	after          any
+}
+
+// recordAudit writes an audit entry through tx, so the entry commits or
+// rolls back together with the change it describes
+func recordAudit(ctx context.Context, tx Store, actor models.Actor, rec auditRecord) error {
+	before, err := auditSnapshot(rec.before)
+	if err != nil {
+		return fmt.Errorf("error encoding audit snapshot: %w", err)
+	}
+	after, err := auditSnapshot(rec.after)
+	if err != nil {
+		return fmt.Errorf("error encoding audit snapshot: %w", err)
+	}
+	changes, err := json.Marshal(auditDiff(before, after))
+	if err != nil {
+		return fmt.Errorf("error encoding audit changes: %w", err)
+	}
+
+	entry := &models.AuditEntry{
+		OrganizationID: rec.organizationID,
+		ActorID:        actor.ID,
+		ActorType:      actor.Type,
+		Action:         rec.action,
+		ResourceType:   rec.resourceType,
+		ResourceID:     rec.resourceID,
+		Before:         rawSnapshot(before),
+		After:          rawSnapshot(after),
+		Changes:        changes,
+		RequestID:      optionalString(actor.RequestID),
+		IP:             optionalString(actor.IP),
+	}
+	return tx.AuditLog().Create(ctx, entry)
+}
+
+// auditSnapshot flattens a model to its JSON fields
+func auditSnapshot(v any) (map[string]any, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return nil, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+type auditChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// auditDiff returns the fields whose values differ between two snapshots
+func auditDiff(before, after map[string]any) map[string]auditChange {
+	changes := map[string]auditChange{}
+	for k, b := range before {
+		if a, ok := after[k]; !ok || !reflect.DeepEqual(a, b) {
+			changes[k] = auditChange{Before: b, After: after[k]}
+		}
+	}
+	for k, a := range after {
+		if _, ok := before[k]; !ok {
+			changes[k] = auditChange{After: a}
+		}
+	}
+	return changes
+}
+
+// rawSnapshot encodes a snapshot, leaving a missing one nil
+func rawSnapshot(m map[string]any) json.RawMessage {
+	if m == nil {
+		return nil
+	}
+	b, _ := json.Marshal(m)
+	return b
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -1,268 +1,277 @@
 package services
 
 import (
-	"database/sql"
-	"fmt"
+	"context"
+	"strings"
 
+	"github.com/donnaloia/sendpulse/internal/events"
+	"github.com/donnaloia/sendpulse/internal/metrics"
 	"github.com/donnaloia/sendpulse/internal/models"
+	"github.com/donnaloia/sendpulse/internal/sending"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 type CampaignService struct {
-	db *sql.DB
+	store  Store
+	relay  *OutboxRelay
+	limits *sending.Config
 }
 
-func NewCampaignService(db *sql.DB) *CampaignService {
-	return &CampaignService{db: db}
+func NewCampaignService(store Store) *CampaignService {
+	return &CampaignService{store: store, limits: &sending.Config{}}
 }
 
-func (s *CampaignService) GetAll(organizationID string, params models.PaginationParams) (*models.PaginatedResponse[models.Campaign], error) {
-	if params.Page < 1 {
-		params.Page = 1
-	}
-	if params.PageSize < 1 {
-		params.PageSize = 10
-	}
-
-	var total int
-	err := s.db.QueryRow(
-		"SELECT COUNT(*) FROM campaigns WHERE organization_id = $1",
-		organizationID,
-	).Scan(&total)
-	if err != nil {
-		return nil, fmt.Errorf("error counting campaigns: %w", err)
-	}
-
-	offset := (params.Page - 1) * params.PageSize
-	rows, err := s.db.Query(
-		`SELECT id, name, status, organization_id, created_at 
-		FROM campaigns 
-		WHERE organization_id = $1
-		ORDER BY created_at DESC 
-		LIMIT $2 OFFSET $3`,
-		organizationID, params.PageSize, offset,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("error fetching campaigns: %w", err)
-	}
-	defer rows.Close()
-
-	var campaigns []models.Campaign
-	for rows.Next() {
-		var campaign models.Campaign
-		if err := rows.Scan(
-			&campaign.ID,
-			&campaign.Name,
-			&campaign.Status,
-			&campaign.OrganizationID,
-			&campaign.CreatedAt,
-		); err != nil {
-			return nil, fmt.Errorf("error scanning campaign: %w", err)
-		}
-		campaigns = append(campaigns, campaign)
-	}
-
-	return models.NewPaginatedResponse(campaigns, total, params.Page, params.PageSize), nil
+// SetRelay makes launches publish an event: it's added to the outbox in the
+// launch's transaction, and relay, which must read the same database, is
+// woken to publish it. Without one, launching only changes the campaign's
+// status.
+func (s *CampaignService) SetRelay(relay *OutboxRelay) {
+	s.relay = relay
 }
 
-func (s *CampaignService) GetByID(organizationID string, id string) (*models.Campaign, error) {
-	var campaign models.Campaign
-	err := s.db.QueryRow(
-		`SELECT id, name, status, organization_id, created_at 
-		FROM campaigns 
-		WHERE id = $1 AND organization_id = $2`,
-		id, organizationID,
-	).Scan(
-		&campaign.ID,
-		&campaign.Name,
-		&campaign.Status,
-		&campaign.OrganizationID,
-		&campaign.CreatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("campaign not found")
-	}
-	if err != nil {
-		return nil, fmt.Errorf("error fetching campaign: %w", err)
-	}
-
-	// Get the templates
-	rows, err := s.db.Query(`
-		SELECT t.id, t.name, t.organization_id, t.html, t.created_at
-		FROM templates t
-		JOIN campaign_templates ct ON ct.template_id = t.id
-		WHERE ct.campaign_id = $1`,
-		id,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("error fetching templates: %w", err)
-	}
-	defer rows.Close()
-
-	// Validate templates
-	campaign.Templates = []models.Template{}
-	for rows.Next() {
-		var template models.Template
-		if err := rows.Scan(
-			&template.ID,
-			&template.Name,
-			&template.OrganizationID,
-			&template.HTML,
-			&template.CreatedAt,
-		); err != nil {
-			return nil, fmt.Errorf("error scanning template: %w", err)
-		}
-		// Update campaign with the templates
-		campaign.Templates = append(campaign.Templates, template)
-	}
+// SetLimits checks launches against the organization's sending quotas.
+// Without limits, launches are counted but never refused.
+func (s *CampaignService) SetLimits(limits *sending.Config) {
+	s.limits = limits
+}
 
-	// Get the email groups
-	rows, err = s.db.Query(`
-		SELECT eg.id, eg.name, eg.organization_id, eg.created_at
-		FROM email_groups eg
-		JOIN email_group_campaigns egc ON egc.email_group_id = eg.id
-		WHERE egc.campaign_id = $1`,
-		id,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("error fetching email groups: %w", err)
-	}
-	defer rows.Close()
+// campaignListSpec is what GET /campaigns accepts in sort, filters and q
+var campaignListSpec = &listSpec{
+	sortable: map[string]listColumn{
+		"name":       nameColumn,
+		"status":     {expr: "status", typ: "text"},
+		"created_at": createdAtColumn,
+	},
+	filterable: map[string]listColumn{
+		"name":   nameColumn,
+		"status": {expr: "status", typ: "text"},
+	},
+	searchable: []string{"name"},
+}
 
-	// Validate email groups
-	campaign.EmailGroups = []models.EmailGroup{}
-	for rows.Next() {
-		var emailGroup models.EmailGroup
-		if err := rows.Scan(
-			&emailGroup.ID,
-			&emailGroup.Name,
-			&emailGroup.OrganizationID,
-			&emailGroup.CreatedAt,
-		); err != nil {
-			return nil, fmt.Errorf("error scanning email group: %w", err)
-		}
-		// Update campaign with the email groups
-		campaign.EmailGroups = append(campaign.EmailGroups, emailGroup)
-	}
+// campaignKey is a campaign's position in a list
+func campaignKey(c models.Campaign) rowKey {
+	return rowKey{"created_at": c.CreatedAt, "name": c.Name, "status": c.Status, "id": c.ID}
+}
 
-	return &campaign, nil
+func (s *CampaignService) GetAll(ctx context.Context, organizationID string, query models.ListQuery, params models.PaginationParams) (*models.PaginatedResponse[models.Campaign], error) {
+	return s.store.Campaigns().List(ctx, organizationID, query, params)
 }
 
-func (s *CampaignService) Create(organizationID string, req *models.CreateCampaign) (*models.Campaign, error) {
-	var campaign models.Campaign
-	err := s.db.QueryRow(
-		`INSERT INTO campaigns (name, organization_id) 
-		VALUES ($1, $2) 
-		RETURNING id, name, status, organization_id, created_at`,
-		req.Name, organizationID,
-	).Scan(
-		&campaign.ID,
-		&campaign.Name,
-		&campaign.Status,
-		&campaign.OrganizationID,
-		&campaign.CreatedAt,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("error creating campaign: %w", err)
-	}
-	return &campaign, nil
+func (s *CampaignService) GetByID(ctx context.Context, organizationID string, id string) (*models.Campaign, error) {
+	return s.store.Campaigns().Get(ctx, organizationID, id)
 }
 
-func (s *CampaignService) Update(organizationID string, id string, req *models.UpdateCampaign) (*models.Campaign, error) {
-	// Start a transaction since we're updating multiple tables
-	tx, err := s.db.Begin()
-	if err != nil {
-		return nil, fmt.Errorf("error starting transaction: %w", err)
-	}
-	defer tx.Rollback() // Rollback if we don't commit
+func (s *CampaignService) Create(ctx context.Context, actor models.Actor, organizationID string, req *models.CreateCampaign) (*models.Campaign, error) {
+	var campaign *models.Campaign
+	err := s.store.InTx(ctx, func(tx Store) error {
+		var err error
+		campaign, err = tx.Campaigns().Create(ctx, organizationID, req)
+		if err != nil {
+			return err
+		}
 
-	// Get current campaign state
-	currentCampaign, err := s.GetByID(organizationID, id)
+		return recordAudit(ctx, tx, actor, auditRecord{
+			organizationID: organizationID,
+			action:         AuditActionCreate,
+			resourceType:   "campaign",
+			resourceID:     campaign.ID,
+			after:          newCampaignSnapshot(campaign),
+		})
+	})
 	if err != nil {
 		return nil, err
 	}
+	return campaign, nil
+}
 
-	// Update campaign name if provided
-	if req.Name != "" {
-		_, err = tx.Exec(
-			`UPDATE campaigns 
-			 SET name = $1
-			 WHERE id = $2 AND organization_id = $3`,
-			req.Name, id, organizationID,
-		)
+// Update applies req to the campaign. When version is non-zero the update
+// only goes ahead if the campaign is still at that version.
+func (s *CampaignService) Update(ctx context.Context, actor models.Actor, organizationID string, id string, req *models.UpdateCampaign, version int) (*models.Campaign, error) {
+	var updatedCampaign *models.Campaign
+	var action string
+	err := s.store.InTx(ctx, func(tx Store) error {
+		// Lock the campaign so concurrent updates queue up behind the
+		// version check instead of overwriting each other
+		currentCampaign, err := tx.Campaigns().GetForUpdate(ctx, organizationID, id)
 		if err != nil {
-			return nil, fmt.Errorf("error updating campaign name: %w", err)
+			return err
+		}
+		if err := checkVersion("campaign", currentCampaign.Version, version); err != nil {
+			return err
+		}
+		if currentCampaign.Status == models.CampaignStatusLaunched {
+			return Conflict("launched campaigns can't be changed")
 		}
-	}
 
-	// Update templates if provided
-	if req.Templates != nil {
-		// First, remove all existing template associations
-		_, err = tx.Exec(
-			`DELETE FROM campaign_templates 
-			 WHERE campaign_id = $1`,
-			id,
-		)
+		// Only the organization's own templates and groups can be linked
+		missing, err := tx.Templates().Missing(ctx, organizationID, req.Templates)
 		if err != nil {
-			return nil, fmt.Errorf("error removing existing templates: %w", err)
+			return err
+		}
+		if err := checkReferences("templates", missing); err != nil {
+			return err
+		}
+		missing, err = tx.EmailGroups().Missing(ctx, organizationID, req.EmailGroups)
+		if err != nil {
+			return err
+		}
+		if err := checkReferences("email_groups", missing); err != nil {
+			return err
 		}
 
-		// Then add new template associations
-		for _, templateID := range req.Templates {
-			_, err = tx.Exec(
-				`INSERT INTO campaign_templates (campaign_id, template_id)
-				 VALUES ($1, $2)`,
-				id, templateID,
-			)
-			if err != nil {
-				return nil, fmt.Errorf("error adding template %s: %w", templateID, err)
+		// Only the links that actually changed are written, so re-saving a
+		// large campaign with the same groups doesn't churn the link tables
+		change := &CampaignChange{Name: req.Name, Status: req.Status}
+		if req.Templates != nil {
+			current := make([]string, len(currentCampaign.Templates))
+			for i, t := range currentCampaign.Templates {
+				current[i] = t.ID
 			}
+			change.AddTemplates, change.RemoveTemplates = diffIDs(current, req.Templates)
+		}
+		if req.EmailGroups != nil {
+			current := make([]string, len(currentCampaign.EmailGroups))
+			for i, g := range currentCampaign.EmailGroups {
+				current[i] = g.ID
+			}
+			change.AddEmailGroups, change.RemoveEmailGroups = diffIDs(current, req.EmailGroups)
+		}
+		if err := tx.Campaigns().Update(ctx, organizationID, id, change); err != nil {
+			return err
 		}
 
-	}
-
-	// Update the email_groups if provided
-	if req.EmailGroups != nil {
-		_, err = tx.Exec(
-			`DELETE FROM email_group_campaigns 
-			 WHERE campaign_id = $1`,
-			id,
-		)
+		updatedCampaign, err = tx.Campaigns().Get(ctx, organizationID, id)
 		if err != nil {
-			return nil, fmt.Errorf("error removing existing email_groups: %w", err)
+			return err
 		}
 
-		for _, emailGroupID := range req.EmailGroups {
-			_, err = tx.Exec(
-				`INSERT INTO email_group_campaigns (campaign_id, email_group_id)
-				 VALUES ($1, $2)`,
-				id, emailGroupID,
-			)
+		// Launches are recorded as their own action so they're easy to find
+		action = AuditActionUpdate
+		if currentCampaign.Status != updatedCampaign.Status && updatedCampaign.Status == models.CampaignStatusLaunched {
+			action = AuditActionLaunch
+			// The audience is read in the launch's transaction, so it's the
+			// one the campaign was launched with and counted against the
+			// quotas
+			recipients, err := tx.Campaigns().Recipients(ctx, organizationID, id)
 			if err != nil {
-				return nil, fmt.Errorf("error adding email_group %s: %w", emailGroupID, err)
+				return err
+			}
+			limits := s.limits.For(organizationID)
+			if err := reserveRecipients(ctx, tx, limits, organizationID, len(recipients)); err != nil {
+				return err
+			}
+			// The event is committed with the launch, so it's published
+			// once the launch can't roll back, and still published if the
+			// brokers are down until later
+			if s.relay != nil {
+				rate := s.limits.SendRate(limits.Domain)
+				sendAt, err := scheduleDomain(ctx, tx, limits.Domain, rate, len(recipients))
+				if err != nil {
+					return err
+				}
+				msg := &OutboxMessage{
+					Event:        *newCampaignLaunchedEvent(updatedCampaign, recipients, limits.Domain, rate),
+					TraceContext: map[string]string{},
+					SendAt:       sendAt,
+				}
+				otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(msg.TraceContext))
+				if err := tx.Outbox().Add(ctx, msg); err != nil {
+					return err
+				}
 			}
 		}
+		return recordAudit(ctx, tx, actor, auditRecord{
+			organizationID: organizationID,
+			action:         action,
+			resourceType:   "campaign",
+			resourceID:     id,
+			before:         newCampaignSnapshot(currentCampaign),
+			after:          newCampaignSnapshot(updatedCampaign),
+		})
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// Update campaign status
-	if req.Status != "" {
-		_, err = tx.Exec(
-			`UPDATE campaigns SET status = $1 WHERE id = $2 AND organization_id = $3`,
-			req.Status, id, organizationID,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("error updating campaign status: %w", err)
+	if action == AuditActionLaunch {
+		metrics.CampaignsLaunched.Inc()
+		if s.relay != nil {
+			s.relay.Notify()
 		}
 	}
 
-	// Commit the transaction
-	if err = tx.Commit(); err != nil {
-		return nil, fmt.Errorf("error committing transaction: %w", err)
+	// Return the updated campaign
+	return updatedCampaign, nil
+}
+
+// newCampaignLaunchedEvent tells the sending service what to send, and how
+// fast it may send from domain
+func newCampaignLaunchedEvent(c *models.Campaign, recipients []string, domain string, maxSendRate float64) *events.CampaignLaunchedEvent {
+	templateIDs := make([]string, len(c.Templates))
+	for i, t := range c.Templates {
+		templateIDs[i] = t.ID
+	}
+	return &events.CampaignLaunchedEvent{
+		CampaignID:     c.ID,
+		OrganizationID: c.OrganizationID,
+		EmailAddresses: recipients,
+		TemplateIDs:    templateIDs,
+		SendingDomain:  domain,
+		MaxSendRate:    maxSendRate,
 	}
+}
 
-	if currentCampaign.Status != req.Status && req.Status == models.CampaignStatusLaunched {
-		// events.PublishEmails(campaign.id, "campaign.launched")
+// diffIDs returns the IDs in wanted but not current, and in current but not
+// wanted. IDs are compared case-insensitively and duplicates are dropped.
+func diffIDs(current, wanted []string) (added, removed []string) {
+	have := make(map[string]bool, len(current))
+	for _, id := range current {
+		have[strings.ToLower(id)] = true
+	}
+	want := make(map[string]bool, len(wanted))
+	for _, id := range wanted {
+		id = strings.ToLower(id)
+		if !want[id] && !have[id] {
+			added = append(added, id)
+		}
+		want[id] = true
 	}
+	for _, id := range current {
+		if !want[strings.ToLower(id)] {
+			removed = append(removed, id)
+		}
+	}
+	return added, removed
+}
 
-	// Return the updated campaign
-	return s.GetByID(organizationID, id)
+// campaignSnapshot is the audit log view of a campaign. Linked templates and
+// groups are recorded by ID so template HTML isn't copied into every entry.
+type campaignSnapshot struct {
+	ID             string   `json:"id"`
+	Name           string   `json:"name"`
+	Status         string   `json:"status"`
+	OrganizationID string   `json:"organization_id"`
+	TemplateIDs    []string `json:"template_ids"`
+	EmailGroupIDs  []string `json:"email_group_ids"`
+}
+
+func newCampaignSnapshot(c *models.Campaign) *campaignSnapshot {
+	snapshot := &campaignSnapshot{
+		ID:             c.ID,
+		Name:           c.Name,
+		Status:         c.Status,
+		OrganizationID: c.OrganizationID,
+		TemplateIDs:    []string{},
+		EmailGroupIDs:  []string{},
+	}
+	for _, t := range c.Templates {
+		snapshot.TemplateIDs = append(snapshot.TemplateIDs, t.ID)
+	}
+	for _, g := range c.EmailGroups {
+		snapshot.EmailGroupIDs = append(snapshot.EmailGroupIDs, g.ID)
+	}
+	return snapshot
 }
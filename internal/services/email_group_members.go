@@ -1,121 +1,83 @@
 package services
 
 import (
-	"database/sql"
-	"fmt"
+	"context"
 
 	"github.com/donnaloia/sendpulse/internal/models"
 )
 
 type EmailGroupMemberService struct {
-	db *sql.DB
+	store Store
 }
 
-func NewEmailGroupMemberService(db *sql.DB) *EmailGroupMemberService {
-	return &EmailGroupMemberService{db: db}
+func NewEmailGroupMemberService(store Store) *EmailGroupMemberService {
+	return &EmailGroupMemberService{store: store}
 }
 
-func (s *EmailGroupMemberService) GetAll(params models.PaginationParams) (*models.PaginatedResponse[models.EmailGroupMember], error) {
-	if params.Page < 1 {
-		params.Page = 1
-	}
-	if params.PageSize < 1 {
-		params.PageSize = 10
-	}
+// memberKey is a member's position in a list
+func memberKey(m models.EmailGroupMember) rowKey {
+	return rowKey{"created_at": m.CreatedAt, "id": m.ID}
+}
 
-	var total int
-	err := s.db.QueryRow("SELECT COUNT(*) FROM email_group_members").Scan(&total)
-	if err != nil {
-		return nil, fmt.Errorf("error counting group members: %w", err)
-	}
+func (s *EmailGroupMemberService) GetAll(ctx context.Context, organizationID string, params models.PaginationParams) (*models.PaginatedResponse[models.EmailGroupMember], error) {
+	return s.store.EmailGroups().ListMembers(ctx, organizationID, params)
+}
 
-	offset := (params.Page - 1) * params.PageSize
-	rows, err := s.db.Query(
-		`SELECT id, email_group_id, email_address_id, created_at
-		FROM email_group_members
-		ORDER BY created_at DESC
-		LIMIT $1 OFFSET $2`,
-		params.PageSize, offset,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("error fetching group members: %w", err)
-	}
-	defer rows.Close()
+func (s *EmailGroupMemberService) GetByID(ctx context.Context, organizationID string, id string) (*models.EmailGroupMember, error) {
+	return s.store.EmailGroups().GetMember(ctx, organizationID, id)
+}
 
-	var members []models.EmailGroupMember
-	for rows.Next() {
-		var member models.EmailGroupMember
-		if err := rows.Scan(
-			&member.ID,
-			&member.EmailGroupID,
-			&member.EmailAddressID,
-			&member.CreatedAt,
-		); err != nil {
-			return nil, fmt.Errorf("error scanning group member: %w", err)
+func (s *EmailGroupMemberService) Create(ctx context.Context, actor models.Actor, organizationID string, req *models.CreateEmailGroupMember) (*models.EmailGroupMember, error) {
+	var member *models.EmailGroupMember
+	err := s.store.InTx(ctx, func(tx Store) error {
+		// Both sides of the membership must belong to the organization
+		missing, err := tx.EmailGroups().Missing(ctx, organizationID, []string{req.EmailGroupID})
+		if err != nil {
+			return err
+		}
+		if err := checkReferences("email_group_id", missing); err != nil {
+			return err
+		}
+		missing, err = tx.EmailAddresses().Missing(ctx, organizationID, []string{req.EmailAddressID})
+		if err != nil {
+			return err
+		}
+		if err := checkReferences("email_address_id", missing); err != nil {
+			return err
 		}
-		members = append(members, member)
-	}
-
-	return models.NewPaginatedResponse(members, total, params.Page, params.PageSize), nil
-}
 
-func (s *EmailGroupMemberService) GetByID(id string) (*models.EmailGroupMember, error) {
-	var member models.EmailGroupMember
-	err := s.db.QueryRow(
-		`SELECT id, email_group_id, email_address_id, created_at
-		FROM email_group_members
-		WHERE id = $1`,
-		id,
-	).Scan(
-		&member.ID,
-		&member.EmailGroupID,
-		&member.EmailAddressID,
-		&member.CreatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("group member not found")
-	}
-	if err != nil {
-		return nil, fmt.Errorf("error fetching group member: %w", err)
-	}
-	return &member, nil
-}
+		member, err = tx.EmailGroups().AddMember(ctx, req)
+		if err != nil {
+			return err
+		}
 
-func (s *EmailGroupMemberService) Create(req *models.CreateEmailGroupMember) (*models.EmailGroupMember, error) {
-	var member models.EmailGroupMember
-	err := s.db.QueryRow(
-		`INSERT INTO email_group_members (email_group_id, email_address_id)
-		VALUES ($1, $2)
-		RETURNING id, email_group_id, email_address_id, created_at`,
-		req.EmailGroupID, req.EmailAddressID,
-	).Scan(
-		&member.ID,
-		&member.EmailGroupID,
-		&member.EmailAddressID,
-		&member.CreatedAt,
-	)
+		return recordAudit(ctx, tx, actor, auditRecord{
+			organizationID: organizationID,
+			action:         AuditActionCreate,
+			resourceType:   "email_group_member",
+			resourceID:     member.ID,
+			after:          member,
+		})
+	})
 	if err != nil {
-		return nil, fmt.Errorf("error creating group member: %w", err)
+		return nil, err
 	}
-	return &member, nil
+	return member, nil
 }
 
-func (s *EmailGroupMemberService) Delete(groupID, memberID string) error {
-	result, err := s.db.Exec(
-		"DELETE FROM email_group_members WHERE email_group_id = $1 AND id = $2",
-		groupID, memberID,
-	)
-	if err != nil {
-		return fmt.Errorf("error deleting group member: %w", err)
-	}
-
-	rows, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("error checking deletion result: %w", err)
-	}
-	if rows == 0 {
-		return fmt.Errorf("group member not found")
-	}
+func (s *EmailGroupMemberService) Delete(ctx context.Context, actor models.Actor, organizationID string, id string) error {
+	return s.store.InTx(ctx, func(tx Store) error {
+		member, err := tx.EmailGroups().RemoveMember(ctx, organizationID, id)
+		if err != nil {
+			return err
+		}
 
-	return nil
+		return recordAudit(ctx, tx, actor, auditRecord{
+			organizationID: organizationID,
+			action:         AuditActionDelete,
+			resourceType:   "email_group_member",
+			resourceID:     member.ID,
+			before:         member,
+		})
+	})
 }
@@ -1,102 +1,63 @@
 package services
 
 import (
-	"database/sql"
-	"fmt"
+	"context"
 
 	"github.com/donnaloia/sendpulse/internal/models"
 )
 
 type EmailGroupService struct {
-	db *sql.DB
+	store Store
 }
 
-func NewEmailGroupService(db *sql.DB) *EmailGroupService {
-	return &EmailGroupService{db: db}
+func NewEmailGroupService(store Store) *EmailGroupService {
+	return &EmailGroupService{store: store}
 }
 
-func (s *EmailGroupService) GetAll(organizationID string, params models.PaginationParams) (*models.PaginatedResponse[models.EmailGroup], error) {
-	if params.Page < 1 {
-		params.Page = 1
-	}
-	if params.PageSize < 1 {
-		params.PageSize = 10
-	}
-
-	// Get total count
-	var total int
-	err := s.db.QueryRow("SELECT COUNT(*) FROM email_groups WHERE organization_id = $1", organizationID).Scan(&total)
-	if err != nil {
-		return nil, fmt.Errorf("error counting email groups: %w", err)
-	}
-
-	// Calculate offset
-	offset := (params.Page - 1) * params.PageSize
-	rows, err := s.db.Query(
-		`SELECT id, name, organization_id, created_at 
-		FROM email_groups 
-		ORDER BY created_at DESC 
-		LIMIT $1 OFFSET $2`,
-		params.PageSize, offset,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("error fetching email groups: %w", err)
-	}
-	defer rows.Close()
+// emailGroupListSpec is what GET /email-groups accepts in sort, filters and q
+var emailGroupListSpec = &listSpec{
+	sortable: map[string]listColumn{
+		"name":       nameColumn,
+		"created_at": createdAtColumn,
+	},
+	filterable: map[string]listColumn{
+		"name": nameColumn,
+	},
+	searchable: []string{"name"},
+}
 
-	var groups []models.EmailGroup
-	for rows.Next() {
-		var group models.EmailGroup
-		if err := rows.Scan(
-			&group.ID,
-			&group.Name,
-			&group.OrganizationID,
-			&group.CreatedAt,
-		); err != nil {
-			return nil, fmt.Errorf("error scanning email group: %w", err)
-		}
-		groups = append(groups, group)
-	}
+// emailGroupKey is a group's position in a list
+func emailGroupKey(g models.EmailGroup) rowKey {
+	return rowKey{"created_at": g.CreatedAt, "name": g.Name, "id": g.ID}
+}
 
-	return models.NewPaginatedResponse(groups, total, params.Page, params.PageSize), nil
+func (s *EmailGroupService) GetAll(ctx context.Context, organizationID string, query models.ListQuery, params models.PaginationParams) (*models.PaginatedResponse[models.EmailGroup], error) {
+	return s.store.EmailGroups().List(ctx, organizationID, query, params)
 }
 
-func (s *EmailGroupService) GetByID(organizationID string, id string) (*models.EmailGroup, error) {
-	var group models.EmailGroup
-	err := s.db.QueryRow(
-		"SELECT id, name, organization_id, created_at FROM email_groups WHERE id = $1",
-		id,
-	).Scan(
-		&group.ID,
-		&group.Name,
-		&group.OrganizationID,
-		&group.CreatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("email group not found")
-	}
-	if err != nil {
-		return nil, fmt.Errorf("error fetching email group: %w", err)
-	}
-	return &group, nil
+func (s *EmailGroupService) GetByID(ctx context.Context, organizationID string, id string) (*models.EmailGroup, error) {
+	return s.store.EmailGroups().Get(ctx, organizationID, id)
 }
 
-func (s *EmailGroupService) Create(organizationID string, req *models.CreateEmailGroup) (*models.EmailGroup, error) {
-	var group models.EmailGroup
-	err := s.db.QueryRow(
-		`INSERT INTO email_groups (name, organization_id) 
-		VALUES ($1, $2) 
-		RETURNING id, name, organization_id, created_at`,
-		req.Name,
-		organizationID,
-	).Scan(
-		&group.ID,
-		&group.Name,
-		&group.OrganizationID,
-		&group.CreatedAt,
-	)
+func (s *EmailGroupService) Create(ctx context.Context, actor models.Actor, organizationID string, req *models.CreateEmailGroup) (*models.EmailGroup, error) {
+	var group *models.EmailGroup
+	err := s.store.InTx(ctx, func(tx Store) error {
+		var err error
+		group, err = tx.EmailGroups().Create(ctx, organizationID, req)
+		if err != nil {
+			return err
+		}
+
+		return recordAudit(ctx, tx, actor, auditRecord{
+			organizationID: organizationID,
+			action:         AuditActionCreate,
+			resourceType:   "email_group",
+			resourceID:     group.ID,
+			after:          group,
+		})
+	})
 	if err != nil {
-		return nil, fmt.Errorf("error creating email group: %w", err)
+		return nil, err
 	}
-	return &group, nil
+	return group, nil
 }
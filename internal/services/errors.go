@@ -0,0 +1,193 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Error kinds. Every *Error wraps exactly one of these, so callers can test
+// for a kind with errors.Is.
+var (
+	ErrNotFound   = errors.New("not found")
+	ErrConflict   = errors.New("conflict")
+	ErrValidation = errors.New("validation failed")
+	ErrForbidden  = errors.New("forbidden")
+
+	ErrPreconditionFailed = errors.New("precondition failed")
+	ErrQuotaExceeded      = errors.New("quota exceeded")
+)
+
+// FieldError describes what is wrong with one field of a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is a domain error: safe to show to the caller, unlike the database
+// error it may wrap
+type Error struct {
+	Kind    error
+	Message string
+	Details []FieldError
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Err != nil {
+		return []error{e.Kind, e.Err}
+	}
+	return []error{e.Kind}
+}
+
+// NotFound reports that a resource doesn't exist, e.g. NotFound("campaign")
+func NotFound(resource string) *Error {
+	return &Error{Kind: ErrNotFound, Message: resource + " not found"}
+}
+
+// Conflict reports that a change clashes with existing data
+func Conflict(message string, details ...FieldError) *Error {
+	return &Error{Kind: ErrConflict, Message: message, Details: details}
+}
+
+// Validation reports that a request is well-formed but not acceptable
+func Validation(message string, details ...FieldError) *Error {
+	return &Error{Kind: ErrValidation, Message: message, Details: details}
+}
+
+// Forbidden reports that the caller may not perform an otherwise valid change
+func Forbidden(message string) *Error {
+	return &Error{Kind: ErrForbidden, Message: message}
+}
+
+// PreconditionFailed reports that a conditional write found the resource
+// changed since the caller read it
+func PreconditionFailed(message string) *Error {
+	return &Error{Kind: ErrPreconditionFailed, Message: message}
+}
+
+// QuotaExceeded reports that a change would take the organization over one
+// of its quotas
+func QuotaExceeded(message string, details ...FieldError) *Error {
+	return &Error{Kind: ErrQuotaExceeded, Message: message, Details: details}
+}
+
+// Postgres error codes with a meaning for callers
+const (
+	pqUniqueViolation     = "23505"
+	pqForeignKeyViolation = "23503"
+	pqCheckViolation      = "23514"
+	pqNotNullViolation    = "23502"
+	pqInvalidTextRepr     = "22P02"
+	pqQueryCanceled       = "57014"
+)
+
+// IsTimeout reports whether err comes from a query stopped by its context
+// deadline or by the server's statement_timeout
+func IsTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == pqQueryCanceled
+}
+
+// AsError returns the domain error in err's chain. Constraint violations
+// from Postgres are translated, so they reach the caller as conflicts and
+// validation failures rather than raw database messages. Anything else
+// returns false.
+func AsError(err error) (*Error, bool) {
+	var domainErr *Error
+	if errors.As(err, &domainErr) {
+		return domainErr, true
+	}
+
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return nil, false
+	}
+	switch pqErr.Code {
+	case pqUniqueViolation:
+		e := Conflict("a record with the same values already exists", keyFieldErrors(pqErr, "already exists")...)
+		e.Err = err
+		return e, true
+	case pqForeignKeyViolation:
+		e := Validation("a referenced resource does not exist", keyFieldErrors(pqErr, "does not exist")...)
+		e.Err = err
+		return e, true
+	case pqCheckViolation:
+		e := Validation("a value is not allowed", FieldError{
+			Field:   constraintField(pqErr),
+			Message: fmt.Sprintf("violates constraint %s", pqErr.Constraint),
+		})
+		e.Err = err
+		return e, true
+	case pqNotNullViolation:
+		e := Validation("a required value is missing", FieldError{Field: pqErr.Column, Message: "is required"})
+		e.Err = err
+		return e, true
+	case pqInvalidTextRepr:
+		e := Validation("a value is malformed")
+		e.Err = err
+		return e, true
+	}
+	return nil, false
+}
+
+// keyPattern picks the column list out of a violation detail such as
+// `Key (organization_id, address)=(...) already exists.`
+var keyPattern = regexp.MustCompile(`^Key \(([^)]+)\)=`)
+
+// keyFieldErrors names the columns of a unique or foreign key violation. The
+// offending values are left out since they can belong to another tenant.
+func keyFieldErrors(pqErr *pq.Error, message string) []FieldError {
+	m := keyPattern.FindStringSubmatch(pqErr.Detail)
+	if m == nil {
+		return nil
+	}
+	var details []FieldError
+	for _, col := range strings.Split(m[1], ",") {
+		details = append(details, FieldError{Field: strings.TrimSpace(col), Message: message})
+	}
+	return details
+}
+
+func constraintField(pqErr *pq.Error) string {
+	if pqErr.Column != "" {
+		return pqErr.Column
+	}
+	return pqErr.Constraint
+}
+
+// checkVersion fails when the caller asked for a version other than the
+// current one. Version 0 means the caller didn't ask.
+func checkVersion(resource string, current, version int) error {
+	if version != 0 && current != version {
+		return PreconditionFailed(fmt.Sprintf("%s has been modified since version %d", resource, version))
+	}
+	return nil
+}
+
+// checkReferences returns a validation error naming the referenced ids that
+// don't exist
+func checkReferences(field string, missing []string) error {
+	var details []FieldError
+	for _, id := range missing {
+		details = append(details, FieldError{Field: field, Message: fmt.Sprintf("%s does not exist", id)})
+	}
+	if details != nil {
+		return Validation("a referenced resource does not exist", details...)
+	}
+	return nil
+}
@@ -0,0 +1,361 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/donnaloia/sendpulse/internal/models"
+)
+
+// MemoryStore is a Store kept in process memory, for tests that shouldn't
+// need a database. It enforces the same keys and references as the schema and
+// pages lists the same way. A transaction holds the store-wide lock and rolls
+// back by restoring a copy of the data taken when it began.
+type MemoryStore struct {
+	mu   *sync.RWMutex
+	data *memoryData
+	// inTx is set on the Store handed to an InTx callback, which already
+	// holds the lock
+	inTx bool
+}
+
+type memoryData struct {
+	organizations map[string]models.Organization
+	profiles      map[string]models.Profile
+	emails        map[string]models.EmailAddress
+	emailGroups   map[string]models.EmailGroup
+	members       map[string]models.EmailGroupMember
+	templates     map[string]models.Template
+	campaigns     map[string]memoryCampaign
+	apiKeys       map[string]memoryAPIKey
+	auditLog      map[string]models.AuditEntry
+	// sendingUsage is keyed by organization ID and day, as "<id>/<date>"
+	sendingUsage map[string]int
+	// sendingSchedule is when each domain is next free, by lowercased
+	// domain
+	sendingSchedule map[string]time.Time
+	outbox          map[int64]OutboxMessage
+	lastOutboxID    int64
+
+	// lastNow keeps timestamps strictly increasing, so rows created back to
+	// back still list in creation order
+	lastNow time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		mu: &sync.RWMutex{},
+		data: &memoryData{
+			organizations:   map[string]models.Organization{},
+			profiles:        map[string]models.Profile{},
+			emails:          map[string]models.EmailAddress{},
+			emailGroups:     map[string]models.EmailGroup{},
+			members:         map[string]models.EmailGroupMember{},
+			templates:       map[string]models.Template{},
+			campaigns:       map[string]memoryCampaign{},
+			apiKeys:         map[string]memoryAPIKey{},
+			auditLog:        map[string]models.AuditEntry{},
+			sendingUsage:    map[string]int{},
+			sendingSchedule: map[string]time.Time{},
+			outbox:          map[int64]OutboxMessage{},
+		},
+	}
+}
+
+func (s *MemoryStore) Organizations() OrganizationRepository {
+	return &memoryOrganizations{s: s}
+}
+
+func (s *MemoryStore) Profiles() ProfileRepository {
+	return &memoryProfiles{s: s}
+}
+
+func (s *MemoryStore) EmailAddresses() EmailAddressRepository {
+	return &memoryEmailAddresses{s: s}
+}
+
+func (s *MemoryStore) EmailGroups() EmailGroupRepository {
+	return &memoryEmailGroups{s: s}
+}
+
+func (s *MemoryStore) Templates() TemplateRepository {
+	return &memoryTemplates{s: s}
+}
+
+func (s *MemoryStore) Campaigns() CampaignRepository {
+	return &memoryCampaigns{s: s}
+}
+
+func (s *MemoryStore) APIKeys() APIKeyRepository {
+	return &memoryAPIKeys{s: s}
+}
+
+func (s *MemoryStore) AuditLog() AuditRepository {
+	return &memoryAuditLog{s: s}
+}
+
+func (s *MemoryStore) SendingUsage() SendingUsageRepository {
+	return &memorySendingUsage{s: s}
+}
+
+func (s *MemoryStore) Outbox() OutboxRepository {
+	return &memoryOutbox{s: s}
+}
+
+func (s *MemoryStore) InTx(ctx context.Context, fn func(tx Store) error) error {
+	if s.inTx {
+		return fn(s)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := s.data.clone()
+	if err := fn(&MemoryStore{mu: s.mu, data: s.data, inTx: true}); err != nil {
+		*s.data = *snapshot
+		return err
+	}
+	return nil
+}
+
+// read runs fn under the read lock, unless the caller's transaction already
+// holds the lock
+func (s *MemoryStore) read(ctx context.Context, fn func(d *memoryData) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !s.inTx {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+	}
+	return fn(s.data)
+}
+
+// write runs fn as a transaction of its own, unless it's part of one already
+func (s *MemoryStore) write(ctx context.Context, fn func(d *memoryData) error) error {
+	return s.InTx(ctx, func(tx Store) error {
+		return fn(tx.(*MemoryStore).data)
+	})
+}
+
+// clone copies the maps. Stored values are replaced rather than modified in
+// place, so a shallow copy is enough.
+func (d *memoryData) clone() *memoryData {
+	return &memoryData{
+		organizations:   maps.Clone(d.organizations),
+		profiles:        maps.Clone(d.profiles),
+		emails:          maps.Clone(d.emails),
+		emailGroups:     maps.Clone(d.emailGroups),
+		members:         maps.Clone(d.members),
+		templates:       maps.Clone(d.templates),
+		campaigns:       maps.Clone(d.campaigns),
+		apiKeys:         maps.Clone(d.apiKeys),
+		auditLog:        maps.Clone(d.auditLog),
+		sendingUsage:    maps.Clone(d.sendingUsage),
+		sendingSchedule: maps.Clone(d.sendingSchedule),
+		outbox:          maps.Clone(d.outbox),
+		lastOutboxID:    d.lastOutboxID,
+		lastNow:         d.lastNow,
+	}
+}
+
+// now returns the current time at Postgres precision, later than any time it
+// returned before
+func (d *memoryData) now() time.Time {
+	t := time.Now().UTC().Truncate(time.Microsecond)
+	if !t.After(d.lastNow) {
+		t = d.lastNow.Add(time.Microsecond)
+	}
+	d.lastNow = t
+	return t
+}
+
+// requireOrganization mirrors the organization_id foreign keys
+func (d *memoryData) requireOrganization(organizationID string) error {
+	if _, ok := d.organizations[normalizeID(organizationID)]; !ok {
+		return memoryMissingReference("organization_id")
+	}
+	return nil
+}
+
+// newID returns a random (version 4) UUID
+func newID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("error generating id: %v", err))
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// normalizeID puts an id in the form Postgres returns UUIDs in
+func normalizeID(id string) string {
+	return strings.ToLower(id)
+}
+
+// memoryMissing returns the ids for which owned is false, like pgMissing
+func memoryMissing(ids []string, owned func(id string) bool) []string {
+	var missing []string
+	for _, id := range ids {
+		if !owned(normalizeID(id)) {
+			missing = append(missing, id)
+		}
+	}
+	return missing
+}
+
+// memoryConflict and memoryMissingReference are the errors AsError makes of
+// the matching Postgres constraint violations
+func memoryConflict(fields ...string) error {
+	details := make([]FieldError, len(fields))
+	for i, field := range fields {
+		details[i] = FieldError{Field: field, Message: "already exists"}
+	}
+	return Conflict("a record with the same values already exists", details...)
+}
+
+func memoryMissingReference(field string) error {
+	return Validation("a referenced resource does not exist", FieldError{Field: field, Message: "does not exist"})
+}
+
+func memoryRequired(table, column string) error {
+	return Validation("a value is not allowed", FieldError{
+		Field:   column,
+		Message: fmt.Sprintf("violates constraint %s_%s_check", table, column),
+	})
+}
+
+// memoryList pages rows the way the Postgres queries do: filters, search and
+// date range first, then the cursor or offset in the requested order
+func memoryList[T any](page *pageQuery, rows []T, key func(T) rowKey) (*models.PaginatedResponse[T], error) {
+	var matched []T
+	for _, row := range rows {
+		if page.matches(key(row)) {
+			matched = append(matched, row)
+		}
+	}
+
+	var total *int
+	if page.countTotal() {
+		n := len(matched)
+		total = &n
+	}
+
+	cols := page.orderColumns()
+	sort.SliceStable(matched, func(i, j int) bool {
+		return compareRowKeys(cols, key(matched[i]), key(matched[j])) < 0
+	})
+
+	if page.cursor != nil {
+		after, err := page.cursorKey()
+		if err != nil {
+			return nil, err
+		}
+		i := sort.Search(len(matched), func(i int) bool {
+			return compareRowKeys(cols, key(matched[i]), after) > 0
+		})
+		matched = matched[i:]
+	} else if offset := (page.page - 1) * page.pageSize; offset > 0 {
+		matched = matched[min(offset, len(matched)):]
+	}
+	if len(matched) > page.pageSize+1 {
+		matched = matched[:page.pageSize+1]
+	}
+
+	return paginate(page, matched, key, total), nil
+}
+
+// matches applies the filters, search and date range to a row
+func (q *pageQuery) matches(key rowKey) bool {
+	for field, values := range q.query.Filters {
+		value := fmt.Sprint(key[field])
+		found := false
+		for _, v := range values {
+			found = found || v == value
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if q.query.Search != "" {
+		search := strings.ToLower(q.query.Search)
+		found := false
+		for _, field := range q.spec.searchable {
+			found = found || strings.Contains(strings.ToLower(fmt.Sprint(key[field])), search)
+		}
+		if !found {
+			return false
+		}
+	}
+
+	createdAt, _ := key["created_at"].(time.Time)
+	if q.query.CreatedAfter != nil && createdAt.Before(*q.query.CreatedAfter) {
+		return false
+	}
+	if q.query.CreatedBefore != nil && !createdAt.Before(*q.query.CreatedBefore) {
+		return false
+	}
+	return true
+}
+
+// cursorKey turns the cursor back into a row key, parsing each value as its
+// column's type like the casts in keyset do
+func (q *pageQuery) cursorKey() (rowKey, error) {
+	key := rowKey{"id": normalizeID(q.cursor.ID)}
+	for i, col := range q.sort {
+		value := q.cursor.Values[i]
+		if col.typ != "timestamptz" {
+			key[col.name] = value
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil, Validation("a value is malformed")
+		}
+		key[col.name] = t
+	}
+	return key, nil
+}
+
+func compareRowKeys(cols []sortColumn, a, b rowKey) int {
+	for _, col := range cols {
+		c := compareValues(a[col.name], b[col.name])
+		if col.desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func compareValues(a, b any) int {
+	switch a := a.(type) {
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	case string:
+		return strings.Compare(a, b.(string))
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// values returns the map's values, for listing
+func values[K comparable, V any](m map[K]V) []V {
+	out := make([]V, 0, len(m))
+	for _, v := range m {
+		out = append(out, v)
+	}
+	return out
+}
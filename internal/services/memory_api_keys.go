@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/donnaloia/sendpulse/internal/models"
+)
+
+// memoryAPIKey is a key with its stored hash
+type memoryAPIKey struct {
+	models.APIKey
+	keyHash string
+}
+
+type memoryAPIKeys struct {
+	s *MemoryStore
+}
+
+func (r *memoryAPIKeys) List(ctx context.Context, organizationID string, params models.PaginationParams) (*models.PaginatedResponse[models.APIKey], error) {
+	page, err := newPageQuery(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp *models.PaginatedResponse[models.APIKey]
+	err = r.s.read(ctx, func(d *memoryData) error {
+		var keys []models.APIKey
+		for _, k := range d.apiKeys {
+			if k.OrganizationID == normalizeID(organizationID) {
+				keys = append(keys, k.APIKey)
+			}
+		}
+		resp, err = memoryList(page, keys, apiKeyKey)
+		return err
+	})
+	return resp, err
+}
+
+func (r *memoryAPIKeys) Get(ctx context.Context, organizationID, id string) (*models.APIKey, error) {
+	var key models.APIKey
+	err := r.s.read(ctx, func(d *memoryData) error {
+		stored, ok := d.apiKeys[normalizeID(id)]
+		if !ok || stored.OrganizationID != normalizeID(organizationID) {
+			return NotFound("api key")
+		}
+		key = stored.APIKey
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *memoryAPIKeys) GetForUpdate(ctx context.Context, organizationID, id string) (*models.APIKey, error) {
+	return r.Get(ctx, organizationID, id)
+}
+
+func (r *memoryAPIKeys) GetByPrefix(ctx context.Context, prefix string) (*models.APIKey, string, error) {
+	var stored memoryAPIKey
+	err := r.s.read(ctx, func(d *memoryData) error {
+		for _, k := range d.apiKeys {
+			if k.Prefix == prefix {
+				stored = k
+				return nil
+			}
+		}
+		return NotFound("api key")
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return &stored.APIKey, stored.keyHash, nil
+}
+
+func (r *memoryAPIKeys) Create(ctx context.Context, organizationID string, req *models.CreateAPIKey, prefix, keyHash string) (*models.APIKey, error) {
+	var key models.APIKey
+	err := r.s.write(ctx, func(d *memoryData) error {
+		if err := d.requireOrganization(organizationID); err != nil {
+			return err
+		}
+		for _, existing := range d.apiKeys {
+			if existing.Prefix == prefix {
+				return memoryConflict("prefix")
+			}
+		}
+
+		permissions := req.Permissions
+		if permissions == nil {
+			permissions = []string{}
+		}
+		key = models.APIKey{
+			ID:             newID(),
+			OrganizationID: normalizeID(organizationID),
+			Name:           req.Name,
+			Prefix:         prefix,
+			Permissions:    permissions,
+			ExpiresAt:      req.ExpiresAt,
+			CreatedAt:      d.now(),
+		}
+		d.apiKeys[key.ID] = memoryAPIKey{APIKey: key, keyHash: keyHash}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *memoryAPIKeys) Revoke(ctx context.Context, id string) (*models.APIKey, error) {
+	var key models.APIKey
+	err := r.s.write(ctx, func(d *memoryData) error {
+		stored, ok := d.apiKeys[normalizeID(id)]
+		if !ok {
+			return NotFound("api key")
+		}
+		now := d.now()
+		stored.RevokedAt = &now
+		d.apiKeys[stored.ID] = stored
+		key = stored.APIKey
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// Touch only writes once a minute, like the Postgres repository
+func (r *memoryAPIKeys) Touch(ctx context.Context, id string) error {
+	return r.s.write(ctx, func(d *memoryData) error {
+		stored, ok := d.apiKeys[normalizeID(id)]
+		if !ok {
+			return nil
+		}
+		now := d.now()
+		if stored.LastUsedAt == nil || stored.LastUsedAt.Before(now.Add(-time.Minute)) {
+			stored.LastUsedAt = &now
+			d.apiKeys[stored.ID] = stored
+		}
+		return nil
+	})
+}
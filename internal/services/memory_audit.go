@@ -0,0 +1,59 @@
+package services
+
+import (
+	"context"
+
+	"github.com/donnaloia/sendpulse/internal/models"
+)
+
+type memoryAuditLog struct {
+	s *MemoryStore
+}
+
+func (r *memoryAuditLog) List(ctx context.Context, organizationID string, filter models.AuditFilter, params models.PaginationParams) (*models.PaginatedResponse[models.AuditEntry], error) {
+	page, err := newPageQuery(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp *models.PaginatedResponse[models.AuditEntry]
+	err = r.s.read(ctx, func(d *memoryData) error {
+		var entries []models.AuditEntry
+		for _, e := range d.auditLog {
+			if e.OrganizationID == normalizeID(organizationID) && auditMatches(e, filter) {
+				entries = append(entries, e)
+			}
+		}
+		resp, err = memoryList(page, entries, auditKey)
+		return err
+	})
+	return resp, err
+}
+
+// auditMatches applies the filter the way the Postgres query does; empty
+// fields don't filter
+func auditMatches(e models.AuditEntry, filter models.AuditFilter) bool {
+	switch {
+	case filter.ActorID != "" && e.ActorID != filter.ActorID,
+		filter.Action != "" && e.Action != filter.Action,
+		filter.ResourceType != "" && e.ResourceType != filter.ResourceType,
+		filter.ResourceID != "" && e.ResourceID != filter.ResourceID,
+		filter.CreatedAfter != nil && e.CreatedAt.Before(*filter.CreatedAfter),
+		filter.CreatedBefore != nil && !e.CreatedAt.Before(*filter.CreatedBefore):
+		return false
+	}
+	return true
+}
+
+func (r *memoryAuditLog) Create(ctx context.Context, entry *models.AuditEntry) error {
+	// Like audit_log, entries don't reference the organization, so the trail
+	// outlives it
+	return r.s.write(ctx, func(d *memoryData) error {
+		stored := *entry
+		stored.ID = newID()
+		stored.OrganizationID = normalizeID(entry.OrganizationID)
+		stored.CreatedAt = d.now()
+		d.auditLog[stored.ID] = stored
+		return nil
+	})
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"slices"
+
+	"github.com/donnaloia/sendpulse/internal/models"
+)
+
+// memoryCampaign is a campaign without its links, which are kept as ids in
+// the order they were added
+type memoryCampaign struct {
+	models.Campaign
+	templateIDs   []string
+	emailGroupIDs []string
+}
+
+type memoryCampaigns struct {
+	s *MemoryStore
+}
+
+func (r *memoryCampaigns) List(ctx context.Context, organizationID string, query models.ListQuery, params models.PaginationParams) (*models.PaginatedResponse[models.Campaign], error) {
+	page, err := newListQuery(campaignListSpec, query, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp *models.PaginatedResponse[models.Campaign]
+	err = r.s.read(ctx, func(d *memoryData) error {
+		var campaigns []models.Campaign
+		for _, c := range d.campaigns {
+			if c.OrganizationID == normalizeID(organizationID) {
+				campaigns = append(campaigns, c.Campaign)
+			}
+		}
+		resp, err = memoryList(page, campaigns, campaignKey)
+		return err
+	})
+	return resp, err
+}
+
+func (r *memoryCampaigns) Get(ctx context.Context, organizationID, id string) (*models.Campaign, error) {
+	var campaign models.Campaign
+	err := r.s.read(ctx, func(d *memoryData) error {
+		stored, ok := d.campaigns[normalizeID(id)]
+		if !ok || stored.OrganizationID != normalizeID(organizationID) {
+			return NotFound("campaign")
+		}
+
+		campaign = stored.Campaign
+		campaign.Templates = []models.Template{}
+		for _, templateID := range stored.templateIDs {
+			campaign.Templates = append(campaign.Templates, d.templates[templateID])
+		}
+		campaign.EmailGroups = []models.EmailGroup{}
+		for _, groupID := range stored.emailGroupIDs {
+			campaign.EmailGroups = append(campaign.EmailGroups, d.emailGroups[groupID])
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &campaign, nil
+}
+
+func (r *memoryCampaigns) GetForUpdate(ctx context.Context, organizationID, id string) (*models.Campaign, error) {
+	return r.Get(ctx, organizationID, id)
+}
+
+func (r *memoryCampaigns) Create(ctx context.Context, organizationID string, req *models.CreateCampaign) (*models.Campaign, error) {
+	var campaign models.Campaign
+	err := r.s.write(ctx, func(d *memoryData) error {
+		if err := d.requireOrganization(organizationID); err != nil {
+			return err
+		}
+
+		campaign = models.Campaign{
+			ID:             newID(),
+			Name:           req.Name,
+			Status:         models.CampaignStatusDraft,
+			OrganizationID: normalizeID(organizationID),
+			CreatedAt:      d.now(),
+			Version:        1,
+		}
+		d.campaigns[campaign.ID] = memoryCampaign{Campaign: campaign}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &campaign, nil
+}
+
+func (r *memoryCampaigns) Recipients(ctx context.Context, organizationID, id string) ([]string, error) {
+	recipients := []string{}
+	err := r.s.read(ctx, func(d *memoryData) error {
+		stored, ok := d.campaigns[normalizeID(id)]
+		if !ok || stored.OrganizationID != normalizeID(organizationID) {
+			return nil
+		}
+		seen := map[string]bool{}
+		for _, m := range d.members {
+			if !slices.Contains(stored.emailGroupIDs, m.EmailGroupID) {
+				continue
+			}
+			address := d.emails[m.EmailAddressID].Address
+			if !seen[address] {
+				seen[address] = true
+				recipients = append(recipients, address)
+			}
+		}
+		slices.Sort(recipients)
+		return nil
+	})
+	return recipients, err
+}
+
+func (r *memoryCampaigns) Update(ctx context.Context, organizationID, id string, change *CampaignChange) error {
+	return r.s.write(ctx, func(d *memoryData) error {
+		stored, ok := d.campaigns[normalizeID(id)]
+		if !ok || stored.OrganizationID != normalizeID(organizationID) {
+			return NotFound("campaign")
+		}
+
+		templateIDs, err := updateMemoryLinks(stored.templateIDs, change.AddTemplates, change.RemoveTemplates, d.templates, "template_id")
+		if err != nil {
+			return err
+		}
+		emailGroupIDs, err := updateMemoryLinks(stored.emailGroupIDs, change.AddEmailGroups, change.RemoveEmailGroups, d.emailGroups, "email_group_id")
+		if err != nil {
+			return err
+		}
+
+		if change.Name != "" {
+			stored.Name = change.Name
+		}
+		if change.Status != "" {
+			stored.Status = change.Status
+		}
+		stored.Version++
+		stored.templateIDs = templateIDs
+		stored.emailGroupIDs = emailGroupIDs
+		d.campaigns[stored.ID] = stored
+		return nil
+	})
+}
+
+// updateMemoryLinks returns a new list of linked ids with removed taken out
+// and added appended. Links added together are ordered by id, as the
+// aggregated read in Postgres orders them.
+func updateMemoryLinks[V any](ids, added, removed []string, table map[string]V, field string) ([]string, error) {
+	var updated []string
+	for _, id := range ids {
+		if !slices.Contains(removed, id) {
+			updated = append(updated, id)
+		}
+	}
+
+	var fresh []string
+	for _, id := range added {
+		id = normalizeID(id)
+		if _, ok := table[id]; !ok {
+			return nil, memoryMissingReference(field)
+		}
+		if !slices.Contains(updated, id) && !slices.Contains(fresh, id) {
+			fresh = append(fresh, id)
+		}
+	}
+	slices.Sort(fresh)
+	return append(updated, fresh...), nil
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+
+	"github.com/donnaloia/sendpulse/internal/models"
+)
+
+type memoryEmailAddresses struct {
+	s *MemoryStore
+}
+
+func (r *memoryEmailAddresses) List(ctx context.Context, organizationID string, query models.ListQuery, params models.PaginationParams) (*models.PaginatedResponse[models.EmailAddress], error) {
+	page, err := newListQuery(emailListSpec, query, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp *models.PaginatedResponse[models.EmailAddress]
+	err = r.s.read(ctx, func(d *memoryData) error {
+		var emails []models.EmailAddress
+		for _, e := range d.emails {
+			if e.OrganizationID == normalizeID(organizationID) {
+				emails = append(emails, e)
+			}
+		}
+		resp, err = memoryList(page, emails, emailKey)
+		return err
+	})
+	return resp, err
+}
+
+func (r *memoryEmailAddresses) Get(ctx context.Context, organizationID, id string) (*models.EmailAddress, error) {
+	var email models.EmailAddress
+	err := r.s.read(ctx, func(d *memoryData) error {
+		var ok bool
+		email, ok = d.emails[normalizeID(id)]
+		if !ok || email.OrganizationID != normalizeID(organizationID) {
+			return NotFound("email")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &email, nil
+}
+
+func (r *memoryEmailAddresses) Create(ctx context.Context, organizationID string, req *models.CreateEmailAddressRequest) (*models.EmailAddress, error) {
+	var email models.EmailAddress
+	err := r.s.write(ctx, func(d *memoryData) error {
+		if err := d.requireOrganization(organizationID); err != nil {
+			return err
+		}
+		// Addresses are unique across organizations, as in the schema
+		for _, existing := range d.emails {
+			if existing.Address == req.Address {
+				return memoryConflict("address")
+			}
+		}
+
+		email = models.EmailAddress{
+			ID:             newID(),
+			Address:        req.Address,
+			OrganizationID: normalizeID(organizationID),
+			CreatedAt:      d.now(),
+		}
+		d.emails[email.ID] = email
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &email, nil
+}
+
+func (r *memoryEmailAddresses) Missing(ctx context.Context, organizationID string, ids []string) ([]string, error) {
+	var missing []string
+	err := r.s.read(ctx, func(d *memoryData) error {
+		missing = memoryMissing(ids, func(id string) bool {
+			e, ok := d.emails[id]
+			return ok && e.OrganizationID == normalizeID(organizationID)
+		})
+		return nil
+	})
+	return missing, err
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+
+	"github.com/donnaloia/sendpulse/internal/models"
+)
+
+type memoryEmailGroups struct {
+	s *MemoryStore
+}
+
+func (r *memoryEmailGroups) List(ctx context.Context, organizationID string, query models.ListQuery, params models.PaginationParams) (*models.PaginatedResponse[models.EmailGroup], error) {
+	page, err := newListQuery(emailGroupListSpec, query, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp *models.PaginatedResponse[models.EmailGroup]
+	err = r.s.read(ctx, func(d *memoryData) error {
+		var groups []models.EmailGroup
+		for _, g := range d.emailGroups {
+			if g.OrganizationID == normalizeID(organizationID) {
+				groups = append(groups, g)
+			}
+		}
+		resp, err = memoryList(page, groups, emailGroupKey)
+		return err
+	})
+	return resp, err
+}
+
+func (r *memoryEmailGroups) Get(ctx context.Context, organizationID, id string) (*models.EmailGroup, error) {
+	var group models.EmailGroup
+	err := r.s.read(ctx, func(d *memoryData) error {
+		var ok bool
+		group, ok = d.emailGroups[normalizeID(id)]
+		if !ok || group.OrganizationID != normalizeID(organizationID) {
+			return NotFound("email group")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+func (r *memoryEmailGroups) Create(ctx context.Context, organizationID string, req *models.CreateEmailGroup) (*models.EmailGroup, error) {
+	var group models.EmailGroup
+	err := r.s.write(ctx, func(d *memoryData) error {
+		if err := d.requireOrganization(organizationID); err != nil {
+			return err
+		}
+
+		group = models.EmailGroup{
+			ID:             newID(),
+			Name:           req.Name,
+			OrganizationID: normalizeID(organizationID),
+			CreatedAt:      d.now(),
+		}
+		d.emailGroups[group.ID] = group
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+func (r *memoryEmailGroups) Missing(ctx context.Context, organizationID string, ids []string) ([]string, error) {
+	var missing []string
+	err := r.s.read(ctx, func(d *memoryData) error {
+		missing = memoryMissing(ids, func(id string) bool {
+			g, ok := d.emailGroups[id]
+			return ok && g.OrganizationID == normalizeID(organizationID)
+		})
+		return nil
+	})
+	return missing, err
+}
+
+// memberInOrganization reports whether the member's group belongs to the
+// organization
+func (d *memoryData) memberInOrganization(m models.EmailGroupMember, organizationID string) bool {
+	g, ok := d.emailGroups[m.EmailGroupID]
+	return ok && g.OrganizationID == normalizeID(organizationID)
+}
+
+func (r *memoryEmailGroups) ListMembers(ctx context.Context, organizationID string, params models.PaginationParams) (*models.PaginatedResponse[models.EmailGroupMember], error) {
+	page, err := newPageQuery(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp *models.PaginatedResponse[models.EmailGroupMember]
+	err = r.s.read(ctx, func(d *memoryData) error {
+		var members []models.EmailGroupMember
+		for _, m := range d.members {
+			if d.memberInOrganization(m, organizationID) {
+				members = append(members, m)
+			}
+		}
+		resp, err = memoryList(page, members, memberKey)
+		return err
+	})
+	return resp, err
+}
+
+func (r *memoryEmailGroups) GetMember(ctx context.Context, organizationID, id string) (*models.EmailGroupMember, error) {
+	var member models.EmailGroupMember
+	err := r.s.read(ctx, func(d *memoryData) error {
+		var ok bool
+		member, ok = d.members[normalizeID(id)]
+		if !ok || !d.memberInOrganization(member, organizationID) {
+			return NotFound("group member")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+func (r *memoryEmailGroups) AddMember(ctx context.Context, req *models.CreateEmailGroupMember) (*models.EmailGroupMember, error) {
+	var member models.EmailGroupMember
+	err := r.s.write(ctx, func(d *memoryData) error {
+		groupID, addressID := normalizeID(req.EmailGroupID), normalizeID(req.EmailAddressID)
+		if _, ok := d.emailGroups[groupID]; !ok {
+			return memoryMissingReference("email_group_id")
+		}
+		if _, ok := d.emails[addressID]; !ok {
+			return memoryMissingReference("email_address_id")
+		}
+		for _, existing := range d.members {
+			if existing.EmailGroupID == groupID && existing.EmailAddressID == addressID {
+				return memoryConflict("email_group_id", "email_address_id")
+			}
+		}
+
+		member = models.EmailGroupMember{
+			ID:             newID(),
+			EmailGroupID:   groupID,
+			EmailAddressID: addressID,
+			CreatedAt:      d.now(),
+		}
+		d.members[member.ID] = member
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+func (r *memoryEmailGroups) RemoveMember(ctx context.Context, organizationID, id string) (*models.EmailGroupMember, error) {
+	var member models.EmailGroupMember
+	err := r.s.write(ctx, func(d *memoryData) error {
+		var ok bool
+		member, ok = d.members[normalizeID(id)]
+		if !ok || !d.memberInOrganization(member, organizationID) {
+			return NotFound("group member")
+		}
+		delete(d.members, member.ID)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+
+	"github.com/donnaloia/sendpulse/internal/models"
+)
+
+type memoryOrganizations struct {
+	s *MemoryStore
+}
+
+func (r *memoryOrganizations) List(ctx context.Context, params models.PaginationParams) (*models.PaginatedResponse[models.Organization], error) {
+	page, err := newPageQuery(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp *models.PaginatedResponse[models.Organization]
+	err = r.s.read(ctx, func(d *memoryData) error {
+		resp, err = memoryList(page, values(d.organizations), organizationKey)
+		return err
+	})
+	return resp, err
+}
+
+func (r *memoryOrganizations) Get(ctx context.Context, id string) (*models.Organization, error) {
+	var org models.Organization
+	err := r.s.read(ctx, func(d *memoryData) error {
+		var ok bool
+		if org, ok = d.organizations[normalizeID(id)]; !ok {
+			return NotFound("organization")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+func (r *memoryOrganizations) Create(ctx context.Context, req *models.CreateOrganization) (*models.Organization, error) {
+	var org models.Organization
+	err := r.s.write(ctx, func(d *memoryData) error {
+		for _, existing := range d.organizations {
+			if existing.Name == req.Name {
+				return memoryConflict("name")
+			}
+		}
+
+		org = models.Organization{
+			ID:        newID(),
+			Name:      req.Name,
+			CreatedAt: d.now(),
+		}
+		d.organizations[org.ID] = org
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+)
+
+type memoryOutbox struct {
+	s *MemoryStore
+}
+
+func (r *memoryOutbox) Add(ctx context.Context, msg *OutboxMessage) error {
+	return r.s.write(ctx, func(d *memoryData) error {
+		d.lastOutboxID++
+		msg.ID = d.lastOutboxID
+		msg.SendAt = msg.SendAt.UTC().Truncate(time.Microsecond)
+		d.outbox[msg.ID] = *msg
+		return nil
+	})
+}
+
+// Due needs no row locks: a transaction already holds the store-wide lock
+func (r *memoryOutbox) Due(ctx context.Context, now time.Time, limit int) ([]OutboxMessage, error) {
+	var msgs []OutboxMessage
+	err := r.s.read(ctx, func(d *memoryData) error {
+		for _, msg := range d.outbox {
+			if !msg.SendAt.After(now) {
+				msgs = append(msgs, msg)
+			}
+		}
+		return nil
+	})
+	slices.SortFunc(msgs, func(a, b OutboxMessage) int {
+		if c := a.SendAt.Compare(b.SendAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return msgs[:min(limit, len(msgs))], err
+}
+
+func (r *memoryOutbox) Delete(ctx context.Context, id int64) error {
+	return r.s.write(ctx, func(d *memoryData) error {
+		delete(d.outbox, id)
+		return nil
+	})
+}
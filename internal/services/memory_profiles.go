@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+
+	"github.com/donnaloia/sendpulse/internal/models"
+)
+
+type memoryProfiles struct {
+	s *MemoryStore
+}
+
+func (r *memoryProfiles) List(ctx context.Context, organizationID string, params models.PaginationParams) (*models.PaginatedResponse[models.Profile], error) {
+	page, err := newPageQuery(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp *models.PaginatedResponse[models.Profile]
+	err = r.s.read(ctx, func(d *memoryData) error {
+		var profiles []models.Profile
+		for _, p := range d.profiles {
+			if p.OrganizationID == normalizeID(organizationID) {
+				profiles = append(profiles, p)
+			}
+		}
+		resp, err = memoryList(page, profiles, profileKey)
+		return err
+	})
+	return resp, err
+}
+
+func (r *memoryProfiles) Get(ctx context.Context, organizationID, id string) (*models.Profile, error) {
+	var profile models.Profile
+	err := r.s.read(ctx, func(d *memoryData) error {
+		var ok bool
+		profile, ok = d.profiles[normalizeID(id)]
+		if !ok || profile.OrganizationID != normalizeID(organizationID) {
+			return NotFound("profile")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+func (r *memoryProfiles) GetForUpdate(ctx context.Context, organizationID, id string) (*models.Profile, error) {
+	return r.Get(ctx, organizationID, id)
+}
+
+func (r *memoryProfiles) Create(ctx context.Context, organizationID string, req *models.CreateProfile) (*models.Profile, error) {
+	var profile models.Profile
+	err := r.s.write(ctx, func(d *memoryData) error {
+		if err := d.requireOrganization(organizationID); err != nil {
+			return err
+		}
+		if _, ok := d.profiles[normalizeID(req.ID)]; ok {
+			return memoryConflict("id")
+		}
+
+		profile = models.Profile{
+			ID:             normalizeID(req.ID),
+			Username:       req.Username,
+			Email:          req.Email,
+			FirstName:      req.FirstName,
+			LastName:       req.LastName,
+			Timezone:       req.Timezone,
+			Bio:            req.Bio,
+			OrganizationID: normalizeID(organizationID),
+			PictureURL:     req.PictureURL,
+			CreatedAt:      d.now(),
+		}
+		d.profiles[profile.ID] = profile
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+func (r *memoryProfiles) Update(ctx context.Context, organizationID, id string, req *models.UpdateProfile) (*models.Profile, error) {
+	var profile models.Profile
+	err := r.s.write(ctx, func(d *memoryData) error {
+		var ok bool
+		profile, ok = d.profiles[normalizeID(id)]
+		if !ok || profile.OrganizationID != normalizeID(organizationID) {
+			return NotFound("profile")
+		}
+		if req.Username == "" {
+			return memoryRequired("profiles", "username")
+		}
+		if req.Email == "" {
+			return memoryRequired("profiles", "email")
+		}
+
+		profile.Username = req.Username
+		profile.Email = req.Email
+		profile.FirstName = req.FirstName
+		profile.LastName = req.LastName
+		profile.Timezone = req.Timezone
+		profile.Bio = req.Bio
+		profile.PictureURL = req.PictureURL
+		d.profiles[profile.ID] = profile
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
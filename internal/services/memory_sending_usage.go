@@ -0,0 +1,59 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+type memorySendingUsage struct {
+	s *MemoryStore
+}
+
+func (r *memorySendingUsage) Get(ctx context.Context, organizationID string, day time.Time) (SendingCount, error) {
+	var count SendingCount
+	err := r.s.read(ctx, func(d *memoryData) error {
+		for date := monthStart(day); !date.After(day); date = date.AddDate(0, 0, 1) {
+			n := d.sendingUsage[memorySendingKey(organizationID, date)]
+			count.Month += n
+			if date.Equal(utcDay(day)) {
+				count.Day = n
+			}
+		}
+		return nil
+	})
+	return count, err
+}
+
+// GetForUpdate is Get: a transaction already holds the store-wide lock
+func (r *memorySendingUsage) GetForUpdate(ctx context.Context, organizationID string, day time.Time) (SendingCount, error) {
+	return r.Get(ctx, organizationID, day)
+}
+
+func (r *memorySendingUsage) Add(ctx context.Context, organizationID string, day time.Time, recipients int) error {
+	return r.s.write(ctx, func(d *memoryData) error {
+		if err := d.requireOrganization(organizationID); err != nil {
+			return err
+		}
+		d.sendingUsage[memorySendingKey(organizationID, day)] += recipients
+		return nil
+	})
+}
+
+func (r *memorySendingUsage) ScheduleDomain(ctx context.Context, domain string, now time.Time, d time.Duration) (time.Time, error) {
+	var start time.Time
+	err := r.s.write(ctx, func(data *memoryData) error {
+		key := strings.ToLower(domain)
+		start = now.UTC().Truncate(time.Microsecond)
+		if free := data.sendingSchedule[key]; free.After(start) {
+			start = free
+		}
+		data.sendingSchedule[key] = start.Add(d.Truncate(time.Microsecond))
+		return nil
+	})
+	return start, err
+}
+
+func memorySendingKey(organizationID string, day time.Time) string {
+	return normalizeID(organizationID) + "/" + day.UTC().Format(time.DateOnly)
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+
+	"github.com/donnaloia/sendpulse/internal/models"
+)
+
+type memoryTemplates struct {
+	s *MemoryStore
+}
+
+func (r *memoryTemplates) List(ctx context.Context, organizationID string, query models.ListQuery, params models.PaginationParams) (*models.PaginatedResponse[models.Template], error) {
+	page, err := newListQuery(templateListSpec, query, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp *models.PaginatedResponse[models.Template]
+	err = r.s.read(ctx, func(d *memoryData) error {
+		var templates []models.Template
+		for _, t := range d.templates {
+			if t.OrganizationID == normalizeID(organizationID) {
+				templates = append(templates, t)
+			}
+		}
+		resp, err = memoryList(page, templates, templateKey)
+		return err
+	})
+	return resp, err
+}
+
+func (r *memoryTemplates) Get(ctx context.Context, organizationID, id string) (*models.Template, error) {
+	var template models.Template
+	err := r.s.read(ctx, func(d *memoryData) error {
+		var ok bool
+		template, ok = d.templates[normalizeID(id)]
+		if !ok || template.OrganizationID != normalizeID(organizationID) {
+			return NotFound("template")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+func (r *memoryTemplates) GetForUpdate(ctx context.Context, organizationID, id string) (*models.Template, error) {
+	return r.Get(ctx, organizationID, id)
+}
+
+func (r *memoryTemplates) Create(ctx context.Context, organizationID string, req *models.CreateTemplate) (*models.Template, error) {
+	var template models.Template
+	err := r.s.write(ctx, func(d *memoryData) error {
+		if err := d.requireOrganization(organizationID); err != nil {
+			return err
+		}
+
+		template = models.Template{
+			ID:             newID(),
+			Name:           req.Name,
+			OrganizationID: normalizeID(organizationID),
+			HTML:           req.HTML,
+			CreatedAt:      d.now(),
+			Version:        1,
+		}
+		d.templates[template.ID] = template
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+func (r *memoryTemplates) Update(ctx context.Context, organizationID, id string, req *models.UpdateTemplate) (*models.Template, error) {
+	var template models.Template
+	err := r.s.write(ctx, func(d *memoryData) error {
+		var ok bool
+		template, ok = d.templates[normalizeID(id)]
+		if !ok || template.OrganizationID != normalizeID(organizationID) {
+			return NotFound("template")
+		}
+
+		// Empty fields are left unchanged
+		if req.Name != "" {
+			template.Name = req.Name
+		}
+		if req.HTML != "" {
+			template.HTML = req.HTML
+		}
+		template.Version++
+		d.templates[template.ID] = template
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+func (r *memoryTemplates) Missing(ctx context.Context, organizationID string, ids []string) ([]string, error) {
+	var missing []string
+	err := r.s.read(ctx, func(d *memoryData) error {
+		missing = memoryMissing(ids, func(id string) bool {
+			t, ok := d.templates[id]
+			return ok && t.OrganizationID == normalizeID(organizationID)
+		})
+		return nil
+	})
+	return missing, err
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/donnaloia/sendpulse/internal/models"
+)
+
+func TestMemoryStoreRollsBack(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	errAbort := errors.New("abort")
+	err := store.InTx(ctx, func(tx Store) error {
+		if _, err := tx.Organizations().Create(ctx, &models.CreateOrganization{Name: "Acme"}); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("err = %v", err)
+	}
+
+	orgs, err := store.Organizations().List(ctx, models.PaginationParams{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orgs.Results) != 0 {
+		t.Fatalf("rolled back organization is listed: %+v", orgs.Results)
+	}
+}
+
+func TestMemoryStorePagesByCursor(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	s := NewTemplateService(store)
+	actor := models.Actor{ID: "test", Type: "test"}
+
+	org, err := store.Organizations().Create(ctx, &models.CreateOrganization{Name: "Acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Duplicate names make the id tie-breaker matter
+	for _, name := range []string{"b", "a", "b", "c", "a"} {
+		if _, err := s.Create(ctx, actor, org.ID, &models.CreateTemplate{Name: name, HTML: "<p>Hi</p>"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	query := models.ListQuery{Sort: []models.SortField{{Field: "name"}}}
+	var names []string
+	seen := map[string]bool{}
+	// The cursor takes over from the page after the first request
+	params := models.PaginationParams{Page: 1, PageSize: 2}
+	for page := 0; ; page++ {
+		if page > 5 {
+			t.Fatal("paging didn't end")
+		}
+		resp, err := s.GetAll(ctx, org.ID, query, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, template := range resp.Results {
+			if seen[template.ID] {
+				t.Fatalf("template %s listed twice", template.ID)
+			}
+			seen[template.ID] = true
+			names = append(names, template.Name)
+		}
+		if resp.NextCursor == "" {
+			break
+		}
+		params.Cursor = resp.NextCursor
+	}
+
+	want := []string{"a", "a", "b", "b", "c"}
+	if len(names) != len(want) {
+		t.Fatalf("names = %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("names = %v, want %v", names, want)
+		}
+	}
+}
+
+func TestMemoryStoreCountsSendingUsageByMonth(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	org, err := store.Organizations().Create(ctx, &models.CreateOrganization{Name: "Acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	day := func(month time.Month, d int) time.Time {
+		return time.Date(2026, month, d, 12, 0, 0, 0, time.UTC)
+	}
+	for _, add := range []struct {
+		day        time.Time
+		recipients int
+	}{
+		{day(time.September, 30), 100},
+		{day(time.October, 1), 10},
+		{day(time.October, 2), 20},
+		{day(time.October, 2), 5},
+		{day(time.October, 3), 1000},
+	} {
+		if err := store.SendingUsage().Add(ctx, org.ID, add.day, add.recipients); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Later days and other months don't count
+	count, err := store.SendingUsage().Get(ctx, org.ID, day(time.October, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != (SendingCount{Day: 25, Month: 35}) {
+		t.Fatalf("count = %+v", count)
+	}
+}
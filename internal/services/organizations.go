@@ -1,96 +1,68 @@
 package services
 
 import (
-	"database/sql"
-	"fmt"
+	"context"
+	"errors"
 
 	"github.com/donnaloia/sendpulse/internal/models"
 )
 
 type OrganizationService struct {
-	db *sql.DB
+	store Store
 }
 
-func NewOrganizationService(db *sql.DB) *OrganizationService {
-	return &OrganizationService{db: db}
+func NewOrganizationService(store Store) *OrganizationService {
+	return &OrganizationService{store: store}
 }
 
-func (s *OrganizationService) GetAll(params models.PaginationParams) (*models.PaginatedResponse[models.Organization], error) {
-	if params.Page < 1 {
-		params.Page = 1
-	}
-	if params.PageSize < 1 {
-		params.PageSize = 10
-	}
-
-	var total int
-	err := s.db.QueryRow("SELECT COUNT(*) FROM organizations").Scan(&total)
-	if err != nil {
-		return nil, fmt.Errorf("error counting organizations: %w", err)
-	}
-
-	offset := (params.Page - 1) * params.PageSize
-	rows, err := s.db.Query(
-		`SELECT id, name, created_at 
-		FROM organizations 
-		ORDER BY created_at DESC 
-		LIMIT $1 OFFSET $2`,
-		params.PageSize, offset,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("error fetching organizations: %w", err)
-	}
-	defer rows.Close()
-
-	var orgs []models.Organization
-	for rows.Next() {
-		var org models.Organization
-		if err := rows.Scan(
-			&org.ID,
-			&org.Name,
-			&org.CreatedAt,
-		); err != nil {
-			return nil, fmt.Errorf("error scanning organization: %w", err)
-		}
-		orgs = append(orgs, org)
-	}
+// organizationKey is an organization's position in a list
+func organizationKey(o models.Organization) rowKey {
+	return rowKey{"created_at": o.CreatedAt, "id": o.ID}
+}
 
-	return models.NewPaginatedResponse(orgs, total, params.Page, params.PageSize), nil
+func (s *OrganizationService) GetAll(ctx context.Context, params models.PaginationParams) (*models.PaginatedResponse[models.Organization], error) {
+	return s.store.Organizations().List(ctx, params)
 }
 
-func (s *OrganizationService) GetByID(id string) (*models.Organization, error) {
-	var org models.Organization
-	err := s.db.QueryRow(
-		"SELECT id, name, created_at FROM organizations WHERE id = $1",
-		id,
-	).Scan(
-		&org.ID,
-		&org.Name,
-		&org.CreatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("organization not found")
+// GetOwn lists just the organization with id, for callers that may only
+// see their own. The list is empty if it doesn't exist.
+func (s *OrganizationService) GetOwn(ctx context.Context, id string) (*models.PaginatedResponse[models.Organization], error) {
+	if id == "" {
+		return &models.PaginatedResponse[models.Organization]{Results: []models.Organization{}}, nil
+	}
+	org, err := s.store.Organizations().Get(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return &models.PaginatedResponse[models.Organization]{Results: []models.Organization{}}, nil
 	}
 	if err != nil {
-		return nil, fmt.Errorf("error fetching organization: %w", err)
+		return nil, err
 	}
-	return &org, nil
+	return &models.PaginatedResponse[models.Organization]{Results: []models.Organization{*org}}, nil
 }
 
-func (s *OrganizationService) Create(req *models.CreateOrganization) (*models.Organization, error) {
-	var org models.Organization
-	err := s.db.QueryRow(
-		`INSERT INTO organizations (name) 
-		VALUES ($1) 
-		RETURNING id, name, created_at`,
-		req.Name,
-	).Scan(
-		&org.ID,
-		&org.Name,
-		&org.CreatedAt,
-	)
+func (s *OrganizationService) GetByID(ctx context.Context, id string) (*models.Organization, error) {
+	return s.store.Organizations().Get(ctx, id)
+}
+
+func (s *OrganizationService) Create(ctx context.Context, actor models.Actor, req *models.CreateOrganization) (*models.Organization, error) {
+	var org *models.Organization
+	err := s.store.InTx(ctx, func(tx Store) error {
+		var err error
+		org, err = tx.Organizations().Create(ctx, req)
+		if err != nil {
+			return err
+		}
+
+		return recordAudit(ctx, tx, actor, auditRecord{
+			organizationID: org.ID,
+			action:         AuditActionCreate,
+			resourceType:   "organization",
+			resourceID:     org.ID,
+			after:          org,
+		})
+	})
 	if err != nil {
-		return nil, fmt.Errorf("error creating organization: %w", err)
+		return nil, err
 	}
-	return &org, nil
+	return org, nil
 }
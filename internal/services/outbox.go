@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/donnaloia/sendpulse/internal/events"
+	"github.com/donnaloia/sendpulse/internal/metrics"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// EventPublisher tells other services about changes, e.g. the sending
+// service about launched campaigns
+type EventPublisher interface {
+	PublishCampaignLaunched(ctx context.Context, event events.CampaignLaunchedEvent) error
+}
+
+// outboxBatch is how many events the relay publishes per transaction
+const outboxBatch = 100
+
+// OutboxRelay publishes the launch events in the outbox. An event is
+// deleted once the brokers have acknowledged it, so each is published at
+// least once: one whose delete is lost is published again, and consumers
+// recognise it by its campaign ID.
+type OutboxRelay struct {
+	store     Store
+	publisher EventPublisher
+	wake      chan struct{}
+}
+
+func NewOutboxRelay(store Store, publisher EventPublisher) *OutboxRelay {
+	return &OutboxRelay{store: store, publisher: publisher, wake: make(chan struct{}, 1)}
+}
+
+// Notify has Run publish now rather than at its next tick. It doesn't
+// block.
+func (r *OutboxRelay) Notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run publishes the events that are due every interval, and whenever
+// Notify is called, until ctx is cancelled. An event is published within
+// interval of being due. beat is called after every pass; failed passes
+// are logged and retried at the next one.
+func (r *OutboxRelay) Run(ctx context.Context, interval time.Duration, beat func()) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		// A pass isn't cut short by shutdown, so what it published is
+		// deleted rather than published again by the next instance
+		if _, err := r.PublishDue(context.WithoutCancel(ctx), time.Now()); err != nil {
+			slog.ErrorContext(ctx, "error publishing launch events", "error", err)
+		}
+		beat()
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
+
+// PublishDue publishes the events in the outbox that are due by now, in
+// the order they're due, and returns how many it published. It stops at
+// the first event that fails to publish, leaving it and those after it for
+// the next call.
+func (r *OutboxRelay) PublishDue(ctx context.Context, now time.Time) (int, error) {
+	published := 0
+	for {
+		n, err := r.publishBatch(ctx, now)
+		published += n
+		if err != nil || n < outboxBatch {
+			return published, err
+		}
+	}
+}
+
+// publishBatch publishes up to outboxBatch events in one transaction. The
+// events published before a failure are still deleted.
+func (r *OutboxRelay) publishBatch(ctx context.Context, now time.Time) (int, error) {
+	var published, recipients int
+	var publishErr error
+	err := r.store.InTx(ctx, func(tx Store) error {
+		msgs, err := tx.Outbox().Due(ctx, now, outboxBatch)
+		if err != nil {
+			return err
+		}
+		for _, msg := range msgs {
+			msgCtx := otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(msg.TraceContext))
+			if err := r.publisher.PublishCampaignLaunched(msgCtx, msg.Event); err != nil {
+				publishErr = fmt.Errorf("error publishing launch of campaign %s: %w", msg.Event.CampaignID, err)
+				return nil
+			}
+			if err := tx.Outbox().Delete(ctx, msg.ID); err != nil {
+				return err
+			}
+			published++
+			recipients += len(msg.Event.EmailAddresses)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	metrics.RecipientsEnqueued.Add(float64(recipients))
+	return published, publishErr
+}
@@ -0,0 +1,306 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/donnaloia/sendpulse/internal/models"
+)
+
+// sqlArgs collects query arguments and hands out their placeholders, so
+// conditions can be assembled without tracking $n by hand
+type sqlArgs []any
+
+func (a *sqlArgs) add(v any) string {
+	*a = append(*a, v)
+	return "$" + strconv.Itoa(len(*a))
+}
+
+// pageQuery is a list request resolved into SQL. Rows are ordered by the
+// requested sort (created_at descending by default) with the id breaking
+// ties; cursors are keyset positions in that order, so deep pages cost the
+// same as the first and rows inserted meanwhile don't shift the page
+// boundaries. Page-based requests still use OFFSET.
+type pageQuery struct {
+	page         int
+	pageSize     int
+	cursor       *models.Cursor
+	includeTotal bool
+	spec         *listSpec
+	sort         []sortColumn
+	query        models.ListQuery
+}
+
+// newPageQuery resolves a plain paginated request against baseListSpec
+func newPageQuery(params models.PaginationParams) (*pageQuery, error) {
+	return newListQuery(baseListSpec, models.ListQuery{}, params)
+}
+
+// newListQuery checks query against spec and resolves the pagination
+func newListQuery(spec *listSpec, query models.ListQuery, params models.PaginationParams) (*pageQuery, error) {
+	sortCols, err := spec.resolveSort(query.Sort)
+	if err != nil {
+		return nil, err
+	}
+	if err := spec.validate(query); err != nil {
+		return nil, err
+	}
+
+	q := &pageQuery{
+		page:         params.Page,
+		pageSize:     params.PageSize,
+		includeTotal: params.IncludeTotal,
+		spec:         spec,
+		sort:         sortCols,
+		query:        query,
+	}
+	if q.page < 1 {
+		q.page = 1
+	}
+	if q.pageSize < 1 {
+		q.pageSize = models.DefaultPageSize
+	}
+	if q.pageSize > models.MaxPageSize {
+		q.pageSize = models.MaxPageSize
+	}
+	if params.Cursor != "" {
+		cursor, err := models.DecodeCursor(params.Cursor)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+		}
+		if cursor.Sort != q.sortKey() || len(cursor.Values) != len(sortCols) {
+			return nil, fmt.Errorf("%w: cursor was issued for a different sort", ErrInvalidQuery)
+		}
+		if !validCursor(cursor, sortCols) {
+			return nil, fmt.Errorf("%w: invalid cursor", ErrInvalidQuery)
+		}
+		q.cursor = cursor
+	}
+	return q, nil
+}
+
+// uuidPattern matches the UUIDs Postgres accepts, in either case
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// validCursor checks that the cursor's values parse as their columns'
+// types, so a tampered cursor is refused here rather than by the casts in
+// keyset
+func validCursor(cursor *models.Cursor, sortCols []sortColumn) bool {
+	if !uuidPattern.MatchString(cursor.ID) {
+		return false
+	}
+	for i, col := range sortCols {
+		value := cursor.Values[i]
+		switch col.typ {
+		case "timestamptz":
+			if _, err := time.Parse(time.RFC3339Nano, value); err != nil {
+				return false
+			}
+		case "uuid":
+			if !uuidPattern.MatchString(value) {
+				return false
+			}
+		}
+		// Postgres text can't hold NUL
+		if strings.ContainsRune(value, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// sortKey is the canonical form of the ordering, e.g. "name,-created_at"
+func (q *pageQuery) sortKey() string {
+	fields := make([]string, len(q.sort))
+	for i, col := range q.sort {
+		fields[i] = col.name
+		if col.desc {
+			fields[i] = "-" + col.name
+		}
+	}
+	return strings.Join(fields, ",")
+}
+
+// countTotal reports whether the caller needs a COUNT(*). Page-based requests
+// always include the total for backwards compatibility.
+func (q *pageQuery) countTotal() bool {
+	return q.cursor == nil || q.includeTotal
+}
+
+// conditions returns the filter, search and date range conditions
+func (q *pageQuery) conditions(args *sqlArgs) []string {
+	return q.spec.conditions(args, q.query)
+}
+
+func (q *pageQuery) backwards() bool {
+	return q.cursor != nil && q.cursor.Direction == models.CursorPrev
+}
+
+// orderColumns is the sort plus the id tiebreaker, which follows the
+// direction of the last sort column so the default order is
+// (created_at DESC, id DESC). Walking backwards from a prev cursor flips
+// every direction; paginate flips the rows back.
+func (q *pageQuery) orderColumns() []sortColumn {
+	cols := append([]sortColumn{}, q.sort...)
+	cols = append(cols, sortColumn{name: "id", listColumn: idColumn, desc: q.sort[len(q.sort)-1].desc})
+	if q.backwards() {
+		for i := range cols {
+			cols[i].desc = !cols[i].desc
+		}
+	}
+	return cols
+}
+
+// keyset returns the condition selecting rows after the cursor in the
+// current order, or "" when there is no cursor
+func (q *pageQuery) keyset(args *sqlArgs) string {
+	if q.cursor == nil {
+		return ""
+	}
+	cols := q.orderColumns()
+	values := append(append([]string{}, q.cursor.Values...), q.cursor.ID)
+	placeholders := make([]string, len(cols))
+	for i, col := range cols {
+		placeholders[i] = args.add(values[i]) + "::" + col.typ
+	}
+
+	op := func(col sortColumn) string {
+		if col.desc {
+			return "<"
+		}
+		return ">"
+	}
+
+	// When every column runs the same way a row comparison does the job and
+	// lets Postgres use a matching index directly
+	uniform := true
+	for _, col := range cols[1:] {
+		uniform = uniform && col.desc == cols[0].desc
+	}
+	if uniform {
+		exprs := make([]string, len(cols))
+		for i, col := range cols {
+			exprs[i] = col.expr
+		}
+		return fmt.Sprintf("(%s) %s (%s)", strings.Join(exprs, ", "), op(cols[0]), strings.Join(placeholders, ", "))
+	}
+
+	// Mixed directions: (a > x) OR (a = x AND b < y) OR ...
+	var terms []string
+	for i, col := range cols {
+		var parts []string
+		for j := 0; j < i; j++ {
+			parts = append(parts, cols[j].expr+" = "+placeholders[j])
+		}
+		parts = append(parts, col.expr+" "+op(col)+" "+placeholders[i])
+		terms = append(terms, "("+strings.Join(parts, " AND ")+")")
+	}
+	return "(" + strings.Join(terms, " OR ") + ")"
+}
+
+// orderBy returns the ORDER BY expression
+func (q *pageQuery) orderBy() string {
+	cols := q.orderColumns()
+	exprs := make([]string, len(cols))
+	for i, col := range cols {
+		exprs[i] = col.expr + " ASC"
+		if col.desc {
+			exprs[i] = col.expr + " DESC"
+		}
+	}
+	return strings.Join(exprs, ", ")
+}
+
+// limit returns the LIMIT/OFFSET clause. One extra row is fetched to tell
+// whether another page follows.
+func (q *pageQuery) limit(args *sqlArgs) string {
+	clause := "LIMIT " + args.add(q.pageSize+1)
+	if q.cursor == nil && q.page > 1 {
+		clause += " OFFSET " + args.add((q.page-1)*q.pageSize)
+	}
+	return clause
+}
+
+// rowKey maps the sortable fields of a row, plus "id", to their values
+type rowKey map[string]any
+
+// cursorAt builds a cursor positioned on the row with the given key
+func (q *pageQuery) cursorAt(key rowKey, direction string) string {
+	values := make([]string, len(q.sort))
+	for i, col := range q.sort {
+		switch v := key[col.name].(type) {
+		case time.Time:
+			values[i] = v.UTC().Format(time.RFC3339Nano)
+		case string:
+			values[i] = v
+		default:
+			values[i] = fmt.Sprint(v)
+		}
+	}
+	id, _ := key["id"].(string)
+	return models.Cursor{Values: values, ID: id, Sort: q.sortKey(), Direction: direction}.Encode()
+}
+
+// paginate trims the extra row fetched by limit, restores the requested
+// order and builds the response with its cursors
+func paginate[T any](q *pageQuery, rows []T, key func(T) rowKey, total *int) *models.PaginatedResponse[T] {
+	hasMore := len(rows) > q.pageSize
+	if hasMore {
+		rows = rows[:q.pageSize]
+	}
+	backwards := q.backwards()
+	if backwards {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+	if rows == nil {
+		rows = []T{}
+	}
+
+	resp := &models.PaginatedResponse[T]{Results: rows, Total: total}
+	if q.cursor == nil {
+		resp.CurrentPage = q.page
+		if total != nil {
+			resp.TotalPages = (*total + q.pageSize - 1) / q.pageSize
+		}
+	}
+	if len(rows) == 0 {
+		return resp
+	}
+
+	// A next page exists if we saw an extra row going forwards, or if we
+	// came backwards from one. Likewise for the previous page.
+	hasNext := hasMore
+	hasPrev := q.cursor != nil || q.page > 1
+	if backwards {
+		hasNext = true
+		hasPrev = hasMore
+	}
+	if hasNext {
+		resp.NextCursor = q.cursorAt(key(rows[len(rows)-1]), models.CursorNext)
+	}
+	if hasPrev {
+		resp.PrevCursor = q.cursorAt(key(rows[0]), models.CursorPrev)
+	}
+	return resp
+}
+
+// where joins the non-empty conditions into a WHERE clause
+func where(conds ...string) string {
+	clause := ""
+	for _, c := range conds {
+		if c == "" {
+			continue
+		}
+		if clause == "" {
+			clause = "WHERE " + c
+		} else {
+			clause += " AND " + c
+		}
+	}
+	return clause
+}
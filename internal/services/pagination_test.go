@@ -0,0 +1,36 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/donnaloia/sendpulse/internal/models"
+)
+
+func TestNewListQueryRefusesTamperedCursors(t *testing.T) {
+	const id = "3f2a0000-0000-4000-8000-000000000001"
+	query := models.ListQuery{Sort: []models.SortField{{Field: "name"}, {Field: "created_at", Desc: true}}}
+
+	for _, tc := range []struct {
+		name   string
+		cursor models.Cursor
+		valid  bool
+	}{
+		{"as issued", models.Cursor{Values: []string{"Spring", "2026-10-19T08:00:00.123456Z"}, ID: id}, true},
+		{"malformed timestamp", models.Cursor{Values: []string{"Spring", "yesterday"}, ID: id}, false},
+		{"malformed id", models.Cursor{Values: []string{"Spring", "2026-10-19T08:00:00Z"}, ID: "1 OR 1=1"}, false},
+		{"NUL in text", models.Cursor{Values: []string{"Spr\x00ing", "2026-10-19T08:00:00Z"}, ID: id}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.cursor.Sort = "name,-created_at"
+			tc.cursor.Direction = models.CursorNext
+			_, err := newListQuery(templateListSpec, query, models.PaginationParams{Cursor: tc.cursor.Encode()})
+			if tc.valid && err != nil {
+				t.Fatal(err)
+			}
+			if !tc.valid && !errors.Is(err, ErrInvalidQuery) {
+				t.Fatalf("err = %v, want an invalid query", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PostgresStore is the Store backed by the service's Postgres database
+type PostgresStore struct {
+	db *sql.DB
+	// q is the database, or the transaction inside InTx
+	q querier
+	// slowQuery is how long a query can run before it's logged; zero
+	// disables the log
+	slowQuery time.Duration
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db, q: db}
+}
+
+// SetSlowQueryThreshold logs queries that take threshold or longer, with the
+// attributes of the request they ran for, e.g. its organization. Zero turns
+// the log off.
+func (s *PostgresStore) SetSlowQueryThreshold(threshold time.Duration) {
+	s.slowQuery = threshold
+}
+
+// querier is what the repositories run their queries on
+func (s *PostgresStore) querier() querier {
+	return &instrumentedQuerier{q: s.q, slowQuery: s.slowQuery}
+}
+
+func (s *PostgresStore) Organizations() OrganizationRepository {
+	return &pgOrganizations{q: s.querier()}
+}
+
+func (s *PostgresStore) Profiles() ProfileRepository {
+	return &pgProfiles{q: s.querier()}
+}
+
+func (s *PostgresStore) EmailAddresses() EmailAddressRepository {
+	return &pgEmailAddresses{q: s.querier()}
+}
+
+func (s *PostgresStore) EmailGroups() EmailGroupRepository {
+	return &pgEmailGroups{q: s.querier()}
+}
+
+func (s *PostgresStore) Templates() TemplateRepository {
+	return &pgTemplates{q: s.querier()}
+}
+
+func (s *PostgresStore) Campaigns() CampaignRepository {
+	return &pgCampaigns{q: s.querier()}
+}
+
+func (s *PostgresStore) APIKeys() APIKeyRepository {
+	return &pgAPIKeys{q: s.querier()}
+}
+
+func (s *PostgresStore) AuditLog() AuditRepository {
+	return &pgAuditLog{q: s.querier()}
+}
+
+func (s *PostgresStore) SendingUsage() SendingUsageRepository {
+	return &pgSendingUsage{q: s.querier()}
+}
+
+func (s *PostgresStore) Outbox() OutboxRepository {
+	return &pgOutbox{q: s.querier()}
+}
+
+// InTx runs fn in a transaction. Calls from inside fn join the transaction
+// that's already open.
+func (s *PostgresStore) InTx(ctx context.Context, fn func(tx Store) error) error {
+	if _, ok := s.q.(*sql.Tx); ok {
+		return fn(s)
+	}
+
+	tx, err := beginTx(ctx, s.db)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback if we don't commit
+
+	if err := fn(&PostgresStore{db: s.db, q: tx, slowQuery: s.slowQuery}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx, so repositories can run
+// inside or outside a transaction
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// tracer starts the spans for the services' SQL statements
+var tracer = otel.Tracer("github.com/donnaloia/sendpulse/internal/services")
+
+// instrumentedQuerier is a querier that traces each statement in a span of
+// its own and logs those that take slowQuery or longer. Statements are timed
+// until their results are ready, not until they've been read. Arguments
+// aren't recorded, as they're customer data.
+type instrumentedQuerier struct {
+	q         querier
+	slowQuery time.Duration
+}
+
+func (i *instrumentedQuerier) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, done := i.start(ctx, query)
+	res, err := i.q.ExecContext(ctx, query, args...)
+	done(err)
+	return res, err
+}
+
+func (i *instrumentedQuerier) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	ctx, done := i.start(ctx, query)
+	rows, err := i.q.QueryContext(ctx, query, args...)
+	done(err)
+	return rows, err
+}
+
+func (i *instrumentedQuerier) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	ctx, done := i.start(ctx, query)
+	row := i.q.QueryRowContext(ctx, query, args...)
+	done(row.Err())
+	return row
+}
+
+// start begins timing query, returning the context to run it with and the
+// function to call with its error once it's run
+func (i *instrumentedQuerier) start(ctx context.Context, query string) (context.Context, func(error)) {
+	start := time.Now()
+	statement := strings.Join(strings.Fields(query), " ")
+	operation, _, _ := strings.Cut(statement, " ")
+	ctx, span := tracer.Start(ctx, operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBOperationName(operation),
+			semconv.DBQueryText(statement),
+		),
+	)
+	return ctx, func(err error) {
+		// No rows is an answer, not a failure
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+
+		if d := time.Since(start); i.slowQuery > 0 && d >= i.slowQuery {
+			slog.WarnContext(ctx, "slow query", "duration", d, "query", statement)
+		}
+	}
+}
+
+// txOptions is the isolation level every transaction runs at. Writes lock the
+// rows they change before reading them, so read committed gives each
+// transaction a consistent view without serialization failures to retry.
+var txOptions = &sql.TxOptions{Isolation: sql.LevelReadCommitted}
+
+func beginTx(ctx context.Context, db *sql.DB) (*sql.Tx, error) {
+	return db.BeginTx(ctx, txOptions)
+}
+
+// pgMissing returns the ids that aren't rows of table belonging to the
+// organization. table is always a constant.
+func pgMissing(ctx context.Context, q querier, table, organizationID string, ids []string) ([]string, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	rows, err := q.QueryContext(ctx,
+		`SELECT id FROM `+table+` WHERE organization_id = $1 AND id = ANY($2::uuid[])`,
+		organizationID, pq.Array(ids),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error checking %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	owned := map[string]bool{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error checking %s: %w", table, err)
+		}
+		owned[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error checking %s: %w", table, err)
+	}
+
+	var missing []string
+	for _, id := range ids {
+		if !owned[strings.ToLower(id)] {
+			missing = append(missing, id)
+		}
+	}
+	return missing, nil
+}
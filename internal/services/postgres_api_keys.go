@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/donnaloia/sendpulse/internal/models"
+
+	"github.com/lib/pq"
+)
+
+type pgAPIKeys struct {
+	q querier
+}
+
+const apiKeyColumns = `id, organization_id, name, prefix, permissions, expires_at, last_used_at, revoked_at, created_at`
+
+func scanAPIKey(row interface{ Scan(...any) error }, key *models.APIKey, extra ...any) error {
+	return row.Scan(append([]any{
+		&key.ID,
+		&key.OrganizationID,
+		&key.Name,
+		&key.Prefix,
+		pq.Array(&key.Permissions),
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+		&key.RevokedAt,
+		&key.CreatedAt,
+	}, extra...)...)
+}
+
+func (r *pgAPIKeys) List(ctx context.Context, organizationID string, params models.PaginationParams) (*models.PaginatedResponse[models.APIKey], error) {
+	page, err := newPageQuery(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var total *int
+	if page.countTotal() {
+		var n int
+		err := r.q.QueryRowContext(ctx, "SELECT COUNT(*) FROM api_keys WHERE organization_id = $1", organizationID).Scan(&n)
+		if err != nil {
+			return nil, fmt.Errorf("error counting api keys: %w", err)
+		}
+		total = &n
+	}
+
+	var args sqlArgs
+	rows, err := r.q.QueryContext(ctx,
+		`SELECT `+apiKeyColumns+`
+		FROM api_keys
+		`+where("organization_id = "+args.add(organizationID), page.keyset(&args))+`
+		ORDER BY `+page.orderBy()+`
+		`+page.limit(&args),
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching api keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []models.APIKey
+	for rows.Next() {
+		var key models.APIKey
+		if err := scanAPIKey(rows, &key); err != nil {
+			return nil, fmt.Errorf("error scanning api key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error fetching api keys: %w", err)
+	}
+
+	return paginate(page, keys, apiKeyKey, total), nil
+}
+
+func (r *pgAPIKeys) Get(ctx context.Context, organizationID, id string) (*models.APIKey, error) {
+	return r.get(ctx, organizationID, id, "")
+}
+
+func (r *pgAPIKeys) GetForUpdate(ctx context.Context, organizationID, id string) (*models.APIKey, error) {
+	return r.get(ctx, organizationID, id, "FOR UPDATE")
+}
+
+// get loads a key. lock is empty or a constant locking clause.
+func (r *pgAPIKeys) get(ctx context.Context, organizationID, id, lock string) (*models.APIKey, error) {
+	var key models.APIKey
+	err := scanAPIKey(r.q.QueryRowContext(ctx,
+		`SELECT `+apiKeyColumns+`
+		FROM api_keys
+		WHERE id = $1 AND organization_id = $2
+		`+lock,
+		id, organizationID,
+	), &key)
+	if err == sql.ErrNoRows {
+		return nil, NotFound("api key")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching api key: %w", err)
+	}
+	return &key, nil
+}
+
+func (r *pgAPIKeys) GetByPrefix(ctx context.Context, prefix string) (*models.APIKey, string, error) {
+	var key models.APIKey
+	var keyHash string
+	err := scanAPIKey(r.q.QueryRowContext(ctx,
+		`SELECT `+apiKeyColumns+`, key_hash
+		FROM api_keys
+		WHERE prefix = $1`,
+		prefix,
+	), &key, &keyHash)
+	if err == sql.ErrNoRows {
+		return nil, "", NotFound("api key")
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("error fetching api key: %w", err)
+	}
+	return &key, keyHash, nil
+}
+
+func (r *pgAPIKeys) Create(ctx context.Context, organizationID string, req *models.CreateAPIKey, prefix, keyHash string) (*models.APIKey, error) {
+	permissions := req.Permissions
+	if permissions == nil {
+		permissions = []string{}
+	}
+
+	var key models.APIKey
+	err := scanAPIKey(r.q.QueryRowContext(ctx,
+		`INSERT INTO api_keys (organization_id, name, prefix, key_hash, permissions, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+apiKeyColumns,
+		organizationID, req.Name, prefix, keyHash, pq.Array(permissions), req.ExpiresAt,
+	), &key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating api key: %w", err)
+	}
+	return &key, nil
+}
+
+func (r *pgAPIKeys) Revoke(ctx context.Context, id string) (*models.APIKey, error) {
+	var key models.APIKey
+	err := scanAPIKey(r.q.QueryRowContext(ctx,
+		`UPDATE api_keys
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING `+apiKeyColumns,
+		id,
+	), &key)
+	if err == sql.ErrNoRows {
+		return nil, NotFound("api key")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error revoking api key: %w", err)
+	}
+	return &key, nil
+}
+
+// Touch only writes once a minute so busy keys don't turn every request into
+// a write
+func (r *pgAPIKeys) Touch(ctx context.Context, id string) error {
+	_, err := r.q.ExecContext(ctx,
+		`UPDATE api_keys
+		SET last_used_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < CURRENT_TIMESTAMP - INTERVAL '1 minute')`,
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("error recording api key usage: %w", err)
+	}
+	return nil
+}
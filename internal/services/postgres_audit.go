@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/donnaloia/sendpulse/internal/models"
+)
+
+type pgAuditLog struct {
+	q querier
+}
+
+func (r *pgAuditLog) List(ctx context.Context, organizationID string, filter models.AuditFilter, params models.PaginationParams) (*models.PaginatedResponse[models.AuditEntry], error) {
+	page, err := newPageQuery(params)
+	if err != nil {
+		return nil, err
+	}
+
+	// Empty filters are turned into NULLs so every condition can stay in the
+	// query text
+	filters := `organization_id = $1
+		AND ($2::text IS NULL OR actor_id = $2)
+		AND ($3::text IS NULL OR action = $3)
+		AND ($4::text IS NULL OR resource_type = $4)
+		AND ($5::text IS NULL OR resource_id = $5)
+		AND ($6::timestamptz IS NULL OR created_at >= $6)
+		AND ($7::timestamptz IS NULL OR created_at < $7)`
+	args := sqlArgs{
+		organizationID,
+		nullString(filter.ActorID),
+		nullString(filter.Action),
+		nullString(filter.ResourceType),
+		nullString(filter.ResourceID),
+		filter.CreatedAfter,
+		filter.CreatedBefore,
+	}
+
+	var total *int
+	if page.countTotal() {
+		var n int
+		err := r.q.QueryRowContext(ctx, "SELECT COUNT(*) FROM audit_log WHERE "+filters, args...).Scan(&n)
+		if err != nil {
+			return nil, fmt.Errorf("error counting audit entries: %w", err)
+		}
+		total = &n
+	}
+
+	rows, err := r.q.QueryContext(ctx,
+		`SELECT id, organization_id, actor_id, actor_type, action, resource_type, resource_id,
+			before, after, changes, request_id, ip, created_at
+		FROM audit_log
+		`+where(filters, page.keyset(&args))+`
+		ORDER BY `+page.orderBy()+`
+		`+page.limit(&args),
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []models.AuditEntry
+	for rows.Next() {
+		var entry models.AuditEntry
+		var before, after []byte
+		if err := rows.Scan(
+			&entry.ID,
+			&entry.OrganizationID,
+			&entry.ActorID,
+			&entry.ActorType,
+			&entry.Action,
+			&entry.ResourceType,
+			&entry.ResourceID,
+			&before,
+			&after,
+			&entry.Changes,
+			&entry.RequestID,
+			&entry.IP,
+			&entry.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("error scanning audit entry: %w", err)
+		}
+		// NULL snapshots come back as nil and marshal as JSON null
+		if before != nil {
+			entry.Before = before
+		}
+		if after != nil {
+			entry.After = after
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error fetching audit entries: %w", err)
+	}
+
+	return paginate(page, entries, auditKey, total), nil
+}
+
+func (r *pgAuditLog) Create(ctx context.Context, entry *models.AuditEntry) error {
+	_, err := r.q.ExecContext(ctx,
+		`INSERT INTO audit_log (organization_id, actor_id, actor_type, action, resource_type, resource_id,
+			before, after, changes, request_id, ip)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		entry.OrganizationID,
+		entry.ActorID,
+		entry.ActorType,
+		entry.Action,
+		entry.ResourceType,
+		entry.ResourceID,
+		jsonOrNull(entry.Before),
+		jsonOrNull(entry.After),
+		string(entry.Changes),
+		entry.RequestID,
+		entry.IP,
+	)
+	if err != nil {
+		return fmt.Errorf("error writing audit log: %w", err)
+	}
+	return nil
+}
+
+// jsonOrNull passes a snapshot as a JSONB parameter. lib/pq sends []byte as
+// bytea, so the JSON has to go over the wire as a string.
+func jsonOrNull(raw json.RawMessage) any {
+	if raw == nil {
+		return nil
+	}
+	return string(raw)
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
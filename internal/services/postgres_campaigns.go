@@ -0,0 +1,253 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/donnaloia/sendpulse/internal/models"
+	"github.com/lib/pq"
+)
+
+type pgCampaigns struct {
+	q querier
+}
+
+func (r *pgCampaigns) List(ctx context.Context, organizationID string, query models.ListQuery, params models.PaginationParams) (*models.PaginatedResponse[models.Campaign], error) {
+	page, err := newListQuery(campaignListSpec, query, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var args sqlArgs
+	conds := append([]string{"organization_id = " + args.add(organizationID)}, page.conditions(&args)...)
+
+	var total *int
+	if page.countTotal() {
+		var n int
+		err := r.q.QueryRowContext(ctx, "SELECT COUNT(*) FROM campaigns "+where(conds...), args...).Scan(&n)
+		if err != nil {
+			return nil, fmt.Errorf("error counting campaigns: %w", err)
+		}
+		total = &n
+	}
+
+	rows, err := r.q.QueryContext(ctx,
+		`SELECT id, name, status, organization_id, created_at, version
+		FROM campaigns
+		`+where(append(conds, page.keyset(&args))...)+`
+		ORDER BY `+page.orderBy()+`
+		`+page.limit(&args),
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching campaigns: %w", err)
+	}
+	defer rows.Close()
+
+	var campaigns []models.Campaign
+	for rows.Next() {
+		var campaign models.Campaign
+		if err := rows.Scan(
+			&campaign.ID,
+			&campaign.Name,
+			&campaign.Status,
+			&campaign.OrganizationID,
+			&campaign.CreatedAt,
+			&campaign.Version,
+		); err != nil {
+			return nil, fmt.Errorf("error scanning campaign: %w", err)
+		}
+		campaigns = append(campaigns, campaign)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error fetching campaigns: %w", err)
+	}
+
+	return paginate(page, campaigns, campaignKey, total), nil
+}
+
+// Get loads a campaign with its templates and email groups in a single round
+// trip. The links are aggregated to JSON arrays so the row count doesn't grow
+// with them.
+func (r *pgCampaigns) Get(ctx context.Context, organizationID, id string) (*models.Campaign, error) {
+	var campaign models.Campaign
+	var templates, emailGroups []byte
+	err := r.q.QueryRowContext(ctx,
+		`SELECT c.id, c.name, c.status, c.organization_id, c.created_at, c.version,
+			COALESCE((
+				SELECT json_agg(json_build_object(
+					'id', t.id,
+					'name', t.name,
+					'organization_id', t.organization_id,
+					'html', t.html,
+					'created_at', t.created_at,
+					'version', t.version
+				) ORDER BY ct.created_at, t.id)
+				FROM campaign_templates ct
+				JOIN templates t ON t.id = ct.template_id
+				WHERE ct.campaign_id = c.id
+			), '[]'),
+			COALESCE((
+				SELECT json_agg(json_build_object(
+					'id', eg.id,
+					'name', eg.name,
+					'organization_id', eg.organization_id,
+					'created_at', eg.created_at
+				) ORDER BY egc.created_at, eg.id)
+				FROM email_group_campaigns egc
+				JOIN email_groups eg ON eg.id = egc.email_group_id
+				WHERE egc.campaign_id = c.id
+			), '[]')
+		FROM campaigns c
+		WHERE c.id = $1 AND c.organization_id = $2`,
+		id, organizationID,
+	).Scan(
+		&campaign.ID,
+		&campaign.Name,
+		&campaign.Status,
+		&campaign.OrganizationID,
+		&campaign.CreatedAt,
+		&campaign.Version,
+		&templates,
+		&emailGroups,
+	)
+	if err == sql.ErrNoRows {
+		return nil, NotFound("campaign")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching campaign: %w", err)
+	}
+
+	if err := json.Unmarshal(templates, &campaign.Templates); err != nil {
+		return nil, fmt.Errorf("error decoding templates: %w", err)
+	}
+	if err := json.Unmarshal(emailGroups, &campaign.EmailGroups); err != nil {
+		return nil, fmt.Errorf("error decoding email groups: %w", err)
+	}
+
+	return &campaign, nil
+}
+
+// GetForUpdate locks the campaign row before loading it. The link rows
+// aren't locked; every change to them goes through a locked campaign.
+func (r *pgCampaigns) GetForUpdate(ctx context.Context, organizationID, id string) (*models.Campaign, error) {
+	var locked string
+	err := r.q.QueryRowContext(ctx,
+		`SELECT id FROM campaigns WHERE id = $1 AND organization_id = $2 FOR UPDATE`,
+		id, organizationID,
+	).Scan(&locked)
+	if err == sql.ErrNoRows {
+		return nil, NotFound("campaign")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error locking campaign: %w", err)
+	}
+	return r.Get(ctx, organizationID, id)
+}
+
+func (r *pgCampaigns) Create(ctx context.Context, organizationID string, req *models.CreateCampaign) (*models.Campaign, error) {
+	var campaign models.Campaign
+	err := r.q.QueryRowContext(ctx,
+		`INSERT INTO campaigns (name, organization_id)
+		VALUES ($1, $2)
+		RETURNING id, name, status, organization_id, created_at, version`,
+		req.Name, organizationID,
+	).Scan(
+		&campaign.ID,
+		&campaign.Name,
+		&campaign.Status,
+		&campaign.OrganizationID,
+		&campaign.CreatedAt,
+		&campaign.Version,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating campaign: %w", err)
+	}
+	return &campaign, nil
+}
+
+func (r *pgCampaigns) Recipients(ctx context.Context, organizationID, id string) ([]string, error) {
+	rows, err := r.q.QueryContext(ctx,
+		`SELECT DISTINCT ea.address
+		FROM campaigns c
+		JOIN email_group_campaigns egc ON egc.campaign_id = c.id
+		JOIN email_group_members egm ON egm.email_group_id = egc.email_group_id
+		JOIN email_addresses ea ON ea.id = egm.email_address_id
+		WHERE c.id = $1 AND c.organization_id = $2
+		ORDER BY ea.address`,
+		id, organizationID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching recipients: %w", err)
+	}
+	defer rows.Close()
+
+	recipients := []string{}
+	for rows.Next() {
+		var address string
+		if err := rows.Scan(&address); err != nil {
+			return nil, fmt.Errorf("error scanning recipient: %w", err)
+		}
+		recipients = append(recipients, address)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error fetching recipients: %w", err)
+	}
+	return recipients, nil
+}
+
+func (r *pgCampaigns) Update(ctx context.Context, organizationID, id string, change *CampaignChange) error {
+	err := r.updateLinks(ctx, "campaign_templates", "template_id", id, change.AddTemplates, change.RemoveTemplates)
+	if err != nil {
+		return fmt.Errorf("error updating templates: %w", err)
+	}
+	err = r.updateLinks(ctx, "email_group_campaigns", "email_group_id", id, change.AddEmailGroups, change.RemoveEmailGroups)
+	if err != nil {
+		return fmt.Errorf("error updating email_groups: %w", err)
+	}
+
+	// Name, status and version change together; empty fields are left alone
+	res, err := r.q.ExecContext(ctx,
+		`UPDATE campaigns
+		SET name = COALESCE(NULLIF($1, ''), name),
+			status = COALESCE(NULLIF($2, ''), status),
+			version = version + 1
+		WHERE id = $3 AND organization_id = $4`,
+		change.Name, change.Status, id, organizationID,
+	)
+	if err != nil {
+		return fmt.Errorf("error updating campaign: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return NotFound("campaign")
+	}
+	return nil
+}
+
+// updateLinks deletes and inserts a campaign's rows in a link table with one
+// statement each. table and column are always constants.
+func (r *pgCampaigns) updateLinks(ctx context.Context, table, column, campaignID string, added, removed []string) error {
+	if len(removed) > 0 {
+		_, err := r.q.ExecContext(ctx,
+			`DELETE FROM `+table+` WHERE campaign_id = $1 AND `+column+` = ANY($2::uuid[])`,
+			campaignID, pq.Array(removed),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	if len(added) > 0 {
+		_, err := r.q.ExecContext(ctx,
+			`INSERT INTO `+table+` (campaign_id, `+column+`)
+			SELECT $1, linked_id FROM unnest($2::uuid[]) AS linked_id
+			ON CONFLICT DO NOTHING`,
+			campaignID, pq.Array(added),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/donnaloia/sendpulse/internal/models"
+)
+
+type pgEmailAddresses struct {
+	q querier
+}
+
+func (r *pgEmailAddresses) List(ctx context.Context, organizationID string, query models.ListQuery, params models.PaginationParams) (*models.PaginatedResponse[models.EmailAddress], error) {
+	page, err := newListQuery(emailListSpec, query, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var args sqlArgs
+	conds := append([]string{"organization_id = " + args.add(organizationID)}, page.conditions(&args)...)
+
+	var total *int
+	if page.countTotal() {
+		var n int
+		err := r.q.QueryRowContext(ctx, "SELECT COUNT(*) FROM email_addresses "+where(conds...), args...).Scan(&n)
+		if err != nil {
+			return nil, fmt.Errorf("error counting emails: %w", err)
+		}
+		total = &n
+	}
+
+	rows, err := r.q.QueryContext(ctx,
+		`SELECT id, address, organization_id, created_at
+		FROM email_addresses
+		`+where(append(conds, page.keyset(&args))...)+`
+		ORDER BY `+page.orderBy()+`
+		`+page.limit(&args),
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching emails: %w", err)
+	}
+	defer rows.Close()
+
+	var emails []models.EmailAddress
+	for rows.Next() {
+		var email models.EmailAddress
+		if err := rows.Scan(
+			&email.ID,
+			&email.Address,
+			&email.OrganizationID,
+			&email.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("error scanning email: %w", err)
+		}
+		emails = append(emails, email)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error fetching emails: %w", err)
+	}
+
+	return paginate(page, emails, emailKey, total), nil
+}
+
+func (r *pgEmailAddresses) Get(ctx context.Context, organizationID, id string) (*models.EmailAddress, error) {
+	var email models.EmailAddress
+	err := r.q.QueryRowContext(ctx,
+		`SELECT id, address, organization_id, created_at
+		FROM email_addresses
+		WHERE id = $1 AND organization_id = $2`,
+		id, organizationID,
+	).Scan(
+		&email.ID,
+		&email.Address,
+		&email.OrganizationID,
+		&email.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, NotFound("email")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching email: %w", err)
+	}
+	return &email, nil
+}
+
+func (r *pgEmailAddresses) Create(ctx context.Context, organizationID string, req *models.CreateEmailAddressRequest) (*models.EmailAddress, error) {
+	var email models.EmailAddress
+	err := r.q.QueryRowContext(ctx,
+		`INSERT INTO email_addresses (address, organization_id)
+		VALUES ($1, $2)
+		RETURNING id, address, organization_id, created_at`,
+		req.Address, organizationID,
+	).Scan(
+		&email.ID,
+		&email.Address,
+		&email.OrganizationID,
+		&email.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating email: %w", err)
+	}
+	return &email, nil
+}
+
+func (r *pgEmailAddresses) Missing(ctx context.Context, organizationID string, ids []string) ([]string, error) {
+	return pgMissing(ctx, r.q, "email_addresses", organizationID, ids)
+}
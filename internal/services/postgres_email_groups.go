@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/donnaloia/sendpulse/internal/models"
+)
+
+type pgEmailGroups struct {
+	q querier
+}
+
+func (r *pgEmailGroups) List(ctx context.Context, organizationID string, query models.ListQuery, params models.PaginationParams) (*models.PaginatedResponse[models.EmailGroup], error) {
+	page, err := newListQuery(emailGroupListSpec, query, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var args sqlArgs
+	conds := append([]string{"organization_id = " + args.add(organizationID)}, page.conditions(&args)...)
+
+	var total *int
+	if page.countTotal() {
+		var n int
+		err := r.q.QueryRowContext(ctx, "SELECT COUNT(*) FROM email_groups "+where(conds...), args...).Scan(&n)
+		if err != nil {
+			return nil, fmt.Errorf("error counting email groups: %w", err)
+		}
+		total = &n
+	}
+
+	rows, err := r.q.QueryContext(ctx,
+		`SELECT id, name, organization_id, created_at
+		FROM email_groups
+		`+where(append(conds, page.keyset(&args))...)+`
+		ORDER BY `+page.orderBy()+`
+		`+page.limit(&args),
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching email groups: %w", err)
+	}
+	defer rows.Close()
+
+	var groups []models.EmailGroup
+	for rows.Next() {
+		var group models.EmailGroup
+		if err := rows.Scan(
+			&group.ID,
+			&group.Name,
+			&group.OrganizationID,
+			&group.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("error scanning email group: %w", err)
+		}
+		groups = append(groups, group)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error fetching email groups: %w", err)
+	}
+
+	return paginate(page, groups, emailGroupKey, total), nil
+}
+
+func (r *pgEmailGroups) Get(ctx context.Context, organizationID, id string) (*models.EmailGroup, error) {
+	var group models.EmailGroup
+	err := r.q.QueryRowContext(ctx,
+		`SELECT id, name, organization_id, created_at
+		FROM email_groups
+		WHERE id = $1 AND organization_id = $2`,
+		id, organizationID,
+	).Scan(
+		&group.ID,
+		&group.Name,
+		&group.OrganizationID,
+		&group.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, NotFound("email group")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching email group: %w", err)
+	}
+	return &group, nil
+}
+
+func (r *pgEmailGroups) Create(ctx context.Context, organizationID string, req *models.CreateEmailGroup) (*models.EmailGroup, error) {
+	var group models.EmailGroup
+	err := r.q.QueryRowContext(ctx,
+		`INSERT INTO email_groups (name, organization_id)
+		VALUES ($1, $2)
+		RETURNING id, name, organization_id, created_at`,
+		req.Name,
+		organizationID,
+	).Scan(
+		&group.ID,
+		&group.Name,
+		&group.OrganizationID,
+		&group.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating email group: %w", err)
+	}
+	return &group, nil
+}
+
+func (r *pgEmailGroups) Missing(ctx context.Context, organizationID string, ids []string) ([]string, error) {
+	return pgMissing(ctx, r.q, "email_groups", organizationID, ids)
+}
+
+// memberOfOrganization scopes email_group_members to an organization through
+// the member's group. It's a subquery rather than a join so the pagination
+// columns stay unambiguous.
+const memberOfOrganization = `email_group_id IN (SELECT id FROM email_groups WHERE organization_id = `
+
+func (r *pgEmailGroups) ListMembers(ctx context.Context, organizationID string, params models.PaginationParams) (*models.PaginatedResponse[models.EmailGroupMember], error) {
+	page, err := newPageQuery(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var args sqlArgs
+	scope := memberOfOrganization + args.add(organizationID) + ")"
+
+	var total *int
+	if page.countTotal() {
+		var n int
+		err := r.q.QueryRowContext(ctx, "SELECT COUNT(*) FROM email_group_members "+where(scope), args...).Scan(&n)
+		if err != nil {
+			return nil, fmt.Errorf("error counting group members: %w", err)
+		}
+		total = &n
+	}
+
+	rows, err := r.q.QueryContext(ctx,
+		`SELECT id, email_group_id, email_address_id, created_at
+		FROM email_group_members
+		`+where(scope, page.keyset(&args))+`
+		ORDER BY `+page.orderBy()+`
+		`+page.limit(&args),
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching group members: %w", err)
+	}
+	defer rows.Close()
+
+	var members []models.EmailGroupMember
+	for rows.Next() {
+		var member models.EmailGroupMember
+		if err := rows.Scan(
+			&member.ID,
+			&member.EmailGroupID,
+			&member.EmailAddressID,
+			&member.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("error scanning group member: %w", err)
+		}
+		members = append(members, member)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error fetching group members: %w", err)
+	}
+
+	return paginate(page, members, memberKey, total), nil
+}
+
+func (r *pgEmailGroups) GetMember(ctx context.Context, organizationID, id string) (*models.EmailGroupMember, error) {
+	var member models.EmailGroupMember
+	err := r.q.QueryRowContext(ctx,
+		`SELECT id, email_group_id, email_address_id, created_at
+		FROM email_group_members
+		WHERE id = $1 AND `+memberOfOrganization+`$2)`,
+		id, organizationID,
+	).Scan(
+		&member.ID,
+		&member.EmailGroupID,
+		&member.EmailAddressID,
+		&member.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, NotFound("group member")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching group member: %w", err)
+	}
+	return &member, nil
+}
+
+func (r *pgEmailGroups) AddMember(ctx context.Context, req *models.CreateEmailGroupMember) (*models.EmailGroupMember, error) {
+	var member models.EmailGroupMember
+	err := r.q.QueryRowContext(ctx,
+		`INSERT INTO email_group_members (email_group_id, email_address_id)
+		VALUES ($1, $2)
+		RETURNING id, email_group_id, email_address_id, created_at`,
+		req.EmailGroupID, req.EmailAddressID,
+	).Scan(
+		&member.ID,
+		&member.EmailGroupID,
+		&member.EmailAddressID,
+		&member.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating group member: %w", err)
+	}
+	return &member, nil
+}
+
+func (r *pgEmailGroups) RemoveMember(ctx context.Context, organizationID, id string) (*models.EmailGroupMember, error) {
+	var member models.EmailGroupMember
+	err := r.q.QueryRowContext(ctx,
+		`DELETE FROM email_group_members
+		WHERE id = $1 AND `+memberOfOrganization+`$2)
+		RETURNING id, email_group_id, email_address_id, created_at`,
+		id, organizationID,
+	).Scan(
+		&member.ID,
+		&member.EmailGroupID,
+		&member.EmailAddressID,
+		&member.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, NotFound("group member")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error deleting group member: %w", err)
+	}
+	return &member, nil
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/donnaloia/sendpulse/internal/models"
+)
+
+type pgOrganizations struct {
+	q querier
+}
+
+func (r *pgOrganizations) List(ctx context.Context, params models.PaginationParams) (*models.PaginatedResponse[models.Organization], error) {
+	page, err := newPageQuery(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var total *int
+	if page.countTotal() {
+		var n int
+		err := r.q.QueryRowContext(ctx, "SELECT COUNT(*) FROM organizations").Scan(&n)
+		if err != nil {
+			return nil, fmt.Errorf("error counting organizations: %w", err)
+		}
+		total = &n
+	}
+
+	var args sqlArgs
+	rows, err := r.q.QueryContext(ctx,
+		`SELECT id, name, created_at
+		FROM organizations
+		`+where(page.keyset(&args))+`
+		ORDER BY `+page.orderBy()+`
+		`+page.limit(&args),
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching organizations: %w", err)
+	}
+	defer rows.Close()
+
+	var orgs []models.Organization
+	for rows.Next() {
+		var org models.Organization
+		if err := rows.Scan(
+			&org.ID,
+			&org.Name,
+			&org.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("error scanning organization: %w", err)
+		}
+		orgs = append(orgs, org)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error fetching organizations: %w", err)
+	}
+
+	return paginate(page, orgs, organizationKey, total), nil
+}
+
+func (r *pgOrganizations) Get(ctx context.Context, id string) (*models.Organization, error) {
+	var org models.Organization
+	err := r.q.QueryRowContext(ctx,
+		"SELECT id, name, created_at FROM organizations WHERE id = $1",
+		id,
+	).Scan(
+		&org.ID,
+		&org.Name,
+		&org.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, NotFound("organization")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching organization: %w", err)
+	}
+	return &org, nil
+}
+
+func (r *pgOrganizations) Create(ctx context.Context, req *models.CreateOrganization) (*models.Organization, error) {
+	var org models.Organization
+	err := r.q.QueryRowContext(ctx,
+		`INSERT INTO organizations (name)
+		VALUES ($1)
+		RETURNING id, name, created_at`,
+		req.Name,
+	).Scan(
+		&org.ID,
+		&org.Name,
+		&org.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating organization: %w", err)
+	}
+	return &org, nil
+}
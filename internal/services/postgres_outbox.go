@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type pgOutbox struct {
+	q querier
+}
+
+func (r *pgOutbox) Add(ctx context.Context, msg *OutboxMessage) error {
+	payload, err := json.Marshal(msg.Event)
+	if err != nil {
+		return fmt.Errorf("error marshaling launch event: %w", err)
+	}
+	traceContext, err := json.Marshal(msg.TraceContext)
+	if err != nil {
+		return fmt.Errorf("error marshaling trace context: %w", err)
+	}
+	err = r.q.QueryRowContext(ctx,
+		`INSERT INTO launch_outbox (campaign_id, payload, trace_context, send_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`,
+		msg.Event.CampaignID, payload, traceContext, msg.SendAt,
+	).Scan(&msg.ID)
+	if err != nil {
+		return fmt.Errorf("error adding launch event to outbox: %w", err)
+	}
+	return nil
+}
+
+// Due locks the events it returns with SKIP LOCKED, so relays on several
+// instances each publish different events
+func (r *pgOutbox) Due(ctx context.Context, now time.Time, limit int) ([]OutboxMessage, error) {
+	rows, err := r.q.QueryContext(ctx,
+		`SELECT id, payload, trace_context, send_at
+		FROM launch_outbox
+		WHERE send_at <= $1
+		ORDER BY send_at, id
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED`,
+		now, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching outbox: %w", err)
+	}
+	defer rows.Close()
+
+	var msgs []OutboxMessage
+	for rows.Next() {
+		var msg OutboxMessage
+		var payload, traceContext []byte
+		if err := rows.Scan(&msg.ID, &payload, &traceContext, &msg.SendAt); err != nil {
+			return nil, fmt.Errorf("error scanning outbox: %w", err)
+		}
+		if err := json.Unmarshal(payload, &msg.Event); err != nil {
+			return nil, fmt.Errorf("error unmarshaling launch event %d: %w", msg.ID, err)
+		}
+		if err := json.Unmarshal(traceContext, &msg.TraceContext); err != nil {
+			return nil, fmt.Errorf("error unmarshaling trace context of launch event %d: %w", msg.ID, err)
+		}
+		msgs = append(msgs, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error fetching outbox: %w", err)
+	}
+	return msgs, nil
+}
+
+func (r *pgOutbox) Delete(ctx context.Context, id int64) error {
+	_, err := r.q.ExecContext(ctx, "DELETE FROM launch_outbox WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("error deleting launch event from outbox: %w", err)
+	}
+	return nil
+}
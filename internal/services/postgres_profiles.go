@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/donnaloia/sendpulse/internal/models"
+)
+
+type pgProfiles struct {
+	q querier
+}
+
+const profileColumns = `id, username, email, first_name, last_name, timezone, bio, organization_id, picture_url, created_at`
+
+func scanProfile(row interface{ Scan(...any) error }, profile *models.Profile) error {
+	return row.Scan(
+		&profile.ID,
+		&profile.Username,
+		&profile.Email,
+		&profile.FirstName,
+		&profile.LastName,
+		&profile.Timezone,
+		&profile.Bio,
+		&profile.OrganizationID,
+		&profile.PictureURL,
+		&profile.CreatedAt,
+	)
+}
+
+func (r *pgProfiles) List(ctx context.Context, organizationID string, params models.PaginationParams) (*models.PaginatedResponse[models.Profile], error) {
+	page, err := newPageQuery(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var total *int
+	if page.countTotal() {
+		var n int
+		err := r.q.QueryRowContext(ctx, "SELECT COUNT(*) FROM profiles WHERE organization_id = $1", organizationID).Scan(&n)
+		if err != nil {
+			return nil, fmt.Errorf("error counting profiles: %w", err)
+		}
+		total = &n
+	}
+
+	var args sqlArgs
+	rows, err := r.q.QueryContext(ctx,
+		`SELECT `+profileColumns+`
+		FROM profiles
+		`+where("organization_id = "+args.add(organizationID), page.keyset(&args))+`
+		ORDER BY `+page.orderBy()+`
+		`+page.limit(&args),
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching profiles: %w", err)
+	}
+	defer rows.Close()
+
+	var profiles []models.Profile
+	for rows.Next() {
+		var profile models.Profile
+		if err := scanProfile(rows, &profile); err != nil {
+			return nil, fmt.Errorf("error scanning profile: %w", err)
+		}
+		profiles = append(profiles, profile)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error fetching profiles: %w", err)
+	}
+
+	return paginate(page, profiles, profileKey, total), nil
+}
+
+func (r *pgProfiles) Get(ctx context.Context, organizationID, id string) (*models.Profile, error) {
+	return r.get(ctx, organizationID, id, "")
+}
+
+func (r *pgProfiles) GetForUpdate(ctx context.Context, organizationID, id string) (*models.Profile, error) {
+	return r.get(ctx, organizationID, id, "FOR UPDATE")
+}
+
+// get loads a profile. lock is empty or a constant locking clause.
+func (r *pgProfiles) get(ctx context.Context, organizationID, id, lock string) (*models.Profile, error) {
+	var profile models.Profile
+	err := scanProfile(r.q.QueryRowContext(ctx,
+		`SELECT `+profileColumns+`
+		FROM profiles
+		WHERE id = $1 AND organization_id = $2
+		`+lock,
+		id, organizationID,
+	), &profile)
+	if err == sql.ErrNoRows {
+		return nil, NotFound("profile")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching profile: %w", err)
+	}
+	return &profile, nil
+}
+
+func (r *pgProfiles) Create(ctx context.Context, organizationID string, req *models.CreateProfile) (*models.Profile, error) {
+	var profile models.Profile
+	err := scanProfile(r.q.QueryRowContext(ctx,
+		`INSERT INTO profiles (id, username, email, first_name, last_name, timezone, bio, organization_id, picture_url)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING `+profileColumns,
+		req.ID, req.Username, req.Email, req.FirstName, req.LastName, req.Timezone, req.Bio, organizationID, req.PictureURL,
+	), &profile)
+	if err != nil {
+		return nil, fmt.Errorf("error creating profile: %w", err)
+	}
+	return &profile, nil
+}
+
+func (r *pgProfiles) Update(ctx context.Context, organizationID, id string, req *models.UpdateProfile) (*models.Profile, error) {
+	var profile models.Profile
+	err := scanProfile(r.q.QueryRowContext(ctx,
+		`UPDATE profiles
+		SET username = $1,
+			email = $2,
+			first_name = $3,
+			last_name = $4,
+			timezone = $5,
+			bio = $6,
+			picture_url = $7
+		WHERE id = $8 AND organization_id = $9
+		RETURNING `+profileColumns,
+		req.Username,
+		req.Email,
+		req.FirstName,
+		req.LastName,
+		req.Timezone,
+		req.Bio,
+		req.PictureURL,
+		id,
+		organizationID,
+	), &profile)
+	if err == sql.ErrNoRows {
+		return nil, NotFound("profile")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error updating profile: %w", err)
+	}
+	return &profile, nil
+}
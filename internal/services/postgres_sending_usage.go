@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type pgSendingUsage struct {
+	q querier
+}
+
+func (r *pgSendingUsage) Get(ctx context.Context, organizationID string, day time.Time) (SendingCount, error) {
+	// Days are passed as dates rather than times, so the session's time
+	// zone can't move them
+	var count SendingCount
+	err := r.q.QueryRowContext(ctx,
+		`SELECT
+			COALESCE(SUM(recipients) FILTER (WHERE day = $2::date), 0),
+			COALESCE(SUM(recipients), 0)
+		FROM sending_usage
+		WHERE organization_id = $1
+			AND day BETWEEN $3::date AND $2::date`,
+		organizationID, day.UTC().Format(time.DateOnly), monthStart(day).Format(time.DateOnly),
+	).Scan(&count.Day, &count.Month)
+	if err != nil {
+		return SendingCount{}, fmt.Errorf("error fetching sending usage: %w", err)
+	}
+	return count, nil
+}
+
+// GetForUpdate locks the organization's row rather than its counts, which
+// may not exist yet. NO KEY UPDATE doesn't block the inserts that reference
+// the organization.
+func (r *pgSendingUsage) GetForUpdate(ctx context.Context, organizationID string, day time.Time) (SendingCount, error) {
+	var id string
+	err := r.q.QueryRowContext(ctx,
+		"SELECT id FROM organizations WHERE id = $1 FOR NO KEY UPDATE",
+		organizationID,
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return SendingCount{}, NotFound("organization")
+	}
+	if err != nil {
+		return SendingCount{}, fmt.Errorf("error locking organization: %w", err)
+	}
+	return r.Get(ctx, organizationID, day)
+}
+
+func (r *pgSendingUsage) Add(ctx context.Context, organizationID string, day time.Time, recipients int) error {
+	_, err := r.q.ExecContext(ctx,
+		`INSERT INTO sending_usage (organization_id, day, recipients)
+		VALUES ($1, $2::date, $3)
+		ON CONFLICT (organization_id, day)
+		DO UPDATE SET recipients = sending_usage.recipients + EXCLUDED.recipients`,
+		organizationID, day.UTC().Format(time.DateOnly), recipients,
+	)
+	if err != nil {
+		return fmt.Errorf("error recording sending usage: %w", err)
+	}
+	return nil
+}
+
+func (r *pgSendingUsage) ScheduleDomain(ctx context.Context, domain string, now time.Time, d time.Duration) (time.Time, error) {
+	var start time.Time
+	err := r.q.QueryRowContext(ctx,
+		`INSERT INTO sending_schedule AS s (domain, free_at)
+		VALUES (lower($1), $2::timestamptz + $3::bigint * interval '1 microsecond')
+		ON CONFLICT (domain) DO UPDATE
+		SET free_at = GREATEST(s.free_at, $2::timestamptz) + $3::bigint * interval '1 microsecond'
+		RETURNING free_at - $3::bigint * interval '1 microsecond'`,
+		domain, now, d.Microseconds(),
+	).Scan(&start)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error scheduling sending domain: %w", err)
+	}
+	return start, nil
+}
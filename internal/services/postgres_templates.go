@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/donnaloia/sendpulse/internal/models"
+)
+
+type pgTemplates struct {
+	q querier
+}
+
+const templateColumns = `id, name, organization_id, html, created_at, version`
+
+func scanTemplate(row interface{ Scan(...any) error }, template *models.Template) error {
+	return row.Scan(
+		&template.ID,
+		&template.Name,
+		&template.OrganizationID,
+		&template.HTML,
+		&template.CreatedAt,
+		&template.Version,
+	)
+}
+
+func (r *pgTemplates) List(ctx context.Context, organizationID string, query models.ListQuery, params models.PaginationParams) (*models.PaginatedResponse[models.Template], error) {
+	page, err := newListQuery(templateListSpec, query, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var args sqlArgs
+	conds := append([]string{"organization_id = " + args.add(organizationID)}, page.conditions(&args)...)
+
+	var total *int
+	if page.countTotal() {
+		var n int
+		err := r.q.QueryRowContext(ctx, "SELECT COUNT(*) FROM templates "+where(conds...), args...).Scan(&n)
+		if err != nil {
+			return nil, fmt.Errorf("error counting templates: %w", err)
+		}
+		total = &n
+	}
+
+	rows, err := r.q.QueryContext(ctx,
+		`SELECT `+templateColumns+`
+		FROM templates
+		`+where(append(conds, page.keyset(&args))...)+`
+		ORDER BY `+page.orderBy()+`
+		`+page.limit(&args),
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching templates: %w", err)
+	}
+	defer rows.Close()
+
+	var templates []models.Template
+	for rows.Next() {
+		var template models.Template
+		if err := scanTemplate(rows, &template); err != nil {
+			return nil, fmt.Errorf("error scanning template: %w", err)
+		}
+		templates = append(templates, template)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error fetching templates: %w", err)
+	}
+
+	return paginate(page, templates, templateKey, total), nil
+}
+
+func (r *pgTemplates) Get(ctx context.Context, organizationID, id string) (*models.Template, error) {
+	return r.get(ctx, organizationID, id, "")
+}
+
+func (r *pgTemplates) GetForUpdate(ctx context.Context, organizationID, id string) (*models.Template, error) {
+	return r.get(ctx, organizationID, id, "FOR UPDATE")
+}
+
+// get loads a template. lock is empty or a constant locking clause.
+func (r *pgTemplates) get(ctx context.Context, organizationID, id, lock string) (*models.Template, error) {
+	var template models.Template
+	err := scanTemplate(r.q.QueryRowContext(ctx,
+		`SELECT `+templateColumns+`
+		FROM templates
+		WHERE id = $1 AND organization_id = $2
+		`+lock,
+		id, organizationID,
+	), &template)
+	if err == sql.ErrNoRows {
+		return nil, NotFound("template")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching template: %w", err)
+	}
+	return &template, nil
+}
+
+func (r *pgTemplates) Create(ctx context.Context, organizationID string, req *models.CreateTemplate) (*models.Template, error) {
+	var template models.Template
+	err := scanTemplate(r.q.QueryRowContext(ctx,
+		`INSERT INTO templates (name, organization_id, html)
+		VALUES ($1, $2, $3)
+		RETURNING `+templateColumns,
+		req.Name, organizationID, req.HTML,
+	), &template)
+	if err != nil {
+		return nil, fmt.Errorf("error creating template: %w", err)
+	}
+	return &template, nil
+}
+
+func (r *pgTemplates) Update(ctx context.Context, organizationID, id string, req *models.UpdateTemplate) (*models.Template, error) {
+	// Empty fields are left unchanged
+	var template models.Template
+	err := scanTemplate(r.q.QueryRowContext(ctx,
+		`UPDATE templates
+		SET name = COALESCE(NULLIF($1, ''), name),
+			html = COALESCE(NULLIF($2, ''), html),
+			version = version + 1
+		WHERE id = $3 AND organization_id = $4
+		RETURNING `+templateColumns,
+		req.Name, req.HTML, id, organizationID,
+	), &template)
+	if err == sql.ErrNoRows {
+		return nil, NotFound("template")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error updating template: %w", err)
+	}
+	return &template, nil
+}
+
+func (r *pgTemplates) Missing(ctx context.Context, organizationID string, ids []string) ([]string, error) {
+	return pgMissing(ctx, r.q, "templates", organizationID, ids)
+}
@@ -1,166 +1,80 @@
 package services
 
 import (
-	"database/sql"
-	"fmt"
+	"context"
 
 	"github.com/donnaloia/sendpulse/internal/models"
 )
 
 type ProfileService struct {
-	db *sql.DB
+	store Store
 }
 
-func NewProfileService(db *sql.DB) *ProfileService {
-	return &ProfileService{db: db}
+func NewProfileService(store Store) *ProfileService {
+	return &ProfileService{store: store}
 }
 
-func (s *ProfileService) GetAll(organizationID string, params models.PaginationParams) (*models.PaginatedResponse[models.Profile], error) {
-	if params.Page < 1 {
-		params.Page = 1
-	}
-	if params.PageSize < 1 {
-		params.PageSize = 10
-	}
+// profileKey is a profile's position in a list
+func profileKey(p models.Profile) rowKey {
+	return rowKey{"created_at": p.CreatedAt, "id": p.ID}
+}
 
-	var total int
-	err := s.db.QueryRow(
-		"SELECT COUNT(*) FROM profiles WHERE organization_id = $1",
-		organizationID,
-	).Scan(&total)
-	if err != nil {
-		return nil, fmt.Errorf("error counting profiles: %w", err)
-	}
+func (s *ProfileService) GetAll(ctx context.Context, organizationID string, params models.PaginationParams) (*models.PaginatedResponse[models.Profile], error) {
+	return s.store.Profiles().List(ctx, organizationID, params)
+}
 
-	offset := (params.Page - 1) * params.PageSize
-	rows, err := s.db.Query(
-		`SELECT id, username, email, organization_id, picture_url, created_at 
-		FROM profiles 
-		WHERE organization_id = $1
-		ORDER BY created_at DESC 
-		LIMIT $2 OFFSET $3`,
-		organizationID, params.PageSize, offset,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("error fetching profiles: %w", err)
-	}
-	defer rows.Close()
+func (s *ProfileService) GetByID(ctx context.Context, organizationID string, id string) (*models.Profile, error) {
+	return s.store.Profiles().Get(ctx, organizationID, id)
+}
 
-	var profiles []models.Profile
-	for rows.Next() {
-		var profile models.Profile
-		if err := rows.Scan(
-			&profile.ID,
-			&profile.Username,
-			&profile.Email,
-			&profile.FirstName,
-			&profile.LastName,
-			&profile.Timezone,
-			&profile.Bio,
-			&profile.OrganizationID,
-			&profile.PictureURL,
-			&profile.CreatedAt,
-		); err != nil {
-			return nil, fmt.Errorf("error scanning profile: %w", err)
+func (s *ProfileService) Create(ctx context.Context, actor models.Actor, organizationID string, req *models.CreateProfile) (*models.Profile, error) {
+	var profile *models.Profile
+	err := s.store.InTx(ctx, func(tx Store) error {
+		var err error
+		profile, err = tx.Profiles().Create(ctx, organizationID, req)
+		if err != nil {
+			return err
 		}
-		profiles = append(profiles, profile)
-	}
 
-	return models.NewPaginatedResponse(profiles, total, params.Page, params.PageSize), nil
-}
-
-func (s *ProfileService) GetByID(organizationID string, id string) (*models.Profile, error) {
-	var profile models.Profile
-	err := s.db.QueryRow(
-		`SELECT id, username, email, first_name, last_name, timezone, bio, organization_id, picture_url, created_at 
-		FROM profiles 
-		WHERE id = $1 AND organization_id = $2`,
-		id, organizationID,
-	).Scan(
-		&profile.ID,
-		&profile.Username,
-		&profile.Email,
-		&profile.FirstName,
-		&profile.LastName,
-		&profile.Timezone,
-		&profile.Bio,
-		&profile.OrganizationID,
-		&profile.PictureURL,
-		&profile.CreatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("profile not found")
-	}
+		return recordAudit(ctx, tx, actor, auditRecord{
+			organizationID: organizationID,
+			action:         AuditActionCreate,
+			resourceType:   "profile",
+			resourceID:     profile.ID,
+			after:          profile,
+		})
+	})
 	if err != nil {
-		return nil, fmt.Errorf("error fetching profile: %w", err)
+		return nil, err
 	}
-	return &profile, nil
+	return profile, nil
 }
 
-func (s *ProfileService) Create(organizationID string, req *models.CreateProfile) (*models.Profile, error) {
-	var profile models.Profile
-	err := s.db.QueryRow(
-		`INSERT INTO profiles (id, username, email, first_name, last_name, timezone, bio, organization_id, picture_url) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) 
-		RETURNING id, username, email, first_name, last_name, timezone, bio, organization_id, picture_url, created_at`,
-		req.ID, req.Username, req.Email, req.FirstName, req.LastName, req.Timezone, req.Bio, organizationID, req.PictureURL,
-	).Scan(
-		&profile.ID,
-		&profile.Username,
-		&profile.Email,
-		&profile.FirstName,
-		&profile.LastName,
-		&profile.Timezone,
-		&profile.Bio,
-		&profile.OrganizationID,
-		&profile.PictureURL,
-		&profile.CreatedAt,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("error creating profile: %w", err)
-	}
-	return &profile, nil
-}
+func (s *ProfileService) Update(ctx context.Context, actor models.Actor, organizationID string, id string, req *models.UpdateProfile) (*models.Profile, error) {
+	var profile *models.Profile
+	err := s.store.InTx(ctx, func(tx Store) error {
+		// Lock the row and capture its current state for the audit log
+		before, err := tx.Profiles().GetForUpdate(ctx, organizationID, id)
+		if err != nil {
+			return err
+		}
 
-func (s *ProfileService) Update(organizationID string, id string, req *models.UpdateProfile) (*models.Profile, error) {
-	var profile models.Profile
-	err := s.db.QueryRow(
-		`UPDATE profiles 
-		SET username = $1, 
-			email = $2, 
-			first_name = $3, 
-			last_name = $4, 
-			timezone = $5, 
-			bio = $6, 
-			picture_url = $7
-		WHERE id = $8 AND organization_id = $9
-		RETURNING id, username, email, first_name, last_name, timezone, bio, organization_id, picture_url, created_at`,
-		req.Username,
-		req.Email,
-		req.FirstName,
-		req.LastName,
-		req.Timezone,
-		req.Bio,
-		req.PictureURL,
-		id,
-		organizationID,
-	).Scan(
-		&profile.ID,
-		&profile.Username,
-		&profile.Email,
-		&profile.FirstName,
-		&profile.LastName,
-		&profile.Timezone,
-		&profile.Bio,
-		&profile.OrganizationID,
-		&profile.PictureURL,
-		&profile.CreatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("profile not found")
-	}
+		profile, err = tx.Profiles().Update(ctx, organizationID, id, req)
+		if err != nil {
+			return err
+		}
+
+		return recordAudit(ctx, tx, actor, auditRecord{
+			organizationID: organizationID,
+			action:         AuditActionUpdate,
+			resourceType:   "profile",
+			resourceID:     profile.ID,
+			before:         before,
+			after:          profile,
+		})
+	})
 	if err != nil {
-		return nil, fmt.Errorf("error updating profile: %w", err)
+		return nil, err
 	}
-	return &profile, nil
+	return profile, nil
 }
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/donnaloia/sendpulse/internal/metrics"
+	"github.com/donnaloia/sendpulse/internal/models"
+	"github.com/donnaloia/sendpulse/internal/sending"
+)
+
+// SendingService reports what organizations have sent against their
+// sending limits
+type SendingService struct {
+	store  Store
+	limits *sending.Config
+}
+
+func NewSendingService(store Store, limits *sending.Config) *SendingService {
+	return &SendingService{store: store, limits: limits}
+}
+
+// Usage returns the recipients the organization's launches have reached
+// today and this month, in UTC, against its quotas
+func (s *SendingService) Usage(ctx context.Context, organizationID string) (*models.SendingUsage, error) {
+	org, err := s.store.Organizations().Get(ctx, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	count, err := s.store.SendingUsage().Get(ctx, org.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	limits := s.limits.For(org.ID)
+	day, month := quotaUsages(count, limits, now)
+	return &models.SendingUsage{
+		OrganizationID: org.ID,
+		Day:            day,
+		Month:          month,
+		SendingDomain:  limits.Domain,
+		MaxSendRate:    s.limits.SendRate(limits.Domain),
+	}, nil
+}
+
+// reserveRecipients counts a launch's recipients against the
+// organization's quotas. A launch that doesn't fit in what's left of either
+// quota is refused rather than partly sent.
+func reserveRecipients(ctx context.Context, tx Store, limits sending.Limits, organizationID string, recipients int) error {
+	now := time.Now()
+	count, err := tx.SendingUsage().GetForUpdate(ctx, organizationID, now)
+	if err != nil {
+		return err
+	}
+	day, month := quotaUsages(count, limits, now)
+	for _, quota := range []struct {
+		name  string
+		usage models.QuotaUsage
+	}{{"daily", day}, {"monthly", month}} {
+		if quota.usage.Remaining == nil || recipients <= *quota.usage.Remaining {
+			continue
+		}
+		metrics.LaunchesOverQuota.WithLabelValues(quota.name).Inc()
+		return QuotaExceeded(
+			fmt.Sprintf("the campaign has %d recipients but only %d of the %s quota of %d remain",
+				recipients, *quota.usage.Remaining, quota.name, *quota.usage.Limit),
+			FieldError{
+				Field:   "recipients",
+				Message: fmt.Sprintf("the %s quota resets at %s", quota.name, quota.usage.ResetsAt.Format(time.RFC3339)),
+			},
+		)
+	}
+	if recipients == 0 {
+		return nil
+	}
+	return tx.SendingUsage().Add(ctx, organizationID, now, recipients)
+}
+
+// scheduleDomain returns when a launch's event may be published, so that
+// launches from a domain reach the sending service no faster than rate
+// allows: each waits until the recipients of those before it could have
+// been sent at rate. Without a rate it's due now.
+func scheduleDomain(ctx context.Context, tx Store, domain string, rate float64, recipients int) (time.Time, error) {
+	now := time.Now()
+	if rate <= 0 {
+		return now, nil
+	}
+	d := time.Duration(float64(recipients) / rate * float64(time.Second))
+	return tx.SendingUsage().ScheduleDomain(ctx, domain, now, d)
+}
+
+// quotaUsages applies the organization's quotas to its counts as of now
+func quotaUsages(count SendingCount, limits sending.Limits, now time.Time) (day, month models.QuotaUsage) {
+	day = quotaUsage(count.Day, limits.DailyRecipients, utcDay(now).AddDate(0, 0, 1))
+	month = quotaUsage(count.Month, limits.MonthlyRecipients, monthStart(now).AddDate(0, 1, 0))
+	return day, month
+}
+
+func quotaUsage(used, limit int, resetsAt time.Time) models.QuotaUsage {
+	usage := models.QuotaUsage{Used: used, ResetsAt: resetsAt}
+	if limit > 0 {
+		remaining := max(0, limit-used)
+		usage.Limit, usage.Remaining = &limit, &remaining
+	}
+	return usage
+}
+
+// utcDay returns the start of t's day in UTC, when daily quotas reset
+func utcDay(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// monthStart returns the start of t's month in UTC, when monthly quotas
+// reset
+func monthStart(t time.Time) time.Time {
+	y, m, _ := t.UTC().Date()
+	return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+}
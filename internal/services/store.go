@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/donnaloia/sendpulse/internal/events"
+	"github.com/donnaloia/sendpulse/internal/models"
+)
+
+// Store gives the services access to each aggregate's repository. Writes that
+// touch several rows, and every write's audit entry, go through InTx so they
+// commit or roll back together.
+//
+// Repositories return the domain errors from errors.go (NotFound, Conflict,
+// Validation), so services and handlers don't depend on the backend.
+type Store interface {
+	Organizations() OrganizationRepository
+	Profiles() ProfileRepository
+	EmailAddresses() EmailAddressRepository
+	EmailGroups() EmailGroupRepository
+	Templates() TemplateRepository
+	Campaigns() CampaignRepository
+	APIKeys() APIKeyRepository
+	AuditLog() AuditRepository
+	SendingUsage() SendingUsageRepository
+	Outbox() OutboxRepository
+
+	// InTx runs fn against a Store whose repositories share one transaction,
+	// committing when fn returns nil and rolling back otherwise
+	InTx(ctx context.Context, fn func(tx Store) error) error
+}
+
+type OrganizationRepository interface {
+	List(ctx context.Context, params models.PaginationParams) (*models.PaginatedResponse[models.Organization], error)
+	Get(ctx context.Context, id string) (*models.Organization, error)
+	Create(ctx context.Context, req *models.CreateOrganization) (*models.Organization, error)
+}
+
+type ProfileRepository interface {
+	List(ctx context.Context, organizationID string, params models.PaginationParams) (*models.PaginatedResponse[models.Profile], error)
+	Get(ctx context.Context, organizationID, id string) (*models.Profile, error)
+	// GetForUpdate is Get, locking the profile until the transaction ends
+	GetForUpdate(ctx context.Context, organizationID, id string) (*models.Profile, error)
+	Create(ctx context.Context, organizationID string, req *models.CreateProfile) (*models.Profile, error)
+	Update(ctx context.Context, organizationID, id string, req *models.UpdateProfile) (*models.Profile, error)
+}
+
+type EmailAddressRepository interface {
+	List(ctx context.Context, organizationID string, query models.ListQuery, params models.PaginationParams) (*models.PaginatedResponse[models.EmailAddress], error)
+	Get(ctx context.Context, organizationID, id string) (*models.EmailAddress, error)
+	Create(ctx context.Context, organizationID string, req *models.CreateEmailAddressRequest) (*models.EmailAddress, error)
+	// Missing returns the ids that aren't addresses of the organization
+	Missing(ctx context.Context, organizationID string, ids []string) ([]string, error)
+}
+
+// EmailGroupRepository covers groups and their members. Members belong to
+// the organization their group belongs to.
+type EmailGroupRepository interface {
+	List(ctx context.Context, organizationID string, query models.ListQuery, params models.PaginationParams) (*models.PaginatedResponse[models.EmailGroup], error)
+	Get(ctx context.Context, organizationID, id string) (*models.EmailGroup, error)
+	Create(ctx context.Context, organizationID string, req *models.CreateEmailGroup) (*models.EmailGroup, error)
+	// Missing returns the ids that aren't groups of the organization
+	Missing(ctx context.Context, organizationID string, ids []string) ([]string, error)
+
+	ListMembers(ctx context.Context, organizationID string, params models.PaginationParams) (*models.PaginatedResponse[models.EmailGroupMember], error)
+	GetMember(ctx context.Context, organizationID, id string) (*models.EmailGroupMember, error)
+	AddMember(ctx context.Context, req *models.CreateEmailGroupMember) (*models.EmailGroupMember, error)
+	// RemoveMember deletes the member and returns it as it was
+	RemoveMember(ctx context.Context, organizationID, id string) (*models.EmailGroupMember, error)
+}
+
+type TemplateRepository interface {
+	List(ctx context.Context, organizationID string, query models.ListQuery, params models.PaginationParams) (*models.PaginatedResponse[models.Template], error)
+	Get(ctx context.Context, organizationID, id string) (*models.Template, error)
+	// GetForUpdate is Get, locking the template until the transaction ends
+	GetForUpdate(ctx context.Context, organizationID, id string) (*models.Template, error)
+	Create(ctx context.Context, organizationID string, req *models.CreateTemplate) (*models.Template, error)
+	// Update writes the non-empty fields of req and bumps the version
+	Update(ctx context.Context, organizationID, id string, req *models.UpdateTemplate) (*models.Template, error)
+	// Missing returns the ids that aren't templates of the organization
+	Missing(ctx context.Context, organizationID string, ids []string) ([]string, error)
+}
+
+type CampaignRepository interface {
+	List(ctx context.Context, organizationID string, query models.ListQuery, params models.PaginationParams) (*models.PaginatedResponse[models.Campaign], error)
+	// Get returns the campaign with its templates and email groups
+	Get(ctx context.Context, organizationID, id string) (*models.Campaign, error)
+	// GetForUpdate is Get, locking the campaign until the transaction ends
+	GetForUpdate(ctx context.Context, organizationID, id string) (*models.Campaign, error)
+	Create(ctx context.Context, organizationID string, req *models.CreateCampaign) (*models.Campaign, error)
+	// Update applies change and bumps the version
+	Update(ctx context.Context, organizationID, id string, change *CampaignChange) error
+	// Recipients returns the distinct addresses in the campaign's email
+	// groups, in address order
+	Recipients(ctx context.Context, organizationID, id string) ([]string, error)
+}
+
+// CampaignChange is an update to a campaign. Empty fields are left alone and
+// links are given as the difference to apply.
+type CampaignChange struct {
+	Name              string
+	Status            string
+	AddTemplates      []string
+	RemoveTemplates   []string
+	AddEmailGroups    []string
+	RemoveEmailGroups []string
+}
+
+type APIKeyRepository interface {
+	List(ctx context.Context, organizationID string, params models.PaginationParams) (*models.PaginatedResponse[models.APIKey], error)
+	Get(ctx context.Context, organizationID, id string) (*models.APIKey, error)
+	// GetForUpdate is Get, locking the key until the transaction ends
+	GetForUpdate(ctx context.Context, organizationID, id string) (*models.APIKey, error)
+	// GetByPrefix returns the key with its stored hash, for authentication
+	GetByPrefix(ctx context.Context, prefix string) (*models.APIKey, string, error)
+	Create(ctx context.Context, organizationID string, req *models.CreateAPIKey, prefix, keyHash string) (*models.APIKey, error)
+	Revoke(ctx context.Context, id string) (*models.APIKey, error)
+	// Touch records that the key was used. Implementations may skip the
+	// write when it was used recently.
+	Touch(ctx context.Context, id string) error
+}
+
+type AuditRepository interface {
+	List(ctx context.Context, organizationID string, filter models.AuditFilter, params models.PaginationParams) (*models.PaginatedResponse[models.AuditEntry], error)
+	Create(ctx context.Context, entry *models.AuditEntry) error
+}
+
+// SendingUsageRepository counts the recipients of each organization's
+// launched campaigns by UTC day
+type SendingUsageRepository interface {
+	// Get returns the recipients counted on day, and in day's month up to
+	// and including it
+	Get(ctx context.Context, organizationID string, day time.Time) (SendingCount, error)
+	// GetForUpdate is Get, locking the organization's counts until the
+	// transaction ends so concurrent launches are checked one at a time
+	GetForUpdate(ctx context.Context, organizationID string, day time.Time) (SendingCount, error)
+	// Add counts recipients on day
+	Add(ctx context.Context, organizationID string, day time.Time, recipients int) error
+	// ScheduleDomain books d of sending from domain, after what's already
+	// booked and no earlier than now, and returns when the booking starts.
+	// The domain is locked until the transaction ends, so concurrent
+	// launches book one after another.
+	ScheduleDomain(ctx context.Context, domain string, now time.Time, d time.Duration) (time.Time, error)
+}
+
+// SendingCount is the recipients counted in a day and in its month so far
+type SendingCount struct {
+	Day   int
+	Month int
+}
+
+// OutboxRepository holds launch events until they're published. Events are
+// added in their launch's transaction, so there's one exactly when the
+// launch committed.
+type OutboxRepository interface {
+	Add(ctx context.Context, msg *OutboxMessage) error
+	// Due returns up to limit events whose SendAt has come by now, in the
+	// order they're due, locking them until the transaction ends. Events
+	// locked by another transaction are skipped.
+	Due(ctx context.Context, now time.Time, limit int) ([]OutboxMessage, error)
+	Delete(ctx context.Context, id int64) error
+}
+
+// OutboxMessage is a launch event waiting to be published
+type OutboxMessage struct {
+	ID    int64
+	Event events.CampaignLaunchedEvent
+	// TraceContext is the launch's trace context, so the publish joins the
+	// launch's trace
+	TraceContext map[string]string
+	// SendAt is when the event is due, once the launches before it from
+	// its sending domain have had time to be sent
+	SendAt time.Time
+}
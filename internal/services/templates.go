@@ -1,108 +1,124 @@
 package services
 
 import (
-	"database/sql"
-	"fmt"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 
 	"github.com/donnaloia/sendpulse/internal/models"
 )
 
 type TemplateService struct {
-	db *sql.DB
+	store Store
 }
 
-func NewTemplateService(db *sql.DB) *TemplateService {
-	return &TemplateService{db: db}
+func NewTemplateService(store Store) *TemplateService {
+	return &TemplateService{store: store}
 }
 
-func (s *TemplateService) GetAll(organizationID string, params models.PaginationParams) (*models.PaginatedResponse[models.Template], error) {
-	if params.Page < 1 {
-		params.Page = 1
-	}
-	if params.PageSize < 1 {
-		params.PageSize = 10
-	}
+// templateListSpec is what GET /templates accepts in sort, filters and q
+var templateListSpec = &listSpec{
+	sortable: map[string]listColumn{
+		"name":       nameColumn,
+		"created_at": createdAtColumn,
+	},
+	filterable: map[string]listColumn{
+		"name": nameColumn,
+	},
+	searchable: []string{"name"},
+}
 
-	var total int
-	err := s.db.QueryRow(
-		"SELECT COUNT(*) FROM templates WHERE organization_id = $1",
-		organizationID,
-	).Scan(&total)
-	if err != nil {
-		return nil, fmt.Errorf("error counting templates: %w", err)
-	}
+// templateKey is a template's position in a list
+func templateKey(t models.Template) rowKey {
+	return rowKey{"created_at": t.CreatedAt, "name": t.Name, "id": t.ID}
+}
 
-	offset := (params.Page - 1) * params.PageSize
-	rows, err := s.db.Query(
-		`SELECT id, name, organization_id, html, created_at 
-		FROM templates 
-		WHERE organization_id = $1
-		ORDER BY created_at DESC 
-		LIMIT $2 OFFSET $3`,
-		organizationID, params.PageSize, offset,
-	)
+func (s *TemplateService) GetAll(ctx context.Context, organizationID string, query models.ListQuery, params models.PaginationParams) (*models.PaginatedResponse[models.Template], error) {
+	return s.store.Templates().List(ctx, organizationID, query, params)
+}
+
+func (s *TemplateService) GetByID(ctx context.Context, organizationID string, id string) (*models.Template, error) {
+	return s.store.Templates().Get(ctx, organizationID, id)
+}
+
+func (s *TemplateService) Create(ctx context.Context, actor models.Actor, organizationID string, req *models.CreateTemplate) (*models.Template, error) {
+	var template *models.Template
+	err := s.store.InTx(ctx, func(tx Store) error {
+		var err error
+		template, err = tx.Templates().Create(ctx, organizationID, req)
+		if err != nil {
+			return err
+		}
+
+		return recordAudit(ctx, tx, actor, auditRecord{
+			organizationID: organizationID,
+			action:         AuditActionCreate,
+			resourceType:   "template",
+			resourceID:     template.ID,
+			after:          newTemplateSnapshot(template),
+		})
+	})
 	if err != nil {
-		return nil, fmt.Errorf("error fetching templates: %w", err)
+		return nil, err
 	}
-	defer rows.Close()
+	return template, nil
+}
 
-	var templates []models.Template
-	for rows.Next() {
-		var template models.Template
-		if err := rows.Scan(
-			&template.ID,
-			&template.Name,
-			&template.OrganizationID,
-			&template.HTML,
-			&template.CreatedAt,
-		); err != nil {
-			return nil, fmt.Errorf("error scanning template: %w", err)
+// Update applies req to the template. When version is non-zero the update
+// only goes ahead if the template is still at that version.
+func (s *TemplateService) Update(ctx context.Context, actor models.Actor, organizationID string, id string, req *models.UpdateTemplate, version int) (*models.Template, error) {
+	var template *models.Template
+	err := s.store.InTx(ctx, func(tx Store) error {
+		// Lock the template so concurrent updates queue up behind the
+		// version check instead of overwriting each other
+		before, err := tx.Templates().GetForUpdate(ctx, organizationID, id)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion("template", before.Version, version); err != nil {
+			return err
 		}
-		templates = append(templates, template)
-	}
 
-	return models.NewPaginatedResponse(templates, total, params.Page, params.PageSize), nil
-}
+		template, err = tx.Templates().Update(ctx, organizationID, id, req)
+		if err != nil {
+			return err
+		}
 
-func (s *TemplateService) GetByID(organizationID string, id string) (*models.Template, error) {
-	var template models.Template
-	err := s.db.QueryRow(
-		`SELECT id, name, organization_id, html, created_at 
-		FROM templates 
-		WHERE id = $1 AND organization_id = $2`,
-		id, organizationID,
-	).Scan(
-		&template.ID,
-		&template.Name,
-		&template.OrganizationID,
-		&template.HTML,
-		&template.CreatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("template not found")
-	}
+		return recordAudit(ctx, tx, actor, auditRecord{
+			organizationID: organizationID,
+			action:         AuditActionUpdate,
+			resourceType:   "template",
+			resourceID:     id,
+			before:         newTemplateSnapshot(before),
+			after:          newTemplateSnapshot(template),
+		})
+	})
 	if err != nil {
-		return nil, fmt.Errorf("error fetching template: %w", err)
+		return nil, err
 	}
-	return &template, nil
+	return template, nil
 }
 
-func (s *TemplateService) Create(organizationID string, req *models.CreateTemplate) (*models.Template, error) {
-	var template models.Template
-	err := s.db.QueryRow(
-		`INSERT INTO templates (name, organization_id, html) 
-		VALUES ($1, $2, $3) 
-		RETURNING id, name, organization_id, html, created_at`,
-		req.Name, organizationID, req.HTML,
-	).Scan(
-		&template.ID,
-		&template.Name,
-		&template.OrganizationID,
-		&template.HTML,
-		&template.CreatedAt,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("error creating template: %w", err)
+// templateSnapshot is the audit log view of a template. The HTML, which can
+// run to 512 KiB, is recorded by hash and size so it isn't copied into every
+// entry; a changed hash still shows up in the entry's changes.
+type templateSnapshot struct {
+	ID             string `json:"id"`
+	OrganizationID string `json:"organization_id"`
+	Name           string `json:"name"`
+	HTMLSHA256     string `json:"html_sha256"`
+	HTMLBytes      int    `json:"html_bytes"`
+	Version        int    `json:"version"`
+}
+
+func newTemplateSnapshot(t *models.Template) *templateSnapshot {
+	sum := sha256.Sum256([]byte(t.HTML))
+	return &templateSnapshot{
+		ID:             t.ID,
+		OrganizationID: t.OrganizationID,
+		Name:           t.Name,
+		HTMLSHA256:     hex.EncodeToString(sum[:]),
+		HTMLBytes:      len(t.HTML),
+		Version:        t.Version,
 	}
-	return &template, nil
 }
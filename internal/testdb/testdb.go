@@ -0,0 +1,245 @@
+package testdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"testing"
+
+	"github.com/donnaloia/sendpulse/internal/migrate"
+	"github.com/donnaloia/sendpulse/migrations"
+
+	_ "github.com/lib/pq"
+)
+
+// The integration tests run against the Postgres server at URLEnv when it's
+// set, e.g. the docker-compose one. Otherwise they start a throwaway server
+// with the local initdb and pg_ctl, from BinEnv, PATH or the usual install
+// directories. With neither available they're skipped.
+const (
+	URLEnv = "TEST_DATABASE_URL"
+	BinEnv = "PG_BIN"
+)
+
+var (
+	// adminURL connects to the server's maintenance database
+	adminURL *url.URL
+	admin    *sql.DB
+	// template is the migrated database every test copies
+	template string
+	// unavailable says why there's no server, when there isn't one
+	unavailable string
+	databases   atomic.Int64
+)
+
+// Main runs the tests with a server for New to create databases on. Call it
+// from TestMain.
+func Main(m *testing.M) {
+	stop, err := setup()
+	if err != nil {
+		unavailable = err.Error()
+	}
+	defer func() {
+		if stop != nil {
+			stop()
+		}
+	}()
+	m.Run()
+}
+
+// New returns a connection to a fresh, fully migrated database of the
+// test's own, which is dropped when the test ends. Copying a template is
+// much faster than migrating, and unlike a schema per test keeps extensions
+// and sequences separate too.
+func New(t testing.TB) *sql.DB {
+	t.Helper()
+	return create(t, template)
+}
+
+// NewEmpty is New without the schema, for testing the migrations themselves
+func NewEmpty(t testing.TB) *sql.DB {
+	t.Helper()
+	return create(t, "template0")
+}
+
+func create(t testing.TB, from string) *sql.DB {
+	t.Helper()
+	if unavailable != "" {
+		t.Skipf("no postgres for integration tests: %s", unavailable)
+	}
+
+	name := fmt.Sprintf("%s_%d", template, databases.Add(1))
+	if _, err := admin.Exec(fmt.Sprintf("CREATE DATABASE %s TEMPLATE %s", name, from)); err != nil {
+		t.Fatalf("error creating test database: %v", err)
+	}
+
+	db, err := sql.Open("postgres", withDatabase(adminURL, name))
+	if err != nil {
+		t.Fatalf("error opening test database: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		dropDatabase(name)
+	})
+	return db
+}
+
+func setup() (stop func(), err error) {
+	var rawURL string
+	if rawURL = os.Getenv(URLEnv); rawURL == "" {
+		rawURL, stop, err = startServer()
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer func() {
+		if err != nil && stop != nil {
+			stop()
+			stop = nil
+		}
+	}()
+
+	if adminURL, err = url.Parse(rawURL); err != nil || adminURL.Scheme == "" {
+		return stop, fmt.Errorf("%s must be a postgres:// URL", URLEnv)
+	}
+	if admin, err = sql.Open("postgres", rawURL); err != nil {
+		return stop, err
+	}
+	if err := admin.Ping(); err != nil {
+		return stop, fmt.Errorf("error connecting to postgres: %w", err)
+	}
+
+	// Unique per process, since packages' tests run in parallel against a
+	// shared server
+	template = fmt.Sprintf("sendpulse_test_%d", os.Getpid())
+	if err := migrateTemplate(); err != nil {
+		dropDatabase(template)
+		return stop, err
+	}
+
+	serverStop := stop
+	return func() {
+		dropDatabase(template)
+		admin.Close()
+		if serverStop != nil {
+			serverStop()
+		}
+	}, nil
+}
+
+func migrateTemplate() error {
+	if _, err := admin.Exec("CREATE DATABASE " + template); err != nil {
+		return fmt.Errorf("error creating template database: %w", err)
+	}
+
+	db, err := sql.Open("postgres", withDatabase(adminURL, template))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		return fmt.Errorf("error migrating template database: %w", err)
+	}
+	return nil
+}
+
+// startServer initializes a cluster in a temporary directory and starts it
+// on a free port. Durability is switched off, since the data is thrown away.
+func startServer() (string, func(), error) {
+	bin, err := findBinaries()
+	if err != nil {
+		return "", nil, err
+	}
+	if os.Geteuid() == 0 {
+		return "", nil, fmt.Errorf("initdb can't run as root; set %s instead", URLEnv)
+	}
+
+	dir, err := os.MkdirTemp("", "sendpulse-pg-")
+	if err != nil {
+		return "", nil, err
+	}
+	data := filepath.Join(dir, "data")
+
+	initdb := exec.Command(filepath.Join(bin, "initdb"), "-D", data, "-U", "postgres", "-A", "trust", "-E", "UTF8", "--no-sync")
+	if out, err := initdb.CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("initdb failed: %v: %s", err, out)
+	}
+
+	port, err := freePort()
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", nil, err
+	}
+	options := fmt.Sprintf("-p %d -k %s -c listen_addresses=127.0.0.1 -c fsync=off -c synchronous_commit=off -c full_page_writes=off", port, dir)
+	start := exec.Command(filepath.Join(bin, "pg_ctl"), "-D", data, "-l", filepath.Join(dir, "postgres.log"), "-o", options, "-w", "start")
+	if out, err := start.CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("pg_ctl start failed: %v: %s", err, out)
+	}
+
+	stop := func() {
+		exec.Command(filepath.Join(bin, "pg_ctl"), "-D", data, "-m", "immediate", "-w", "stop").Run()
+		os.RemoveAll(dir)
+	}
+	return fmt.Sprintf("postgres://postgres@127.0.0.1:%d/postgres?sslmode=disable", port), stop, nil
+}
+
+// findBinaries returns the directory holding initdb and pg_ctl, preferring
+// the newest installed version
+func findBinaries() (string, error) {
+	if bin := os.Getenv(BinEnv); bin != "" {
+		return bin, nil
+	}
+	if path, err := exec.LookPath("initdb"); err == nil {
+		return filepath.Dir(path), nil
+	}
+
+	var candidates []string
+	for _, pattern := range []string{"/usr/lib/postgresql/*/bin", "/usr/pgsql-*/bin", "/opt/homebrew/opt/postgresql@*/bin"} {
+		matches, _ := filepath.Glob(pattern)
+		candidates = append(candidates, matches...)
+	}
+	candidates = append(candidates, "/usr/local/pgsql/bin")
+	sort.Sort(sort.Reverse(sort.StringSlice(candidates)))
+	for _, dir := range candidates {
+		if _, err := os.Stat(filepath.Join(dir, "initdb")); err == nil {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("initdb not found; set %s or %s", BinEnv, URLEnv)
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+func dropDatabase(name string) {
+	// A test may have left connections behind, e.g. from a request that was
+	// still running when it failed
+	admin.Exec(`SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = $1 AND pid <> pg_backend_pid()`, name)
+	admin.Exec("DROP DATABASE IF EXISTS " + name)
+}
+
+func withDatabase(u *url.URL, name string) string {
+	copied := *u
+	copied.Path = "/" + name
+	return copied.String()
+}
@@ -0,0 +1,123 @@
+// Package tracing sets up OpenTelemetry tracing. Spans are started with the
+// global tracer provider, which Setup configures:
+//
+//	ctx, span := otel.Tracer(name).Start(ctx, "operation")
+//	defer span.End()
+//
+// Trace context is propagated in W3C traceparent headers, over HTTP and in
+// Kafka messages.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// Exporters
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+type Config struct {
+	// Exporter is where spans go: none, stdout (pretty-printed JSON, for
+	// local use) or otlp
+	Exporter    string `yaml:"exporter" env:"TRACING_EXPORTER"`
+	ServiceName string `yaml:"service_name" env:"TRACING_SERVICE_NAME"`
+	// SampleRatio is the share of traces started here that are recorded.
+	// Requests that arrive in a trace follow their caller's decision.
+	SampleRatio float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO"`
+
+	// OTLPEndpoint is the collector's OTLP/HTTP address, as host:port
+	OTLPEndpoint string `yaml:"otlp_endpoint" env:"TRACING_OTLP_ENDPOINT"`
+	// OTLPInsecure sends spans over plain HTTP instead of HTTPS
+	OTLPInsecure bool `yaml:"otlp_insecure" env:"TRACING_OTLP_INSECURE"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Exporter:     ExporterNone,
+		ServiceName:  "sendpulse",
+		SampleRatio:  1,
+		OTLPEndpoint: "localhost:4318",
+	}
+}
+
+func (c *Config) Validate() error {
+	var errs []error
+	switch c.Exporter {
+	case ExporterNone, ExporterStdout, ExporterOTLP:
+	default:
+		errs = append(errs, fmt.Errorf("TRACING_EXPORTER %q isn't none, stdout or otlp", c.Exporter))
+	}
+	if c.Exporter == ExporterNone {
+		return errors.Join(errs...)
+	}
+	if c.ServiceName == "" {
+		errs = append(errs, errors.New("TRACING_SERVICE_NAME is empty"))
+	}
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		errs = append(errs, fmt.Errorf("TRACING_SAMPLE_RATIO %g isn't between 0 and 1", c.SampleRatio))
+	}
+	if c.Exporter == ExporterOTLP && c.OTLPEndpoint == "" {
+		errs = append(errs, errors.New("TRACING_OTLP_ENDPOINT is empty"))
+	}
+	return errors.Join(errs...)
+}
+
+// Setup installs the global tracer provider and propagator. The returned
+// function flushes the spans still buffered and stops the exporter; it's
+// a no-op when tracing is off.
+func Setup(ctx context.Context, cfg *Config) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	if cfg.Exporter == ExporterNone {
+		// The global provider is a no-op until one is set; trace context is
+		// still passed on
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var exporter sdktrace.SpanExporter
+	switch cfg.Exporter {
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout), stdouttrace.WithPrettyPrint())
+	case ExporterOTLP:
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.OTLPEndpoint)}
+		if cfg.OTLPInsecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error creating %s trace exporter: %w", cfg.Exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(cfg.ServiceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("error describing the service for traces: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS campaign_templates;
+DROP TABLE IF EXISTS templates;
+DROP TABLE IF EXISTS email_group_campaigns;
+DROP TABLE IF EXISTS campaigns;
+DROP TABLE IF EXISTS email_group_members;
+DROP TABLE IF EXISTS email_groups;
+DROP TABLE IF EXISTS email_addresses;
+DROP TABLE IF EXISTS profiles;
+DROP TABLE IF EXISTS organizations;
+
+DROP EXTENSION IF EXISTS "uuid-ossp";
@@ -0,0 +1,21 @@
+-- Audit log of every mutating API call. organization_id deliberately has no
+-- foreign key so the trail survives the organization being deleted.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    organization_id UUID NOT NULL,
+    actor_id VARCHAR(255) NOT NULL,
+    actor_type VARCHAR(50) NOT NULL,
+    action VARCHAR(100) NOT NULL,
+    resource_type VARCHAR(100) NOT NULL,
+    resource_id VARCHAR(255) NOT NULL,
+    before JSONB,
+    after JSONB,
+    changes JSONB NOT NULL DEFAULT '{}',
+    request_id VARCHAR(255),
+    ip VARCHAR(64),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_organization_id_created_at ON audit_log(organization_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_log_resource ON audit_log(organization_id, resource_type, resource_id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor_id ON audit_log(organization_id, actor_id);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_campaigns_org_created_at_id;
+DROP INDEX IF EXISTS idx_templates_org_created_at_id;
+DROP INDEX IF EXISTS idx_email_groups_org_created_at_id;
+DROP INDEX IF EXISTS idx_email_addresses_org_created_at_id;
+DROP INDEX IF EXISTS idx_profiles_org_created_at_id;
+DROP INDEX IF EXISTS idx_api_keys_org_created_at_id;
+DROP INDEX IF EXISTS idx_audit_log_org_created_at_id;
+DROP INDEX IF EXISTS idx_organizations_created_at_id;
+DROP INDEX IF EXISTS idx_email_group_members_created_at_id;
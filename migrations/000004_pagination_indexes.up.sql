@@ -0,0 +1,11 @@
+-- Lists are ordered by (created_at, id) descending and paged by keyset, so
+-- each organization-scoped table gets a matching composite index.
+CREATE INDEX IF NOT EXISTS idx_campaigns_org_created_at_id ON campaigns(organization_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_templates_org_created_at_id ON templates(organization_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_email_groups_org_created_at_id ON email_groups(organization_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_email_addresses_org_created_at_id ON email_addresses(organization_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_profiles_org_created_at_id ON profiles(organization_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_api_keys_org_created_at_id ON api_keys(organization_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_log_org_created_at_id ON audit_log(organization_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_organizations_created_at_id ON organizations(created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_email_group_members_created_at_id ON email_group_members(created_at DESC, id DESC);
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_campaigns_org_status_created_at;
+
+DROP INDEX IF EXISTS idx_campaigns_name_trgm;
+DROP INDEX IF EXISTS idx_templates_name_trgm;
+DROP INDEX IF EXISTS idx_email_groups_name_trgm;
+DROP INDEX IF EXISTS idx_email_addresses_address_trgm;
+
+DROP EXTENSION IF EXISTS pg_trgm;
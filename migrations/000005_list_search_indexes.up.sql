@@ -0,0 +1,11 @@
+-- q= on list endpoints is a case-insensitive substring match (ILIKE
+-- '%...%'), which only trigram indexes can serve.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS idx_campaigns_name_trgm ON campaigns USING GIN (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_templates_name_trgm ON templates USING GIN (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_email_groups_name_trgm ON email_groups USING GIN (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_email_addresses_address_trgm ON email_addresses USING GIN (address gin_trgm_ops);
+
+-- status=... is the most common campaign filter
+CREATE INDEX IF NOT EXISTS idx_campaigns_org_status_created_at ON campaigns(organization_id, status, created_at DESC, id DESC);
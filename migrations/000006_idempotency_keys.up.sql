@@ -0,0 +1,16 @@
+-- Responses to POST requests sent with an Idempotency-Key, replayed when the
+-- same key is sent again. scope is the organization ID, or '' for routes
+-- outside an organization.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    scope VARCHAR(255) NOT NULL,
+    key VARCHAR(255) NOT NULL,
+    request_hash CHAR(64) NOT NULL,
+    status_code INTEGER NOT NULL,
+    content_type VARCHAR(255) NOT NULL DEFAULT '',
+    response_body BYTEA NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (scope, key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
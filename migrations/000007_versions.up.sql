@@ -0,0 +1,4 @@
+-- Row versions for optimistic concurrency control. Every write bumps the
+-- version; it's exposed as the ETag and checked against If-Match.
+ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE templates ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
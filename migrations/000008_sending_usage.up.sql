@@ -0,0 +1,8 @@
+-- Recipients of each organization's launched campaigns, by UTC day, counted
+-- against its daily and monthly sending quotas
+CREATE TABLE IF NOT EXISTS sending_usage (
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    recipients BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (organization_id, day)
+);
@@ -0,0 +1,4 @@
+DELETE FROM idempotency_keys WHERE status_code IS NULL OR response_body IS NULL;
+ALTER TABLE idempotency_keys DROP COLUMN IF EXISTS redacted;
+ALTER TABLE idempotency_keys ALTER COLUMN response_body SET NOT NULL;
+ALTER TABLE idempotency_keys ALTER COLUMN status_code SET NOT NULL;
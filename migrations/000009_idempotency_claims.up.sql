@@ -0,0 +1,8 @@
+-- A request claims its key before it runs by inserting a row without a
+-- response, so duplicates sent meanwhile see it in progress instead of
+-- holding a lock for the whole request. redacted marks responses whose body
+-- held a secret and wasn't kept. scope is now a hash of the caller, method
+-- and path; rows with the old per-organization scope lapse within a day.
+ALTER TABLE idempotency_keys ALTER COLUMN status_code DROP NOT NULL;
+ALTER TABLE idempotency_keys ALTER COLUMN response_body DROP NOT NULL;
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS redacted BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,11 @@
+-- Launch events waiting to be published. Each is written in its launch's
+-- transaction and deleted once the brokers have acknowledged it, so a
+-- launch that commits is announced even if the brokers are down at the time.
+CREATE TABLE IF NOT EXISTS launch_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    campaign_id UUID NOT NULL,
+    payload JSONB NOT NULL,
+    -- The launch's W3C trace context, so the publish joins its trace
+    trace_context JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_launch_outbox_send_at;
+ALTER TABLE launch_outbox DROP COLUMN IF EXISTS send_at;
+DROP TABLE IF EXISTS sending_schedule;
@@ -0,0 +1,12 @@
+-- When each sending domain is next free: launches from a domain are
+-- published one after another, each once the recipients of those before it
+-- could have been sent at the domain's rate
+CREATE TABLE IF NOT EXISTS sending_schedule (
+    domain VARCHAR(255) PRIMARY KEY,
+    free_at TIMESTAMPTZ NOT NULL
+);
+
+-- When the launch's turn to be published comes
+ALTER TABLE launch_outbox ADD COLUMN IF NOT EXISTS send_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_launch_outbox_send_at ON launch_outbox(send_at);
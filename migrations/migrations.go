@@ -0,0 +1,9 @@
+package migrations
+
+import "embed"
+
+// FS holds the schema migrations, so binaries carry their own copy instead
+// of reading them from disk
+//
+//go:embed *.sql
+var FS embed.FS
@@ -13,3 +13,34 @@ func New(status, message string, data interface{}) Response {
 		Data:    data,
 	}
 }
+
+// FieldError describes what is wrong with one field of a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is the body of every error response:
+//
+//	{"error": {"code": "not_found", "message": "campaign not found", "request_id": "..."}}
+type Error struct {
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	Details   []FieldError `json:"details,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+}
+
+type ErrorResponse struct {
+	Error Error `json:"error"`
+}
+
+func NewError(code, message, requestID string, details ...FieldError) ErrorResponse {
+	return ErrorResponse{
+		Error: Error{
+			Code:      code,
+			Message:   message,
+			Details:   details,
+			RequestID: requestID,
+		},
+	}
+}